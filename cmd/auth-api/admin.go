@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"finPrj/internal/auth"
+	users "finPrj/internal/users"
+	"net/http"
+)
+
+func (h *Handlers) AdminUsers(w http.ResponseWriter, r *http.Request) {
+	usersList, err := h.us.GetAll(r.Context())
+	if err != nil {
+		h.internal(w, r, "AdminUsers:: can't get users %s", err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(usersList)
+	if err != nil {
+		h.logger.Sugar().Warnf("AdminUsers:: can't parse users %s", err)
+	}
+}
+
+func (h *Handlers) AdminSetRole(w http.ResponseWriter, r *http.Request) {
+	id, err := h.getID(w, r)
+	if err != nil {
+		return
+	}
+
+	request := map[string]string{}
+	if !h.decodeJSON(w, r, &request, "AdminSetRole") {
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+
+	if !users.ValidRole(request["role"]) {
+		h.fail(w, r, http.StatusBadRequest, "unknown role")
+		return
+	}
+
+	user, err := h.changeUser(r.Context(), id, func(user *users.User) error {
+		user.Role = request["role"]
+		return nil
+	})
+	switch {
+	case err == errNoUser:
+		h.fail(w, r, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		h.internal(w, r, "AdminSetRole:: can't update user %s", err)
+		return
+	}
+
+	//signed tokens carry the role, the old one must not outlive the change
+	err = h.revokeUserSessions(r.Context(), user.ID)
+	if err != nil {
+		h.internal(w, r, "AdminSetRole:: %s", err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(user)
+	if err != nil {
+		h.logger.Sugar().Warnf("AdminSetRole:: can't parse user %s", err)
+	}
+}
+
+func (h *Handlers) AdminRevokeSessions(w http.ResponseWriter, r *http.Request) {
+	id, err := h.getID(w, r)
+	if err != nil {
+		return
+	}
+
+	err = h.revokeUserSessions(r.Context(), id)
+	if err != nil {
+		h.internal(w, r, "AdminRevokeSessions:: %s", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//AdminDeactivateRobot deactivates a robot of any user,
+//even inside of its plan window.
+func (h *Handlers) AdminDeactivateRobot(w http.ResponseWriter, r *http.Request) {
+	robotID, err := h.getID(w, r)
+	if err != nil {
+		return
+	}
+
+	robot, err := h.rs.GetByRobotID(r.Context(), robotID)
+	if err != nil {
+		h.internal(w, r, "AdminDeactivateRobot:: can't get robot by id %s", err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+
+	if robot == nil {
+		h.fail(w, r, http.StatusNotFound, "no robot with such id")
+		return
+	}
+
+	if robot.IsActive {
+		err = h.rs.DeactivateRobot(r.Context(), robot)
+		if err != nil {
+			h.internal(w, r, "AdminDeactivateRobot:: can't deactivate robot %s", err)
+			return
+		}
+		h.logger.Sugar().Infof("AdminDeactivateRobot:: robot %d deactivated by user %d",
+			robot.RobotID, auth.FromContext(r.Context()).UserID)
+	}
+
+	err = json.NewEncoder(w).Encode(robot)
+	if err != nil {
+		h.logger.Sugar().Warnf("AdminDeactivateRobot:: can't parse robot %s", err)
+	}
+}
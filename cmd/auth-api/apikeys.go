@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"finPrj/internal/apikeys"
+	"finPrj/internal/auth"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+type createAPIKeyRequest struct {
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	AllowedIPs []string   `json:"allowed_ips"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+//the key itself is shown only once, in the response to CreateAPIKey
+type createdAPIKey struct {
+	*apikeys.APIKey
+	Key string `json:"key"`
+}
+
+func (h *Handlers) APIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.aks.ListByUserID(r.Context(), auth.FromContext(r.Context()).UserID)
+	if err != nil {
+		h.internal(w, r, "APIKeys:: can't list api keys %s", err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(keys)
+	if err != nil {
+		h.logger.Sugar().Warnf("APIKeys:: can't parse api keys %s", err)
+	}
+}
+
+func (h *Handlers) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	request := createAPIKeyRequest{}
+	if !h.decodeJSON(w, r, &request, "CreateAPIKey") {
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+
+	timeNow := time.Now().UTC()
+	msg := ""
+	if len(request.Scopes) == 0 {
+		msg = "at least one scope required"
+	}
+	for _, scope := range request.Scopes {
+		if !auth.ValidScope(scope) {
+			msg = "unknown scope " + scope
+		}
+	}
+	if err := apikeys.ValidIPs(request.AllowedIPs); err != nil {
+		msg = err.Error()
+	}
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(timeNow) {
+		msg = "expires_at is in the past"
+	}
+
+	if msg != "" {
+		h.fail(w, r, http.StatusBadRequest, msg)
+		return
+	}
+
+	token, keyID, err := apikeys.New()
+	if err != nil {
+		h.internal(w, r, "CreateAPIKey:: %s", err)
+		return
+	}
+
+	key := apikeys.APIKey{
+		KeyID:      keyID,
+		UserID:     auth.FromContext(r.Context()).UserID,
+		Name:       request.Name,
+		KeyHash:    apikeys.Hash(token),
+		Scopes:     request.Scopes,
+		AllowedIPs: request.AllowedIPs,
+		ExpiresAt:  request.ExpiresAt,
+		CreatedAt:  timeNow,
+	}
+
+	err = h.aks.Create(r.Context(), &key)
+	if err != nil {
+		h.internal(w, r, "CreateAPIKey:: can't create api key %s", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(createdAPIKey{APIKey: &key, Key: token})
+	if err != nil {
+		h.logger.Sugar().Warnf("CreateAPIKey:: can't parse api key %s", err)
+	}
+}
+
+func (h *Handlers) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	ok, err := h.aks.Delete(r.Context(), auth.FromContext(r.Context()).UserID, chi.URLParam(r, "kid"))
+	if err != nil {
+		h.internal(w, r, "DeleteAPIKey:: %s", err)
+		return
+	}
+
+	if !ok {
+		h.fail(w, r, http.StatusNotFound, "no api key with such id")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"finPrj/internal/apikeys"
+	"finPrj/internal/auth"
+	"finPrj/internal/robots"
+	sessions "finPrj/internal/sessions"
+	"finPrj/internal/tokens"
+	users "finPrj/internal/users"
+	"net"
+	"net/http"
+	"time"
+)
+
+//authenticate resolves the bearer into a principal and puts it into
+//the request context. Requests without a valid bearer don't get further.
+func (h *Handlers) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("Authorization")
+		if token == "" {
+			h.fail(w, r, http.StatusBadRequest, "token required")
+			return
+		}
+
+		var p *auth.Principal
+		if apikeys.IsAPIKey(token) {
+			p = h.apiKeyPrincipal(w, r, token)
+		} else if h.keys != nil && tokens.LooksSigned(token) {
+			p = h.signedPrincipal(w, r, token)
+		} else {
+			p = h.sessionPrincipal(w, r, token)
+		}
+
+		if p == nil {
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+	})
+}
+
+func (h *Handlers) sessionPrincipal(w http.ResponseWriter, r *http.Request, token string) *auth.Principal {
+	sess, err := h.ss.GetByTokenHash(r.Context(), sessions.HashToken(token))
+	if err != nil {
+		h.internal(w, r, "authenticate:: can't get session by token %s", err)
+		return nil
+	}
+
+	if sess == nil {
+		h.fail(w, r, http.StatusUnauthorized, "sign in first")
+		return nil
+	}
+
+	if sess.ValidUntil.Before(time.Now().UTC()) {
+		h.fail(w, r, http.StatusUnauthorized, "authorization time out")
+		return nil
+	}
+
+	user, err := h.us.GetByID(r.Context(), sess.UserID)
+	if err != nil {
+		h.internal(w, r, "authenticate:: can't get user %s", err)
+		return nil
+	}
+
+	if user == nil {
+		h.fail(w, r, http.StatusUnauthorized, "sign in first")
+		return nil
+	}
+
+	//every authenticated request keeps the session alive
+	//for one more idle period
+	sess.LastSeenAt = time.Now().UTC()
+	h.lifetime.Slide(sess, sess.LastSeenAt)
+	sess.IP = clientIP(r)
+	sess.UserAgent = r.UserAgent()
+	err = h.ss.Touch(r.Context(), sess)
+	if err != nil {
+		h.logger.Sugar().Warnf("authenticate:: can't touch session %s", err)
+	}
+
+	return &auth.Principal{
+		UserID:    sess.UserID,
+		SessionID: sess.SessionID,
+		Role:      user.Role,
+		Scopes:    []string{auth.ScopeAll},
+	}
+}
+
+//signedPrincipal authenticates stateless access tokens
+//without going to the database.
+func (h *Handlers) signedPrincipal(w http.ResponseWriter, r *http.Request, token string) *auth.Principal {
+	claims, err := h.keys.Parse(token, time.Now().UTC())
+	if err == tokens.ErrExpired {
+		h.fail(w, r, http.StatusUnauthorized, "authorization time out")
+		return nil
+	}
+	if err != nil {
+		h.fail(w, r, http.StatusUnauthorized, "invalid token")
+		return nil
+	}
+
+	if h.revoked.IsRevoked(claims.SessionID, claims.Subject, claims.Issued()) {
+		h.fail(w, r, http.StatusUnauthorized, "sign in first")
+		return nil
+	}
+
+	return &auth.Principal{
+		UserID:    claims.Subject,
+		SessionID: claims.SessionID,
+		Role:      claims.Role,
+		Scopes:    []string{auth.ScopeAll},
+	}
+}
+
+func (h *Handlers) apiKeyPrincipal(w http.ResponseWriter, r *http.Request, token string) *auth.Principal {
+	key, err := h.aks.GetByHash(r.Context(), apikeys.Hash(token))
+	if err != nil {
+		h.internal(w, r, "authenticate:: can't get api key %s", err)
+		return nil
+	}
+
+	timeNow := time.Now().UTC()
+	if key == nil || key.Expired(timeNow) {
+		h.fail(w, r, http.StatusUnauthorized, "invalid api key")
+		return nil
+	}
+
+	if !key.AllowsIP(clientIP(r)) {
+		h.fail(w, r, http.StatusForbidden, "api key is not allowed from this address")
+		return nil
+	}
+
+	user, err := h.us.GetByID(r.Context(), key.UserID)
+	if err != nil {
+		h.internal(w, r, "authenticate:: can't get user %s", err)
+		return nil
+	}
+
+	if user == nil {
+		h.fail(w, r, http.StatusUnauthorized, "invalid api key")
+		return nil
+	}
+
+	err = h.aks.Touch(r.Context(), key.KeyID, timeNow)
+	if err != nil {
+		h.logger.Sugar().Warnf("authenticate:: can't touch api key %s", err)
+	}
+
+	return &auth.Principal{
+		UserID:   key.UserID,
+		APIKeyID: key.KeyID,
+		Role:     user.Role,
+		Scopes:   key.Scopes,
+	}
+}
+
+//requireScope lets through principals granted the scope.
+func (h *Handlers) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !auth.FromContext(r.Context()).HasScope(scope) {
+				h.fail(w, r, http.StatusForbidden, "api key lacks scope "+scope)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+//sessionOnly rejects API keys, they can't manage the account.
+func (h *Handlers) sessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromContext(r.Context()).SessionID == "" {
+			h.fail(w, r, http.StatusForbidden, "sign in to manage the account")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+//userOwnerOnly lets through requests of the user whose {id} is in the path.
+func (h *Handlers) userOwnerOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := h.getID(w, r)
+		if err != nil {
+			return
+		}
+
+		if auth.FromContext(r.Context()).UserID != id {
+			h.fail(w, r, http.StatusBadRequest, "access denied")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+//requireRole lets through principals with one of the roles.
+func (h *Handlers) requireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role := auth.FromContext(r.Context()).Role
+			for _, allowed := range roles {
+				if role == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			h.fail(w, r, http.StatusForbidden, "access denied")
+		})
+	}
+}
+
+//writable rejects principals with read-only roles.
+func (h *Handlers) writable(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromContext(r.Context()).Role == users.RoleAuditor {
+			h.fail(w, r, http.StatusForbidden, "read-only account")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+type robotKey struct{}
+
+//robotOwnerOnly lets through requests of the owner of robot {id}
+//and passes the robot on to the handler, see robotFromContext.
+func (h *Handlers) robotOwnerOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		robotID, err := h.getID(w, r)
+		if err != nil {
+			return
+		}
+
+		robot, err := h.rs.GetByRobotID(r.Context(), robotID)
+		if err != nil {
+			h.internal(w, r, "robotOwnerOnly:: can't get robot by id %s", err)
+			return
+		}
+
+		if robot == nil {
+			h.fail(w, r, http.StatusBadRequest, "no robot with such id")
+			return
+		}
+
+		if robot.OwnerUserID != auth.FromContext(r.Context()).UserID {
+			h.fail(w, r, http.StatusBadRequest, "access denied")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), robotKey{}, robot)))
+	})
+}
+
+func robotFromContext(ctx context.Context) *robots.Robot {
+	robot, _ := ctx.Value(robotKey{}).(*robots.Robot)
+	return robot
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"finPrj/internal/apikeys"
+	"finPrj/internal/memory"
+	pg "finPrj/internal/postgres"
+	"finPrj/internal/robots"
+	sessions "finPrj/internal/sessions"
+	"finPrj/internal/sqlite"
+	"finPrj/internal/storage"
+	"finPrj/internal/tokens"
+	users "finPrj/internal/users"
+
+	"github.com/pkg/errors"
+)
+
+//backend is the set of storages -storage selects
+type backend struct {
+	us   users.Storage
+	ss   sessions.Storage
+	rs   robots.Storage
+	aks  apikeys.Storage
+	ids  users.IdentityStorage
+	used tokens.UsedStorage
+	tx   storage.Transactor
+}
+
+func newPostgresBackend(db *pg.DB, roboUpd chan<- *robots.Robot) (*backend, error) {
+	userStorage, err := pg.NewUserStorage(db)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create users storage")
+	}
+	roboStorage, err := pg.NewRobotStorage(db, roboUpd)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create robots storage")
+	}
+	sessStorage, err := pg.NewSessionStorage(db)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create sessions storage")
+	}
+	keyStorage, err := pg.NewAPIKeyStorage(db)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create api keys storage")
+	}
+	usedStorage, err := pg.NewUsedTokenStorage(db)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create used tokens storage")
+	}
+	identityStorage, err := pg.NewIdentityStorage(db)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create identities storage")
+	}
+
+	return &backend{
+		us:   userStorage,
+		ss:   sessStorage,
+		rs:   roboStorage,
+		aks:  keyStorage,
+		ids:  identityStorage,
+		used: usedStorage,
+		tx:   pg.NewTransactor(db, userStorage, identityStorage, sessStorage, roboStorage),
+	}, nil
+}
+
+func newSQLiteBackend(db *sqlite.DB, roboUpd chan<- *robots.Robot) (*backend, error) {
+	userStorage, err := sqlite.NewUserStorage(db)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create users storage")
+	}
+	roboStorage, err := sqlite.NewRobotStorage(db, roboUpd)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create robots storage")
+	}
+	sessStorage, err := sqlite.NewSessionStorage(db)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create sessions storage")
+	}
+	keyStorage, err := sqlite.NewAPIKeyStorage(db)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create api keys storage")
+	}
+	usedStorage, err := sqlite.NewUsedTokenStorage(db)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create used tokens storage")
+	}
+	identityStorage, err := sqlite.NewIdentityStorage(db)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create identities storage")
+	}
+
+	return &backend{
+		us:   userStorage,
+		ss:   sessStorage,
+		rs:   roboStorage,
+		aks:  keyStorage,
+		ids:  identityStorage,
+		used: usedStorage,
+		tx:   sqlite.NewTransactor(db, userStorage, identityStorage, sessStorage, roboStorage),
+	}, nil
+}
+
+//newMemoryBackend keeps everything in the process, nothing
+//survives a restart. It is meant for demos and tests.
+func newMemoryBackend(roboUpd chan<- *robots.Robot) *backend {
+	userStorage := memory.NewUserStorage()
+	sessStorage := memory.NewSessionStorage()
+	roboStorage := memory.NewRobotStorage(roboUpd)
+	identityStorage := memory.NewIdentityStorage()
+
+	return &backend{
+		us:   userStorage,
+		ss:   sessStorage,
+		rs:   roboStorage,
+		aks:  memory.NewAPIKeyStorage(),
+		ids:  identityStorage,
+		used: memory.NewUsedTokenStorage(),
+		tx:   memory.NewTransactor(userStorage, identityStorage, sessStorage, roboStorage),
+	}
+}
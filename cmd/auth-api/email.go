@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"finPrj/internal/auth"
+	"finPrj/internal/mailer"
+	sessions "finPrj/internal/sessions"
+	"finPrj/internal/tokens"
+	users "finPrj/internal/users"
+	"finPrj/internal/validation"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	purposeVerifyEmail   = "verify-email"
+	purposeResetPassword = "reset-password"
+	verifyEmailTTL       = 24 * time.Hour
+	resetPasswordTTL     = time.Hour
+)
+
+type emailTokenRequest struct {
+	Token    string `json:"token"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+//newEmailToken signs a single-use token for the user, see useEmailToken.
+func (h *Handlers) newEmailToken(user *users.User, purpose string, ttl time.Duration) (string, error) {
+	id, err := sessions.NewID()
+	if err != nil {
+		return "", err
+	}
+
+	timeNow := time.Now().UTC()
+	return h.signer.Sign(tokens.Claims{
+		Subject:   user.ID,
+		Purpose:   purpose,
+		ID:        id,
+		Email:     user.Email,
+		IssuedAt:  timeNow.Unix(),
+		ExpiresAt: timeNow.Add(ttl).Unix(),
+	})
+}
+
+//useEmailToken returns the user of a valid token and burns the token.
+//The user is nil if the token is invalid, expired or used, or if the
+//email changed since the token was sent.
+func (h *Handlers) useEmailToken(ctx context.Context, token, purpose string) (*users.User, error) {
+	claims, err := h.signer.ParseFor(token, purpose, time.Now().UTC())
+	if err != nil || claims.ID == "" {
+		return nil, nil
+	}
+
+	user, err := h.us.GetByID(ctx, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil || user.Email != claims.Email {
+		return nil, nil
+	}
+
+	ok, err := h.used.Use(ctx, claims.ID, time.Unix(claims.ExpiresAt, 0).UTC())
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (h *Handlers) sendVerification(user *users.User) error {
+	token, err := h.newEmailToken(user, purposeVerifyEmail, verifyEmailTTL)
+	if err != nil {
+		return errors.Wrap(err, "can't sign token")
+	}
+
+	return h.mail.Send(&mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email",
+		Body: "Open the link to confirm your email:\n\n" +
+			h.publicURL + "/api/v1/verify-email?token=" + url.QueryEscape(token) + "\n\n" +
+			"The link is valid for 24 hours.\n",
+	})
+}
+
+//VerifyEmail takes the token from the link in the mail
+//or as {"token"} in the body.
+func (h *Handlers) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	request := emailTokenRequest{Token: r.URL.Query().Get("token")}
+	if r.Method == http.MethodPost {
+		if !h.decodeJSON(w, r, &request, "VerifyEmail") {
+			return
+		}
+	}
+
+	user, err := h.useEmailToken(r.Context(), request.Token, purposeVerifyEmail)
+	if err != nil {
+		h.internal(w, r, "VerifyEmail:: can't check token %s", err)
+		return
+	}
+
+	if user == nil {
+		h.fail(w, r, http.StatusBadRequest, "invalid or expired token")
+		return
+	}
+
+	if user.EmailVerifiedAt == nil {
+		timeNow := time.Now().UTC()
+		_, err = h.changeUser(r.Context(), user.ID, func(user *users.User) error {
+			if user.EmailVerifiedAt == nil {
+				user.EmailVerifiedAt = &timeNow
+			}
+			return nil
+		})
+		if err != nil {
+			h.internal(w, r, "VerifyEmail:: can't update user %s", err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handlers) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	user, err := h.us.GetByID(r.Context(), auth.FromContext(r.Context()).UserID)
+	if err != nil {
+		h.internal(w, r, "ResendVerification:: can't get user %s", err)
+		return
+	}
+
+	if user == nil {
+		h.fail(w, r, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	if user.EmailVerifiedAt != nil {
+		h.fail(w, r, http.StatusConflict, "email is already verified")
+		return
+	}
+
+	err = h.sendVerification(user)
+	if err != nil {
+		h.internal(w, r, "ResendVerification:: %s", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+//ForgotPassword answers the same way whether the email is
+//registered or not, so it can't be used to look up accounts.
+func (h *Handlers) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	request := emailTokenRequest{}
+	if !h.decodeJSON(w, r, &request, "ForgotPassword") {
+		return
+	}
+
+	user, err := h.us.GetByEmail(r.Context(), request.Email)
+	if err != nil {
+		h.internal(w, r, "ForgotPassword:: can't getByEmail %s", err)
+		return
+	}
+
+	if user != nil {
+		token, err := h.newEmailToken(user, purposeResetPassword, resetPasswordTTL)
+		if err == nil {
+			err = h.mail.Send(&mailer.Message{
+				To:      user.Email,
+				Subject: "Reset your password",
+				Body: "Someone asked to reset the password of your account. " +
+					"If it wasn't you, ignore this mail.\n\n" +
+					"To set a new password, POST it with this token to " +
+					h.publicURL + "/api/v1/password/reset:\n\n" + token + "\n\n" +
+					"The token is valid for 1 hour.\n",
+			})
+		}
+		if err != nil {
+			h.logger.Sugar().Errorf("ForgotPassword:: can't send reset mail %s", err)
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+//ResetPassword sets a new password and signs the user out everywhere.
+func (h *Handlers) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	request := emailTokenRequest{}
+	if !h.decodeJSON(w, r, &request, "ResetPassword") {
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+
+	//checked before the token is burned
+	errs := validation.Errors{}
+	errs.Password("password", request.Password, "")
+	if errs.Err() != nil {
+		h.invalid(w, r, errs)
+		return
+	}
+
+	user, err := h.useEmailToken(r.Context(), request.Token, purposeResetPassword)
+	if err != nil {
+		h.internal(w, r, "ResetPassword:: can't check token %s", err)
+		return
+	}
+
+	if user == nil {
+		h.fail(w, r, http.StatusBadRequest, "invalid or expired token")
+		return
+	}
+
+	hash, err := h.pm.Hash(request.Password)
+	if err != nil {
+		h.internal(w, r, "ResetPassword:: can't hash password %s", err)
+		return
+	}
+
+	timeNow := time.Now().UTC()
+	_, err = h.changeUser(r.Context(), user.ID, func(user *users.User) error {
+		user.Password = hash
+		//the mail reached the owner, so the address is verified too
+		if user.EmailVerifiedAt == nil {
+			user.EmailVerifiedAt = &timeNow
+		}
+		return nil
+	})
+	if err != nil {
+		h.internal(w, r, "ResetPassword:: can't update user %s", err)
+		return
+	}
+
+	err = h.revokeUserSessions(r.Context(), user.ID)
+	if err != nil {
+		h.internal(w, r, "ResetPassword:: %s", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/pkg/errors"
+)
+
+//Problem is the one error model of the API. It is rendered as
+//RFC 7807 application/problem+json, or with the error template
+//for browsers. Code is stable, clients should match on it.
+type Problem struct {
+	Type      string      `json:"type"`
+	Title     string      `json:"title"`
+	Status    int         `json:"status"`
+	Detail    string      `json:"detail,omitempty"`
+	Instance  string      `json:"instance,omitempty"`
+	Code      string      `json:"code"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+const (
+	codeBadRequest    = "bad_request"
+	codeMalformed     = "malformed_json"
+	codeUnauthorized  = "unauthorized"
+	codeForbidden     = "forbidden"
+	codeNotFound      = "not_found"
+	codeConflict      = "conflict"
+	codeValidation    = "validation_failed"
+	codeThrottled     = "too_many_requests"
+	codeInternal      = "internal_error"
+	codeUpstream      = "upstream_error"
+	codeTimeout       = "timeout"
+	codeNotAcceptable = "not_acceptable"
+)
+
+//codes of problems that don't name one
+var statusCodes = map[int]string{
+	http.StatusBadRequest:          codeBadRequest,
+	http.StatusUnauthorized:        codeUnauthorized,
+	http.StatusForbidden:           codeForbidden,
+	http.StatusNotFound:            codeNotFound,
+	http.StatusNotAcceptable:       codeNotAcceptable,
+	http.StatusConflict:            codeConflict,
+	http.StatusUnprocessableEntity: codeValidation,
+	http.StatusTooManyRequests:     codeThrottled,
+	http.StatusInternalServerError: codeInternal,
+	http.StatusBadGateway:          codeUpstream,
+	http.StatusGatewayTimeout:      codeTimeout,
+}
+
+//fail answers with a problem of the status' default code.
+func (h *Handlers) fail(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	h.problem(w, r, &Problem{Status: status, Detail: msg})
+}
+
+//internal logs the cause and answers 500, the cause is not shown to clients.
+//Storage calls that ran out of time answer 504, nothing is answered
+//to clients that are gone.
+func (h *Handlers) internal(w http.ResponseWriter, r *http.Request, format string, args ...interface{}) {
+	if r.Context().Err() != nil {
+		h.logger.Sugar().Debugf(format, args...)
+		return
+	}
+
+	for _, arg := range args {
+		if err, ok := arg.(error); ok && errors.Cause(err) == context.DeadlineExceeded {
+			h.logger.Sugar().Warnf(format, args...)
+			h.fail(w, r, http.StatusGatewayTimeout, "the request took too long")
+			return
+		}
+	}
+
+	h.logger.Sugar().Errorf(format, args...)
+	h.fail(w, r, http.StatusInternalServerError, "internal error")
+}
+
+func (h *Handlers) problem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Code == "" {
+		p.Code = statusCodes[p.Status]
+	}
+	if p.Code == "" {
+		p.Code = strings.ToLower(strings.Replace(http.StatusText(p.Status), " ", "_", -1))
+	}
+	p.Type = "/problems/" + p.Code
+	p.Title = http.StatusText(p.Status)
+	p.Instance = r.URL.Path
+	p.RequestID = middleware.GetReqID(r.Context())
+
+	//errors are never 406, whatever is not HTML gets problem+json
+	var err error
+	if negotiate(r.Header.Get("Accept"), mimeProblem, mimeJSON, mimeHTML) == mimeHTML {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(p.Status)
+		err = templates["error"].Execute(w, p)
+	} else {
+		w.Header().Set("Content-Type", mimeProblem)
+		w.WriteHeader(p.Status)
+		err = json.NewEncoder(w).Encode(p)
+	}
+
+	if err != nil {
+		h.logger.Sugar().Warnf("problem:: can't write %s %s", p.Code, err)
+	}
+}
+
+//requestID echoes the id set by middleware.RequestID,
+//so clients can quote it when reporting errors.
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(middleware.RequestIDHeader, middleware.GetReqID(r.Context()))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,19 +1,29 @@
 package main
 
 import (
-	"encoding/base32"
+	"context"
 	"encoding/json"
-	pg "finPrj/internal/postgres"
+	"finPrj/internal/apikeys"
+	"finPrj/internal/auth"
+	"finPrj/internal/mailer"
+	"finPrj/internal/oidc"
+	"finPrj/internal/passwords"
 	"finPrj/internal/robots"
 	srvc "finPrj/internal/services"
 	sessions "finPrj/internal/sessions"
+	"finPrj/internal/storage"
+	"finPrj/internal/throttle"
+	"finPrj/internal/tokens"
 	users "finPrj/internal/users"
+	"finPrj/internal/validation"
 	"net/http"
 	"strconv"
 	"text/template"
 	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
@@ -43,444 +53,528 @@ func init() {
 
 type Handlers struct {
 	logger *zap.Logger
-	us     *pg.UserStorage
-	ss     *pg.SessionStorage
-	rs     *pg.RobotStorage
+	us     users.Storage
+	ss     sessions.Storage
+	rs     robots.Storage
 	rp     *srvc.RobotsPatch
+	pm     *passwords.Manager
+	lim    *throttle.Limiter
+
+	lifetime sessions.Lifetime
+	keys     *tokens.KeySet //nil unless signed access tokens are enabled
+	signer   *tokens.KeySet //signs short-lived challenges, always set
+	revoked  *sessions.RevocationList
+	aks      apikeys.Storage
+
+	mail      mailer.Mailer
+	used      tokens.UsedStorage
+	publicURL string //links in emails point here
+
+	providers map[string]*oidc.Provider
+	ids       users.IdentityStorage
+
+	tx storage.Transactor //runs changes of several storages in one transaction
 }
 
-func NewHandlers(logger *zap.Logger, us *pg.UserStorage, ss *pg.SessionStorage,
-	rs *pg.RobotStorage, rp *srvc.RobotsPatch) *Handlers {
+func NewHandlers(logger *zap.Logger, us users.Storage, ss sessions.Storage,
+	rs robots.Storage, rp *srvc.RobotsPatch, pm *passwords.Manager, lim *throttle.Limiter,
+	lifetime sessions.Lifetime, keys *tokens.KeySet, signer *tokens.KeySet,
+	revoked *sessions.RevocationList, aks apikeys.Storage, mail mailer.Mailer,
+	used tokens.UsedStorage, publicURL string, providers map[string]*oidc.Provider,
+	ids users.IdentityStorage, tx storage.Transactor) *Handlers {
 	return &Handlers{
-		logger: logger,
-		us:     us,
-		ss:     ss,
-		rs:     rs,
-		rp:     rp,
+		logger:   logger,
+		us:       us,
+		ss:       ss,
+		rs:       rs,
+		rp:       rp,
+		pm:       pm,
+		lim:      lim,
+		lifetime: lifetime,
+		keys:     keys,
+		signer:   signer,
+		revoked:  revoked,
+		aks:      aks,
+
+		mail:      mail,
+		used:      used,
+		publicURL: publicURL,
+		providers: providers,
+		ids:       ids,
+
+		tx: tx,
 	}
 }
+
+//Router declares every route as public, authenticated
+//or owner-only. Routes outside of the public block can't be
+//reached without a valid bearer.
 func (h *Handlers) Router() chi.Router {
 	r := chi.NewRouter()
+	r.Use(middleware.RequestID, requestID)
+
+	//public
 	r.Post("/api/v1/signup", h.SignUp)
 	r.Post("/api/v1/signin", h.SignIn)
-	r.Put("/api/v1/users/{id}", h.PutUser)
-	r.Get("/api/v1/users/{id}", h.GetUser)
-	r.Get("/user/{id}/robots", h.UserRobots)
-	r.Post("/robot", h.PostRobot)
-	r.Get("/robots", h.Robots)
-	r.Delete("/robot/{id}", h.DeleteRobot)
-	r.Get("/robot/{id}", h.RobotWithID)
-	r.Put("/robot/{id}", h.UpdateRobot)
-	r.Put("/robot/{id}/activate", h.ActivateRobot)
-	r.Put("/robot/{id}/deactivate", h.DeactivateRobot)
-	r.Put("/robot/{id}/favourite", h.FavourRobot)
+	r.Post("/api/v1/signin/totp", h.SignInTOTP)
+	r.Post("/api/v1/token/refresh", h.RefreshToken)
+	r.Get("/api/v1/verify-email", h.VerifyEmail)
+	r.Post("/api/v1/verify-email", h.VerifyEmail)
+	r.Post("/api/v1/password/forgot", h.ForgotPassword)
+	r.Post("/api/v1/password/reset", h.ResetPassword)
+	r.Get("/api/v1/oauth/{provider}/start", h.OAuthStart)
+	r.Get("/api/v1/oauth/{provider}/callback", h.OAuthCallback)
 	r.Get("/wsrobots", h.rp.PrepareSocket)
+
+	r.Group(func(r chi.Router) {
+		r.Use(h.authenticate)
+
+		//robots can be reached with API keys of the right scope
+		r.Group(func(r chi.Router) {
+			r.Use(h.requireScope(auth.ScopeRobotsRead))
+
+			r.Get("/robots", h.Robots)
+			r.Get("/robots/search", h.SearchRobots)
+			r.Get("/robot/{id}", h.RobotWithID)
+			r.With(h.userOwnerOnly).Get("/user/{id}/robots", h.UserRobots)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(h.writable, h.requireScope(auth.ScopeRobotsWrite))
+
+			r.Post("/robot", h.PostRobot)
+			r.Put("/robot/{id}/favourite", h.FavourRobot)
+		})
+
+		//{id} is a robot of the signed in user
+		r.Group(func(r chi.Router) {
+			r.Use(h.writable, h.robotOwnerOnly)
+
+			r.With(h.requireScope(auth.ScopeRobotsWrite)).Delete("/robot/{id}", h.DeleteRobot)
+			r.With(h.requireScope(auth.ScopeRobotsWrite)).Put("/robot/{id}", h.UpdateRobot)
+			r.With(h.requireScope(auth.ScopeRobotsActivate)).Put("/robot/{id}/activate", h.ActivateRobot)
+			r.With(h.requireScope(auth.ScopeRobotsActivate)).Put("/robot/{id}/deactivate", h.DeactivateRobot)
+		})
+
+		//the account is managed only with a session
+		r.Group(func(r chi.Router) {
+			r.Use(h.sessionOnly)
+
+			r.Post("/api/v1/signout", h.SignOut)
+			r.Post("/api/v1/signout/all", h.SignOutAll)
+			r.Delete("/api/v1/sessions/{sid}", h.DeleteSession)
+
+			//{id} is the id of the signed in user
+			r.Group(func(r chi.Router) {
+				r.Use(h.userOwnerOnly)
+
+				r.With(h.writable).Put("/api/v1/users/{id}", h.PutUser)
+				r.Get("/api/v1/users/{id}", h.GetUser)
+				r.Get("/api/v1/users/{id}/sessions", h.UserSessions)
+				r.Get("/api/v1/users/{id}/identities", h.Identities)
+				r.Post("/api/v1/users/{id}/verify-email", h.ResendVerification)
+				r.Get("/api/v1/users/{id}/apikeys", h.APIKeys)
+				r.Post("/api/v1/users/{id}/apikeys", h.CreateAPIKey)
+				r.Delete("/api/v1/users/{id}/apikeys/{kid}", h.DeleteAPIKey)
+				r.With(h.writable).Post("/api/v1/users/{id}/totp", h.EnrollTOTP)
+				r.With(h.writable).Post("/api/v1/users/{id}/totp/confirm", h.ConfirmTOTP)
+				r.With(h.writable).Delete("/api/v1/users/{id}/totp", h.DisableTOTP)
+			})
+
+			r.Route("/api/v1/admin", func(r chi.Router) {
+				r.Use(h.requireRole(users.RoleAdmin, users.RoleAuditor))
+
+				r.Get("/users", h.AdminUsers)
+
+				r.Group(func(r chi.Router) {
+					r.Use(h.requireRole(users.RoleAdmin))
+
+					r.Put("/users/{id}/role", h.AdminSetRole)
+					r.Delete("/users/{id}/sessions", h.AdminRevokeSessions)
+					r.Put("/robots/{id}/deactivate", h.AdminDeactivateRobot)
+				})
+			})
+		})
+	})
+
 	return r
 }
 
 func (h *Handlers) SignUp(w http.ResponseWriter, r *http.Request) {
 	user := &users.User{}
-	err := json.NewDecoder(r.Body).Decode(user)
+	if !h.decodeJSON(w, r, user, "SignUp") {
+		return
+	}
+
+	err := validation.User(user, true)
 	if err != nil {
-		h.logger.Sugar().Errorf("SignUp:: can't read user from Body %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		h.invalid(w, r, err)
 		return
 	}
 
-	checkUser, err := h.us.GetByEmail(user.Email)
+	checkUser, err := h.us.GetByEmail(r.Context(), user.Email)
 	if err != nil {
-		h.logger.Sugar().Errorf("SignUp:: can't getByEmail %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		h.internal(w, r, "SignUp:: can't getByEmail %s", err)
 		return
 	}
 
 	w.Header().Add("Content-Type", "application/json")
 
 	if checkUser != nil {
-		w.WriteHeader(http.StatusConflict)
-		err := json.NewEncoder(w).Encode(map[string]string{"error": "user " + user.Email + " is already registered"})
-		if err != nil {
-			h.logger.Sugar().Warnf("SignUp:: can't parse json error %s", err)
-		}
+		h.fail(w, r, http.StatusConflict, "user "+user.Email+" is already registered")
 		return
 	}
 
-	nextID, err := h.us.NextID()
+	user.Password, err = h.pm.Hash(user.Password)
 	if err != nil {
-		h.logger.Sugar().Errorf("SignUp:: can't get nextID %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		h.internal(w, r, "SignUp:: can't hash password %s", err)
 		return
 	}
-
-	user.ID = nextID
-	user.Password = base32.StdEncoding.EncodeToString([]byte(user.Password))
+	user.Role = users.RoleUser
 	user.CreatedAt = time.Now().UTC()
 	user.UpdatedAt = time.Now().UTC()
 
-	err = h.us.Create(user)
+	err = h.us.Create(r.Context(), user)
+	if err == users.ErrEmailTaken {
+		h.fail(w, r, http.StatusConflict, "user "+user.Email+" is already registered")
+		return
+	}
 	if err != nil {
-		h.logger.Sugar().Errorf("SignUp:: can't create user %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		h.internal(w, r, "SignUp:: can't create user %s", err)
 		return
 	}
 
+	//the user can ask for another mail if this one is lost
+	err = h.sendVerification(user)
+	if err != nil {
+		h.logger.Sugar().Warnf("SignUp:: can't send verification %s", err)
+	}
+
 	w.WriteHeader(http.StatusCreated)
 }
 
 func (h *Handlers) SignIn(w http.ResponseWriter, r *http.Request) {
 	request := map[string]string{}
 
-	err := json.NewDecoder(r.Body).Decode(&request)
-	if err != nil {
-		h.logger.Sugar().Errorf("SignIn:: can't parse json %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
+	if !h.decodeJSON(w, r, &request, "SignIn") {
 		return
 	}
 
-	checkUser, err := h.us.GetByEmail(request["email"])
-	if err != nil {
-		h.logger.Sugar().Errorf("SignIn:: can't getByEmail %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
+	w.Header().Add("Content-Type", "application/json")
+
+	if !h.allowSignIn(w, r, request["email"], "SignIn") {
 		return
 	}
 
-	w.Header().Add("Content-Type", "application/json")
+	checkUser, err := h.us.GetByEmail(r.Context(), request["email"])
+	if err != nil {
+		h.internal(w, r, "SignIn:: can't getByEmail %s", err)
+		return
+	}
 
+	//unknown emails and wrong passwords look the same,
+	//both in the answer and in the time it takes
+	ok, rehash := false, false
 	if checkUser == nil {
-		w.WriteHeader(http.StatusBadRequest)
-		err := json.NewEncoder(w).Encode(map[string]string{"error": "no user with such email"})
+		h.pm.VerifyDummy(request["password"])
+	} else {
+		ok, rehash, err = h.pm.Verify(checkUser.Password, request["password"])
 		if err != nil {
-			h.logger.Sugar().Warnf("SignIn:: can't parse json error %s", err)
+			h.internal(w, r, "SignIn:: can't verify password %s", err)
+			return
 		}
+	}
+
+	if !ok {
+		h.fail(w, r, http.StatusBadRequest, "wrong email or password")
 		return
 	}
 
-	hashedPswd := base32.StdEncoding.EncodeToString([]byte(request["password"]))
-	if checkUser.Password != hashedPswd {
-		w.WriteHeader(http.StatusBadRequest)
-		err := json.NewEncoder(w).Encode(map[string]string{"error": "wrong password"})
+	//passwords stored with an old algorithm or old cost
+	//are upgraded while we still know the plain text
+	if rehash {
+		var hash string
+		hash, err = h.pm.Hash(request["password"])
+		if err == nil {
+			//a password changed meanwhile is kept
+			old := checkUser.Password
+			_, err = h.changeUser(r.Context(), checkUser.ID, func(user *users.User) error {
+				if user.Password == old {
+					user.Password = hash
+				}
+				return nil
+			})
+		}
 		if err != nil {
-			h.logger.Sugar().Warnf("SignIn:: can't parse json error %s", err)
+			h.logger.Sugar().Warnf("SignIn:: can't rehash password %s", err)
+		}
+	}
+
+	//the password is right but the session is given
+	//only for the second factor, see SignInTOTP.
+	//Attempts are reset only when it is checked too.
+	if checkUser.TOTPEnabledAt != nil {
+		h.signInPassed(r, request["email"], "SignIn")
+
+		challenge, err := h.newTOTPChallenge(checkUser)
+		if err != nil {
+			h.internal(w, r, "SignIn:: can't create totp challenge %s", err)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(challenge)
+		if err != nil {
+			h.logger.Sugar().Warnf("SignIn:: can't parse totp challenge %s", err)
 		}
 		return
 	}
 
-	base := []byte(request["email"] + request["password"])
-	session := sessions.Session{
-		SessionID:  base32.StdEncoding.EncodeToString(base),
-		UserID:     checkUser.ID,
-		CreatedAt:  time.Now().UTC(),
-		ValidUntil: time.Now().UTC().Add(30 * time.Minute),
+	h.signInSucceeded(r, request["email"], "SignIn")
+
+	sessTokens, err := h.startSession(r, checkUser)
+	if err != nil {
+		h.internal(w, r, "SignIn:: can't start session %s", err)
+		return
 	}
 
-	err = h.ss.DeleteByUserID(session.UserID)
+	err = json.NewEncoder(w).Encode(sessTokens)
 	if err != nil {
-		h.logger.Sugar().Errorf("SignIn:: can't delete old session%s", err)
+		h.logger.Sugar().Warnf("SignIn:: can't parse tokens %s", err)
 	}
+}
 
-	err = h.ss.Create(&session)
+//SignOut revokes the session the request was made with.
+func (h *Handlers) SignOut(w http.ResponseWriter, r *http.Request) {
+	p := auth.FromContext(r.Context())
+	err := h.revokeSession(r.Context(), &sessions.Session{SessionID: p.SessionID, UserID: p.UserID})
 	if err != nil {
-		h.logger.Sugar().Errorf("SignIn:: can't create session %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		h.internal(w, r, "SignOut:: %s", err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]string{"bearer": session.SessionID})
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *Handlers) PutUser(w http.ResponseWriter, r *http.Request) {
+//SignOutAll revokes every session of the user, including the current one.
+func (h *Handlers) SignOutAll(w http.ResponseWriter, r *http.Request) {
+	userID := auth.FromContext(r.Context()).UserID
+
+	err := h.revokeUserSessions(r.Context(), userID)
+	if err != nil {
+		h.internal(w, r, "SignOutAll:: %s", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handlers) UserSessions(w http.ResponseWriter, r *http.Request) {
 	id, err := h.getID(w, r)
 	if err != nil {
 		return
 	}
 
-	user, err := h.us.GetByID(id)
+	sessList, err := h.ss.ListByUserID(r.Context(), id)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Errorf("PutUser:: can't get user by id %s", err)
+		h.internal(w, r, "UserSessions:: can't list sessions %s", err)
 		return
 	}
 
 	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(sessList)
+	if err != nil {
+		h.logger.Sugar().Warnf("UserSessions:: can't parse sessions %s", err)
+	}
+}
 
-	if user == nil {
-		w.WriteHeader(http.StatusBadRequest)
-		err := json.NewEncoder(w).Encode(map[string]string{"error": "no user with such id"})
-		if err != nil {
-			h.logger.Sugar().Warnf("PutUser:: can't parse error %s", err)
-		}
+//DeleteSession revokes one of the user's sessions, e.g. a lost laptop.
+func (h *Handlers) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	userID := auth.FromContext(r.Context()).UserID
+
+	sess, err := h.ss.GetBySessionID(r.Context(), chi.URLParam(r, "sid"))
+	if err != nil {
+		h.internal(w, r, "DeleteSession:: can't get session %s", err)
 		return
 	}
 
-	status := h.checkAuth(w, r, id)
-	if !status {
+	//other users' sessions are reported as missing, not as forbidden
+	if sess == nil || sess.UserID != userID {
+		h.fail(w, r, http.StatusNotFound, "no session with such id")
 		return
 	}
 
-	user2 := users.User{}
-	err = json.NewDecoder(r.Body).Decode(&user2)
+	err = h.revokeSession(r.Context(), sess)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Warnf("PutUser:: can't parse user from request %s", err)
+		h.internal(w, r, "DeleteSession:: %s", err)
 		return
 	}
 
-	if user2.Email != user.Email {
-		checkUser, err := h.us.GetByEmail(user.Email)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//errNoUser ends a transaction that didn't find its user
+var errNoUser = errors.New("no user with such id")
+
+//changeUser applies change to the user as it is in a transaction and
+//stores it, so concurrent changes of other fields aren't lost. The user
+//is read again on every attempt, change must only set its fields.
+func (h *Handlers) changeUser(ctx context.Context, id int64, change func(user *users.User) error) (*users.User, error) {
+	var user *users.User
+	err := h.tx.InTx(ctx, func(tx storage.Tx) error {
+		us := tx.Users()
+		var err error
+		user, err = us.GetByID(ctx, id)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			h.logger.Sugar().Errorf("PutUser:: can't get user by email %s", err)
-			return
+			return err
+		}
+		if user == nil {
+			return errNoUser
 		}
 
-		if checkUser != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			err := json.NewEncoder(w).Encode(map[string]string{"error": "user with such email already exist"})
-			if err != nil {
-				h.logger.Sugar().Warnf("PutUser:: can't parse error %s", err)
-			}
-			return
+		err = change(user)
+		if err != nil {
+			return err
 		}
-	}
 
-	user2.UpdatedAt = time.Now().UTC()
-	user2.CreatedAt = user.CreatedAt
-	err = h.us.UpdateUser(&user2)
+		return us.UpdateUser(ctx, user)
+	})
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Errorf("PutUser:: can't update user %s", err)
-		return
+		return nil, err
 	}
 
-	err = json.NewEncoder(w).Encode(user2)
-	if err != nil {
-		h.logger.Sugar().Warnf("PutUser:: can't parse user as answer %s", err)
-	}
+	return user, nil
 }
 
-func (h *Handlers) GetUser(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) PutUser(w http.ResponseWriter, r *http.Request) {
 	id, err := h.getID(w, r)
 	if err != nil {
 		return
 	}
 
-	user, err := h.us.GetByID(id)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Errorf("GetUser:: can't get user by id %s", err)
-		return
-	}
-
 	w.Header().Add("Content-Type", "application/json")
 
-	if user == nil {
-		w.WriteHeader(http.StatusBadRequest)
-		err := json.NewEncoder(w).Encode(map[string]string{"error": "no user with such id"})
-		if err != nil {
-			h.logger.Sugar().Warnf("GetUser:: can't parse error %s", err)
-		}
+	request := users.User{}
+	if !h.decodeJSON(w, r, &request, "PutUser") {
 		return
 	}
 
-	status := h.checkAuth(w, r, id)
-	if !status {
-		return
-	}
-
-	err = json.NewEncoder(w).Encode(user)
+	err = validation.User(&request, false)
 	if err != nil {
-		h.logger.Sugar().Warnf("PutUser:: can't parse user as answer %s", err)
-	}
-}
-
-func (h *Handlers) checkAuth(w http.ResponseWriter, r *http.Request, userID int64) bool {
-	var token string
-	var err error
-	if len(r.Header["Authorization"]) != 0 {
-		token = r.Header["Authorization"][0]
-	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		if r.Header["Accept"][0] == "application/json" {
-			w.Header().Add("Content-Type", "application/json")
-			err = json.NewEncoder(w).Encode(map[string]string{"error": "token required"})
-		} else {
-			w.Header().Add("Content-Type", "text/html")
-			err = templates["error"].Execute(w, "token required")
-		}
-		if err != nil {
-			h.logger.Sugar().Warnf("checkAuth:: can't parse error %s", err)
-		}
-		return false
-	}
-
-	sess, err := h.ss.GetByUserID(userID)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Errorf("checkAuth:: can't get session by id %s", err)
-		return false
+		h.invalid(w, r, err)
+		return
 	}
 
-	if sess == nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		if r.Header["Accept"][0] == "application/json" {
-			w.Header().Add("Content-Type", "application/json")
-			err = json.NewEncoder(w).Encode(map[string]string{"error": "sign in first"})
-		} else {
-			w.Header().Add("Content-Type", "text/html")
-			err = templates["error"].Execute(w, "sign in first")
-		}
+	//hashed once, not on every attempt of the transaction
+	hash := ""
+	if request.Password != "" {
+		hash, err = h.pm.Hash(request.Password)
 		if err != nil {
-			h.logger.Sugar().Warnf("checkAuth:: can't parse error %s", err)
+			h.internal(w, r, "PutUser:: can't hash password %s", err)
+			return
 		}
-		return false
 	}
 
-	if sess.SessionID != token {
-		w.WriteHeader(http.StatusBadRequest)
-		if r.Header["Accept"][0] == "application/json" {
-			w.Header().Add("Content-Type", "application/json")
-			err = json.NewEncoder(w).Encode(map[string]string{"error": "access denied"})
-		} else {
-			w.Header().Add("Content-Type", "text/html")
-			err = templates["error"].Execute(w, "access denied")
-		}
-
+	//the email check and the update see the same state,
+	//the user is read again on every attempt
+	var user, user2 users.User
+	err = h.tx.InTx(r.Context(), func(tx storage.Tx) error {
+		us := tx.Users()
+		stored, err := us.GetByID(r.Context(), id)
 		if err != nil {
-			h.logger.Sugar().Warnf("checkAuth:: can't parse error %s", err)
+			return err
 		}
-		return false
-	}
-
-	if sess.ValidUntil.Before(time.Now().UTC()) {
-		w.WriteHeader(http.StatusUnauthorized)
-		if r.Header["Accept"][0] == "application/json" {
-			w.Header().Add("Content-Type", "application/json")
-			err = json.NewEncoder(w).Encode(map[string]string{"error": "authorization time out"})
-		} else {
-			w.Header().Add("Content-Type", "text/html")
-			err = templates["error"].Execute(w, "authorization time out")
+		if stored == nil {
+			return errNoUser
 		}
+		user, user2 = *stored, request
 
-		if err != nil {
-			h.logger.Sugar().Warnf("checkAuth:: can't parse error %s", err)
+		if user2.Email != user.Email {
+			checkUser, err := us.GetByEmail(r.Context(), user2.Email)
+			if err != nil {
+				return err
+			}
+			if checkUser != nil {
+				return users.ErrEmailTaken
+			}
 		}
-		return false
-	}
-	return true
-}
 
-func (h *Handlers) checkAuthByToken(w http.ResponseWriter, r *http.Request) int64 {
-	var token string
-	var err error
-	if len(r.Header["Authorization"]) != 0 {
-		token = r.Header["Authorization"][0]
-	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		if r.Header["Accept"][0] == "application/json" {
-			w.Header().Add("Content-Type", "application/json")
-			err = json.NewEncoder(w).Encode(map[string]string{"error": "token required"})
-		} else {
-			w.Header().Add("Content-Type", "text/html")
-			err = templates["error"].Execute(w, "token required")
+		user2.Password = user.Password
+		if hash != "" {
+			user2.Password = hash
 		}
 
-		if err != nil {
-			h.logger.Sugar().Warnf("checkAuthByToken:: can't parse error %s", err)
+		//fields users can't change themselves
+		user2.ID = user.ID
+		user2.Role = user.Role
+		user2.TOTPSecret = user.TOTPSecret
+		user2.TOTPEnabledAt = user.TOTPEnabledAt
+		user2.TOTPCounter = user.TOTPCounter
+		if user2.Email == user.Email {
+			user2.EmailVerifiedAt = user.EmailVerifiedAt
 		}
-		return -1
-	}
+		user2.UpdatedAt = time.Now().UTC()
+		user2.CreatedAt = user.CreatedAt
 
-	sess, err := h.ss.GetByBearer(token)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Errorf("checkAuthByToken:: can't get session by id %s", err)
-		return -1
+		return us.UpdateUser(r.Context(), &user2)
+	})
+	switch {
+	case err == errNoUser:
+		h.fail(w, r, http.StatusBadRequest, err.Error())
+		return
+	case err == users.ErrEmailTaken:
+		h.fail(w, r, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		h.internal(w, r, "PutUser:: can't update user %s", err)
+		return
 	}
 
-	if sess == nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		if r.Header["Accept"][0] == "application/json" {
-			w.Header().Add("Content-Type", "application/json")
-			err = json.NewEncoder(w).Encode(map[string]string{"error": "sign in first"})
-		} else {
-			w.Header().Add("Content-Type", "text/html")
-			err = templates["error"].Execute(w, "sign in first")
-		}
-
+	if user2.EmailVerifiedAt == nil && user2.Email != user.Email {
+		err = h.sendVerification(&user2)
 		if err != nil {
-			h.logger.Sugar().Warnf("checkAuthByToken:: can't parse error %s", err)
+			h.logger.Sugar().Warnf("PutUser:: can't send verification %s", err)
 		}
-		return -1
 	}
 
-	if sess.ValidUntil.Before(time.Now().UTC()) {
-		w.WriteHeader(http.StatusUnauthorized)
-		if r.Header["Accept"][0] == "application/json" {
-			w.Header().Add("Content-Type", "application/json")
-			err = json.NewEncoder(w).Encode(map[string]string{"error": "authorization time out"})
-		} else {
-			w.Header().Add("Content-Type", "text/html")
-			err = templates["error"].Execute(w, "authorization time out")
-		}
-
-		if err != nil {
-			h.logger.Sugar().Warnf("checkAuthByToken:: can't parse error %s", err)
-		}
-		return -1
+	err = json.NewEncoder(w).Encode(user2)
+	if err != nil {
+		h.logger.Sugar().Warnf("PutUser:: can't parse user as answer %s", err)
 	}
-	return sess.UserID
 }
 
-func (h *Handlers) checkAuthAndOwner(w http.ResponseWriter, r *http.Request) *robots.Robot {
-	ownerID := h.checkAuthByToken(w, r)
-	if ownerID < 0 {
-		return nil
-	}
-	robotID, err := h.getID(w, r)
+func (h *Handlers) GetUser(w http.ResponseWriter, r *http.Request) {
+	id, err := h.getID(w, r)
 	if err != nil {
-		return nil
+		return
 	}
 
-	robot, err := h.rs.GetByRobotID(robotID)
+	user, err := h.us.GetByID(r.Context(), id)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Errorf("checkAuthAndOwner:: can't get robot by id %s", err)
-		return nil
+		h.internal(w, r, "GetUser:: can't get user by id %s", err)
+		return
 	}
 
-	if robot == nil {
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		err = json.NewEncoder(w).Encode(map[string]string{"error": "no robot with such id"})
-		if err != nil {
-			h.logger.Sugar().Warnf("checkAuthAndOwner:: can't parse error %s", err)
-		}
-		return nil
-	}
+	w.Header().Add("Content-Type", "application/json")
 
-	if robot.OwnerUserID != ownerID {
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		err = json.NewEncoder(w).Encode(map[string]string{"error": "access denied"})
-		if err != nil {
-			h.logger.Sugar().Warnf("checkAuthAndOwner:: can't parse error %s", err)
-		}
-		return nil
+	if user == nil {
+		h.fail(w, r, http.StatusBadRequest, "no user with such id")
+		return
 	}
 
-	return robot
+	err = json.NewEncoder(w).Encode(user)
+	if err != nil {
+		h.logger.Sugar().Warnf("PutUser:: can't parse user as answer %s", err)
+	}
 }
 
 func (h *Handlers) getID(w http.ResponseWriter, r *http.Request) (int64, error) {
 	strID := chi.URLParam(r, "id")
 	id, err := strconv.ParseInt(strID, 0, 64)
-	if err != nil || id <= 0 {
-		w.WriteHeader(http.StatusBadRequest)
-		err = json.NewEncoder(w).Encode(map[string]string{"error": "incorrect id"})
-		if err != nil {
-			h.logger.Sugar().Warnf("getID:: can't parse error msg %s err")
-		}
-		w.Header().Add("Content-Type", "application/json")
+	if err == nil && id <= 0 {
+		err = errors.Errorf("id %d is not positive", id)
+	}
+	if err != nil {
+		h.fail(w, r, http.StatusBadRequest, "incorrect id")
 	}
 	return id, err
 }
@@ -491,332 +585,341 @@ func (h *Handlers) UserRobots(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.us.GetByID(id)
+	mime, ok := h.negotiateResponse(w, r, mimeJSON, mimeHTML, mimeCSV, mimeNDJSON)
+	if !ok {
+		return
+	}
+
+	user, err := h.us.GetByID(r.Context(), id)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Errorf("UserRobots:: can't get user %s", err)
+		h.internal(w, r, "UserRobots:: can't get user %s", err)
 		return
 	}
 
 	if user == nil {
-		w.WriteHeader(http.StatusNotFound)
-		if r.Header["Accept"][0] == "application/json" {
-			w.Header().Add("Content-Type", "application/json")
-			err = json.NewEncoder(w).Encode(map[string]string{"error": "user not found"})
-		} else {
-			w.Header().Add("Content-Type", "text/html")
-			err = templates["error"].Execute(w, "User not found")
-		}
-		if err != nil {
-			h.logger.Sugar().Warnf("UserRobots:: can't parse error msg %s", err)
-		}
-
+		h.fail(w, r, http.StatusNotFound, "user not found")
 		return
 	}
-	status := h.checkAuth(w, r, id)
-	if !status {
+
+	if mime == mimeCSV || mime == mimeNDJSON {
+		h.streamRobots(w, r, mime, "UserRobots", func(fn func(robo *robots.Robot) error) error {
+			return h.rs.StreamByTickerAndOwnerID(r.Context(), "", id, fn)
+		})
 		return
 	}
 
-	robots, err := h.rs.GetByOwnerID(id)
+	robos, err := h.rs.GetByOwnerID(r.Context(), id)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Errorf("UserRobots:: can't get robots %s", err)
+		h.internal(w, r, "UserRobots:: can't get robots %s", err)
 		return
 	}
 
-	if r.Header["Accept"][0] == "application/json" {
-		w.Header().Add("Content-Type", "application/json")
-
-		err = json.NewEncoder(w).Encode(robots)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			h.logger.Sugar().Errorf("UserRobots:: can't parse robots(json) %s", err)
-			return
-		}
-	} else {
-		w.Header().Add("Content-Type", "text/html")
-
+	switch mime {
+	case mimeJSON:
+		w.Header().Add("Content-Type", mimeJSON)
+		err = json.NewEncoder(w).Encode(robos)
+	case mimeHTML:
+		w.Header().Add("Content-Type", mimeHTML)
 		tmpl := templates["usersrobots"]
-		templrob := TemplRobots{Robots: robots, OwnerID: strconv.FormatInt(id, 10), Token: r.Header["Authorization"][0]}
+		templrob := TemplRobots{Robots: robos, OwnerID: strconv.FormatInt(id, 10), Token: r.Header.Get("Authorization")}
 		err = tmpl.Execute(w, templrob)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			h.logger.Sugar().Errorf("UserRobots:: can't parse robots(html) %s", err)
-			return
-		}
+	}
+	if err != nil {
+		h.logger.Sugar().Warnf("UserRobots:: can't parse robots(%s) %s", mime, err)
+	}
+}
+
+//robotRequest is the part of a robot its owner sets. Activation,
+//trading results, favourites and deletion have their own paths.
+type robotRequest struct {
+	Ticker    string     `json:"ticker"`
+	BuyPrice  float64    `json:"buy_price"`
+	SellPrice float64    `json:"sell_price"`
+	PlanStart *time.Time `json:"plan_start"`
+	PlanEnd   *time.Time `json:"plan_end"`
+	PlanYield float64    `json:"plan_yield"`
+	Tags      []string   `json:"tags"`
+}
+
+func newRobotRequest(robot *robots.Robot) robotRequest {
+	return robotRequest{
+		Ticker:    robot.Ticker,
+		BuyPrice:  robot.BuyPrice,
+		SellPrice: robot.SellPrice,
+		PlanStart: robot.PlanStart,
+		PlanEnd:   robot.PlanEnd,
+		PlanYield: robot.PlanYield,
+		Tags:      robot.Tags,
 	}
 }
 
+func (req *robotRequest) apply(robot *robots.Robot) {
+	robot.Ticker = req.Ticker
+	robot.BuyPrice = req.BuyPrice
+	robot.SellPrice = req.SellPrice
+	robot.PlanStart = req.PlanStart
+	robot.PlanEnd = req.PlanEnd
+	robot.PlanYield = req.PlanYield
+	robot.Tags = req.Tags
+}
+
 func (h *Handlers) PostRobot(w http.ResponseWriter, r *http.Request) {
-	ownerID := h.checkAuthByToken(w, r)
-	if ownerID < 0 {
+	ownerID := auth.FromContext(r.Context()).UserID
+
+	request := robotRequest{}
+	if !h.decodeJSON(w, r, &request, "PostRobot") {
 		return
 	}
 
 	robot := robots.Robot{}
-
-	err := json.NewDecoder(r.Body).Decode(&robot)
+	request.apply(&robot)
+	err := validation.Robot(&robot)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Warnf("PostRobot:: can't parse new robot %s", err)
+		h.invalid(w, r, err)
 		return
 	}
 
 	robot.OwnerUserID = ownerID
 
-	nextID, err := h.rs.NextID()
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Errorf("PostRobot:: can't get next id %s", err)
-		return
-	}
-
-	robot.RobotID = nextID
 	timeNow := time.Now().UTC()
 	robot.CreatedAt = &timeNow
 
-	err = h.rs.Create(&robot)
+	err = h.rs.Create(r.Context(), &robot)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Warnf("PostRobot:: can't create robot %s", err)
+		h.internal(w, r, "PostRobot:: can't create robot %s", err)
 		return
 	}
 }
 
 func (h *Handlers) Robots(w http.ResponseWriter, r *http.Request) {
-	ownerID := h.checkAuthByToken(w, r)
-	if ownerID < 0 {
+	mime, ok := h.negotiateResponse(w, r, mimeJSON, mimeHTML, mimeCSV, mimeNDJSON)
+	if !ok {
 		return
 	}
 
-	_, ok1 := r.URL.Query()["ticker"]
-	_, ok2 := r.URL.Query()["user"]
-
-	var ticker, idStr string
-	var userID int64
-	var err error
+	stream := mime == mimeCSV || mime == mimeNDJSON
+	filter, err := robotFilter(r.URL.Query(), !stream)
+	if err != nil {
+		h.invalid(w, r, err)
+		return
+	}
 
-	if ok2 {
-		idStr = r.URL.Query()["user"][0]
-		userID, err = strconv.ParseInt(idStr, 10, 64)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			h.logger.Sugar().Errorf("Robots:: can't transfrom to int %s", err)
+	//users see only their own robots, admins and auditors see everyone's
+	p := auth.FromContext(r.Context())
+	if !users.CanReadAll(p.Role) {
+		if filter.OwnerID != 0 && filter.OwnerID != p.UserID {
+			h.fail(w, r, http.StatusForbidden, "access denied")
 			return
 		}
+		filter.OwnerID = p.UserID
 	}
 
-	if ok1 {
-		ticker = r.URL.Query()["ticker"][0]
+	if stream {
+		h.streamRobots(w, r, mime, "Robots", func(fn func(robo *robots.Robot) error) error {
+			return h.rs.StreamList(r.Context(), filter, fn)
+		})
+		return
 	}
 
-	var robos []robots.Robot
-	if ok1 || ok2 {
-		robos, err = h.rs.GetByTickerAndOwnerID(ticker, userID)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			h.logger.Sugar().Errorf("Robots:: can't get all robots %s", err)
-			return
-		}
-	} else {
-		robos, err = h.rs.GetAllRobots()
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			h.logger.Sugar().Errorf("Robots:: can't get all robots %s", err)
-			return
-		}
+	robos, next, err := h.rs.List(r.Context(), filter)
+	if err != nil {
+		h.internal(w, r, "Robots:: can't list robots %s", err)
+		return
 	}
 
-	if r.Header["Accept"][0] == "application/json" {
-		w.Header().Add("Content-Type", "application/json")
-		err = json.NewEncoder(w).Encode(robos)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			h.logger.Sugar().Errorf("UserRobots:: can't parse robots(json) %s", err)
-			return
-		}
-	} else {
-		w.Header().Add("Content-Type", "text/html")
+	setNextLink(w, r, next)
 
+	idStr := ""
+	if filter.OwnerID != 0 {
+		idStr = strconv.FormatInt(filter.OwnerID, 10)
+	}
+
+	switch mime {
+	case mimeJSON:
+		w.Header().Add("Content-Type", mimeJSON)
+		err = json.NewEncoder(w).Encode(robos)
+	case mimeHTML:
+		w.Header().Add("Content-Type", mimeHTML)
 		tmpl := templates["robots"]
 		templrob := TemplRobots{
 			Robots:  robos,
-			Ticker:  ticker,
+			Ticker:  filter.Ticker,
 			OwnerID: idStr,
-			Token:   r.Header["Authorization"][0],
+			Token:   r.Header.Get("Authorization"),
 		}
-
 		err = tmpl.Execute(w, templrob)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			h.logger.Sugar().Errorf("UserRobots:: can't parse robots(html) %s", err)
-			return
-		}
+	}
+	if err != nil {
+		h.logger.Sugar().Warnf("Robots:: can't parse robots(%s) %s", mime, err)
 	}
 }
 
-func (h *Handlers) RobotWithID(w http.ResponseWriter, r *http.Request) {
-	userID := h.checkAuthByToken(w, r)
-	if userID < 0 {
+//SearchRobots finds robots by ticker prefix and tag, admins find
+//them by the owner's name or email too. Users search their own robots.
+func (h *Handlers) SearchRobots(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.negotiateResponse(w, r, mimeJSON); !ok {
 		return
 	}
 
-	robotID, err := h.getID(w, r)
+	search, err := robotSearch(r.URL.Query())
 	if err != nil {
+		h.invalid(w, r, err)
 		return
 	}
 
-	robot, err := h.rs.GetByRobotID(robotID)
+	p := auth.FromContext(r.Context())
+	search.MatchOwners = p.Role == users.RoleAdmin
+	if !users.CanReadAll(p.Role) {
+		search.OwnerID = p.UserID
+	}
+
+	hits, next, err := h.rs.Search(r.Context(), search)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Errorf("RobotWithID:: can't get robot by id %s", err)
+		h.internal(w, r, "SearchRobots:: can't search robots %s", err)
 		return
 	}
 
-	if robot == nil {
-		w.WriteHeader(http.StatusNotFound)
-		if r.Header["Accept"][0] == "application/json" {
-			w.Header().Add("Content-Type", "application/json")
-			err = json.NewEncoder(w).Encode(map[string]string{"error": "no robot with such id"})
-		} else {
-			w.Header().Add("Content-Type", "text/html")
-			err = templates["error"].Execute(w, "no robot with such id")
-		}
+	setNextLink(w, r, next)
+	w.Header().Add("Content-Type", mimeJSON)
+	err = json.NewEncoder(w).Encode(hits)
+	if err != nil {
+		h.logger.Sugar().Warnf("SearchRobots:: can't parse hits %s", err)
+	}
+}
 
-		if err != nil {
-			h.logger.Sugar().Warnf("RobotWithID:: can't parse error msg %s", err)
-		}
+func (h *Handlers) RobotWithID(w http.ResponseWriter, r *http.Request) {
+	robotID, err := h.getID(w, r)
+	if err != nil {
 		return
 	}
 
-	if r.Header["Accept"][0] == "application/json" {
-		w.Header().Add("Content-Type", "application/json")
-		err := json.NewEncoder(w).Encode(robot)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			h.logger.Sugar().Errorf("UserRobots:: can't parse robots(json) %s", err)
-			return
-		}
-	} else {
-		w.Header().Add("Content-Type", "text/html")
+	mime, ok := h.negotiateResponse(w, r, mimeJSON, mimeHTML, mimeCSV)
+	if !ok {
+		return
+	}
 
-		tmpl := templates["robot"]
+	robot, err := h.rs.GetByRobotID(r.Context(), robotID)
+	if err != nil {
+		h.internal(w, r, "RobotWithID:: can't get robot by id %s", err)
+		return
+	}
 
-		err := tmpl.Execute(w, robot)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			h.logger.Sugar().Errorf("UserRobots:: can't parse robots(html) %s", err)
-			return
-		}
+	//robots of others look missing, like they do in the listings
+	p := auth.FromContext(r.Context())
+	if robot == nil || (!users.CanReadAll(p.Role) && robot.OwnerUserID != p.UserID) {
+		h.fail(w, r, http.StatusNotFound, "no robot with such id")
+		return
+	}
+
+	switch mime {
+	case mimeJSON:
+		w.Header().Add("Content-Type", mimeJSON)
+		err = json.NewEncoder(w).Encode(robot)
+	case mimeCSV:
+		w.Header().Add("Content-Type", mimeCSV+"; charset=utf-8")
+		err = writeRobotsCSV(w, []robots.Robot{*robot})
+	case mimeHTML:
+		w.Header().Add("Content-Type", mimeHTML)
+		err = templates["robot"].Execute(w, robot)
+	}
+	if err != nil {
+		h.logger.Sugar().Warnf("RobotWithID:: can't parse robot(%s) %s", mime, err)
 	}
 }
 
 func (h *Handlers) DeleteRobot(w http.ResponseWriter, r *http.Request) {
-	robot := h.checkAuthAndOwner(w, r)
-	if robot == nil {
-		return
-	}
+	robot := robotFromContext(r.Context())
 
 	if robot.DeletedAt != nil {
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		err := json.NewEncoder(w).Encode(map[string]string{"error": "robot is already deleted"})
-		if err != nil {
-			h.logger.Sugar().Warnf("DeleteRobot:: can't parse error msg %s", err)
-		}
+		h.fail(w, r, http.StatusBadRequest, "robot is already deleted")
 		return
 	}
 
 	if robot.PlanStart != nil && robot.PlanEnd != nil {
 		if robot.PlanStart.Before(time.Now().UTC()) && robot.PlanEnd.After(time.Now().UTC()) {
-			w.Header().Add("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			err := json.NewEncoder(w).Encode(map[string]string{"error": "can't delete now"})
-			if err != nil {
-				h.logger.Sugar().Warnf("DeleteRobot:: can't parse error msg %s", err)
-			}
+			h.fail(w, r, http.StatusBadRequest, "can't delete now")
 			return
 		}
 	}
 
-	err := h.rs.DeleteRobot(robot)
+	err := h.rs.DeleteRobot(r.Context(), robot)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Errorf("DeleteRobot:: can't delete robot %s", err)
+		h.internal(w, r, "DeleteRobot:: can't delete robot %s", err)
 	}
 }
 
 func (h *Handlers) UpdateRobot(w http.ResponseWriter, r *http.Request) {
-	robot := h.checkAuthAndOwner(w, r)
-	if robot == nil {
+	stored := robotFromContext(r.Context())
+
+	//fields missing in the request keep their values, the request
+	//is applied over a copy, so it is validated before anything changes
+	request := newRobotRequest(stored)
+	if !h.decodeJSON(w, r, &request, "UpdateRobot") {
 		return
 	}
 
-	err := json.NewDecoder(r.Body).Decode(robot)
+	robot := *stored
+	request.apply(&robot)
+	err := validation.Robot(&robot)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Errorf("UpdateRobot:: can't decode robot from request %s", err)
+		h.invalid(w, r, err)
 		return
 	}
 
-	//we suggest that put doesn't change robot_id and owner_id
-	err = h.rs.UpdateRobot(robot)
+	err = h.rs.UpdateRobot(r.Context(), &robot)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Errorf("UpdateRobot:: can't update robot %s", err)
+		h.internal(w, r, "UpdateRobot:: can't update robot %s", err)
 		return
 	}
 
 	w.Header().Add("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(robot)
+	err = json.NewEncoder(w).Encode(&robot)
 	if err != nil {
 		h.logger.Sugar().Warnf("UpdateRobot:: can't parse new robot  %s", err)
 	}
 }
 
 func (h *Handlers) ActivateRobot(w http.ResponseWriter, r *http.Request) {
-	robot := h.checkAuthAndOwner(w, r)
-	if robot == nil {
+	robot := robotFromContext(r.Context())
+
+	//robots trade for real, the owner must be reachable
+	owner, err := h.us.GetByID(r.Context(), auth.FromContext(r.Context()).UserID)
+	if err != nil {
+		h.internal(w, r, "ActivateRobot:: can't get user %s", err)
+		return
+	}
+
+	if owner == nil {
+		h.fail(w, r, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	if owner.EmailVerifiedAt == nil {
+		h.fail(w, r, http.StatusForbidden, "email is not verified")
 		return
 	}
 
 	if robot.DeletedAt != nil {
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		err := json.NewEncoder(w).Encode(map[string]string{"error": "can't activate deleted robot"})
-		if err != nil {
-			h.logger.Sugar().Warnf("ActivateRobot:: can't parse error msg %s", err)
-		}
+		h.fail(w, r, http.StatusBadRequest, "can't activate deleted robot")
 		return
 	}
 
 	if robot.IsActive {
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		err := json.NewEncoder(w).Encode(map[string]string{"error": "can't activate activated robot"})
-		if err != nil {
-			h.logger.Sugar().Warnf("ActivateRobot:: can't parse error msg %s", err)
-		}
+		h.fail(w, r, http.StatusBadRequest, "can't activate activated robot")
 		return
 	}
 
 	if robot.PlanStart != nil && robot.PlanEnd != nil {
 		if robot.PlanStart.Before(time.Now().UTC()) && robot.PlanEnd.After(time.Now().UTC()) {
-			w.Header().Add("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			err := json.NewEncoder(w).Encode(map[string]string{"error": "can't activate now"})
-			if err != nil {
-				h.logger.Sugar().Warnf("ActivateRobot:: can't parse error msg %s", err)
-			}
+			h.fail(w, r, http.StatusBadRequest, "can't activate now")
 			return
 		}
 	}
 
-	err := h.rs.ActivateRobot(robot)
+	err = h.rs.ActivateRobot(r.Context(), robot)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Errorf("ActivateRobot:: can't activate robot %s", err)
+		h.internal(w, r, "ActivateRobot:: can't activate robot %s", err)
+		return
 	}
 
 	w.Header().Add("Content-Type", "application/json")
@@ -827,46 +930,28 @@ func (h *Handlers) ActivateRobot(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handlers) DeactivateRobot(w http.ResponseWriter, r *http.Request) {
-	robot := h.checkAuthAndOwner(w, r)
-	if robot == nil {
-		return
-	}
+	robot := robotFromContext(r.Context())
 
 	if robot.DeletedAt != nil {
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		err := json.NewEncoder(w).Encode(map[string]string{"error": "can't deactivate deleted robot"})
-		if err != nil {
-			h.logger.Sugar().Warnf("DeactivateRobot:: can't parse error msg %s", err)
-		}
+		h.fail(w, r, http.StatusBadRequest, "can't deactivate deleted robot")
 		return
 	}
 	if !robot.IsActive {
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		err := json.NewEncoder(w).Encode(map[string]string{"error": "can't deactivate deactivated robot"})
-		if err != nil {
-			h.logger.Sugar().Warnf("DeactivateRobot:: can't parse error msg %s", err)
-		}
+		h.fail(w, r, http.StatusBadRequest, "can't deactivate deactivated robot")
 		return
 	}
 
 	if robot.PlanStart != nil && robot.PlanEnd != nil {
 		if robot.PlanStart.Before(time.Now().UTC()) && robot.PlanEnd.After(time.Now().UTC()) {
-			w.Header().Add("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			err := json.NewEncoder(w).Encode(map[string]string{"error": "can't deactivate now"})
-			if err != nil {
-				h.logger.Sugar().Warnf("DeactivateRobot:: can't parse error msg %s", err)
-			}
+			h.fail(w, r, http.StatusBadRequest, "can't deactivate now")
 			return
 		}
 	}
 
-	err := h.rs.DeactivateRobot(robot)
+	err := h.rs.DeactivateRobot(r.Context(), robot)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Errorf("DeactivateRobot:: can't delete robot %s", err)
+		h.internal(w, r, "DeactivateRobot:: can't deactivate robot %s", err)
+		return
 	}
 
 	w.Header().Add("Content-Type", "application/json")
@@ -877,57 +962,43 @@ func (h *Handlers) DeactivateRobot(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handlers) FavourRobot(w http.ResponseWriter, r *http.Request) {
-	ownerID := h.checkAuthByToken(w, r)
-	if ownerID < 0 {
-		return
-	}
+	ownerID := auth.FromContext(r.Context()).UserID
 	robotID, err := h.getID(w, r)
 	if err != nil {
 		return
 	}
 
-	robot, err := h.rs.GetByRobotID(robotID)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Errorf("FavourRobot:: can't get robot by id %s", err)
-		return
-	}
-
-	if robot == nil {
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		err = json.NewEncoder(w).Encode(map[string]string{"error": "no robot with such id"})
-		if err != nil {
-			h.logger.Sugar().Warnf("FavourRobot:: can't parse error %s", err)
+	//the copy is made of the robot as it is when the copy is stored
+	var robot *robots.Robot
+	err = h.tx.InTx(r.Context(), func(tx storage.Tx) error {
+		rs := tx.Robots()
+		var err error
+		robot, err = rs.GetByRobotID(r.Context(), robotID)
+		if err != nil || robot == nil {
+			return err
 		}
-		return
-	}
 
-	timeNow := time.Now().UTC()
-	robot.OwnerUserID = ownerID
-	robot.ParentRobotID = robot.RobotID
-	robot.IsFavourite = true
-	robot.IsActive = false
-	robot.FactYield = 0
-	robot.DealsCount = 0
-	robot.CreatedAt = &timeNow
-	robot.DeletedAt = nil
-	robot.ActivatedAt = nil
-	robot.DeactivatedAt = nil
+		timeNow := time.Now().UTC()
+		robot.OwnerUserID = ownerID
+		robot.ParentRobotID = robot.RobotID
+		robot.IsFavourite = true
+		robot.IsActive = false
+		robot.FactYield = 0
+		robot.DealsCount = 0
+		robot.CreatedAt = &timeNow
+		robot.DeletedAt = nil
+		robot.ActivatedAt = nil
+		robot.DeactivatedAt = nil
 
-	nextID, err := h.rs.NextID()
+		return rs.Create(r.Context(), robot)
+	})
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Errorf("FavourRobot:: can't get next id %s", err)
+		h.internal(w, r, "FavourRobot:: can't create copy %s", err)
 		return
 	}
 
-	robot.RobotID = nextID
-
-	err = h.rs.Create(robot)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		h.logger.Sugar().Errorf("FavourRobot:: can't create copy %s", err)
+	if robot == nil {
+		h.fail(w, r, http.StatusBadRequest, "no robot with such id")
 		return
 	}
 
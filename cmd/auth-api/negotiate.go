@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	mimeJSON    = "application/json"
+	mimeProblem = "application/problem+json"
+	mimeHTML    = "text/html"
+	mimeCSV     = "text/csv"
+	mimeNDJSON  = "application/x-ndjson"
+)
+
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+func parseAccept(accept string) []mediaRange {
+	ranges := []mediaRange{}
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		typ := strings.ToLower(strings.TrimSpace(params[0]))
+		slash := strings.Index(typ, "/")
+		if slash <= 0 {
+			continue
+		}
+
+		mr := mediaRange{typ: typ[:slash], subtype: typ[slash+1:], q: 1}
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.ToLower(kv[0]) == "q" {
+				q, err := strconv.ParseFloat(kv[1], 64)
+				if err != nil || q < 0 || q > 1 {
+					q = 0
+				}
+				mr.q = q
+			}
+		}
+		ranges = append(ranges, mr)
+	}
+
+	return ranges
+}
+
+//quality of offer is the q of the most specific range matching it,
+//-1 when no range matches.
+func quality(ranges []mediaRange, offer string) float64 {
+	slash := strings.Index(offer, "/")
+	typ, subtype := offer[:slash], offer[slash+1:]
+
+	q, specificity := -1.0, -1
+	for _, mr := range ranges {
+		s := -1
+		switch {
+		case mr.typ == typ && mr.subtype == subtype:
+			s = 2
+		case mr.typ == typ && mr.subtype == "*":
+			s = 1
+		case mr.typ == "*" && mr.subtype == "*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = mr.q, s
+		}
+	}
+
+	return q
+}
+
+//negotiate returns the offer the client accepts most (RFC 7231 5.3.2),
+//of equally accepted offers the first one. No Accept header means
+//anything is accepted. It returns "" when no offer is acceptable.
+func negotiate(accept string, offers ...string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	ranges := parseAccept(accept)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := quality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best
+}
+
+//negotiateResponse picks the representation of a response and answers
+//406 if the client accepts none of offers.
+func (h *Handlers) negotiateResponse(w http.ResponseWriter, r *http.Request, offers ...string) (string, bool) {
+	w.Header().Add("Vary", "Accept")
+
+	mime := negotiate(r.Header.Get("Accept"), offers...)
+	if mime == "" {
+		h.fail(w, r, http.StatusNotAcceptable, "available as "+strings.Join(offers, ", "))
+		return "", false
+	}
+
+	return mime, true
+}
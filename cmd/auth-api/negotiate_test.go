@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		offers []string
+		want   string
+	}{
+		{"no header", "", []string{mimeJSON, mimeCSV}, mimeJSON},
+		{"blank header", "  ", []string{mimeCSV, mimeJSON}, mimeCSV},
+		{"exact", mimeCSV, []string{mimeJSON, mimeCSV}, mimeCSV},
+		{"case", "Application/JSON", []string{mimeCSV, mimeJSON}, mimeJSON},
+		{"higher q", "text/csv;q=0.5, application/json", []string{mimeCSV, mimeJSON}, mimeJSON},
+		{"higher q first", "application/json;q=0.5, text/csv", []string{mimeJSON, mimeCSV}, mimeCSV},
+		{"equal q keeps offer order", "text/csv;q=0.5, application/json;q=0.5", []string{mimeJSON, mimeCSV}, mimeJSON},
+		{"q with spaces", "text/csv ; q=0.9, application/json ; q=0.8", []string{mimeJSON, mimeCSV}, mimeCSV},
+		{"any", "*/*", []string{mimeCSV, mimeJSON}, mimeCSV},
+		{"subtype wildcard", "text/*", []string{mimeJSON, mimeCSV}, mimeCSV},
+		{"specific beats wildcard", "text/*;q=0.8, text/csv;q=0.1, application/json;q=0.5",
+			[]string{mimeCSV, mimeJSON}, mimeJSON},
+		{"wildcard with exclusion", "*/*, application/json;q=0", []string{mimeJSON, mimeCSV}, mimeCSV},
+		{"q zero", "application/json;q=0", []string{mimeJSON}, ""},
+		{"malformed q", "application/json;q=high", []string{mimeJSON}, ""},
+		{"q out of range", "application/json;q=2", []string{mimeJSON}, ""},
+		{"no match", "application/xml", []string{mimeJSON, mimeCSV}, ""},
+		{"malformed range", "json", []string{mimeJSON}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := negotiate(tt.accept, tt.offers...); got != tt.want {
+				t.Errorf("negotiate(%q, %v) = %q, want %q", tt.accept, tt.offers, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNegotiateResponse(t *testing.T) {
+	h := &Handlers{logger: zap.NewNop()}
+
+	tests := []struct {
+		name   string
+		accept string
+		mime   string
+		ok     bool
+	}{
+		{"acceptable", "text/csv", mimeCSV, true},
+		{"not acceptable", "application/xml", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/robots", nil)
+			r.Header.Set("Accept", tt.accept)
+
+			mime, ok := h.negotiateResponse(w, r, mimeJSON, mimeCSV)
+			if mime != tt.mime || ok != tt.ok {
+				t.Fatalf("got %q, %t, want %q, %t", mime, ok, tt.mime, tt.ok)
+			}
+			if w.Header().Get("Vary") != "Accept" {
+				t.Errorf("Vary is %q, want Accept", w.Header().Get("Vary"))
+			}
+			if ok {
+				return
+			}
+
+			if w.Code != http.StatusNotAcceptable {
+				t.Errorf("status is %d, want %d", w.Code, http.StatusNotAcceptable)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != mimeProblem {
+				t.Errorf("Content-Type is %q, want %q", ct, mimeProblem)
+			}
+			var p Problem
+			err := json.NewDecoder(w.Body).Decode(&p)
+			if err != nil {
+				t.Fatalf("can't decode problem: %s", err)
+			}
+			if p.Status != http.StatusNotAcceptable || p.Detail != "available as application/json, text/csv" {
+				t.Errorf("got problem %+v", p)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"finPrj/internal/auth"
+	"finPrj/internal/oidc"
+	"finPrj/internal/storage"
+	"finPrj/internal/tokens"
+	users "finPrj/internal/users"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+)
+
+const (
+	purposeOAuthState = "oauth-state"
+	oauthStateCookie  = "oauth_state"
+	oauthStateTTL     = 10 * time.Minute
+)
+
+var errIdentityConflict = errors.New("email is registered, verify it before signing in with the provider")
+
+//oauthState is kept in a signed cookie between start and callback,
+//so any instance can finish a flow another one started.
+type oauthState struct {
+	tokens.Claims
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+func (h *Handlers) oauthProvider(w http.ResponseWriter, r *http.Request) *oidc.Provider {
+	provider, ok := h.providers[chi.URLParam(r, "provider")]
+	if !ok {
+		h.fail(w, r, http.StatusNotFound, "unknown provider")
+		return nil
+	}
+
+	return provider
+}
+
+//OAuthStart redirects to the provider's sign in page.
+func (h *Handlers) OAuthStart(w http.ResponseWriter, r *http.Request) {
+	provider := h.oauthProvider(w, r)
+	if provider == nil {
+		return
+	}
+
+	timeNow := time.Now().UTC()
+	st := oauthState{
+		Claims: tokens.Claims{
+			Purpose:   purposeOAuthState,
+			IssuedAt:  timeNow.Unix(),
+			ExpiresAt: timeNow.Add(oauthStateTTL).Unix(),
+		},
+		Provider: provider.Name(),
+	}
+
+	var err error
+	for _, dst := range []*string{&st.State, &st.Nonce, &st.Verifier} {
+		if err == nil {
+			*dst, err = oidc.NewRandom()
+		}
+	}
+	if err != nil {
+		h.internal(w, r, "OAuthStart:: %s", err)
+		return
+	}
+
+	cookie, err := h.signer.Sign(st)
+	if err != nil {
+		h.internal(w, r, "OAuthStart:: can't sign state %s", err)
+		return
+	}
+
+	redirect, err := provider.AuthCodeURL(st.State, st.Nonce, st.Verifier)
+	if err != nil {
+		h.logger.Sugar().Errorf("OAuthStart:: %s", err)
+		h.fail(w, r, http.StatusBadGateway, "can't reach "+provider.Name())
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    cookie,
+		Path:     "/api/v1/oauth/",
+		MaxAge:   int(oauthStateTTL / time.Second),
+		Secure:   strings.HasPrefix(h.publicURL, "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+//OAuthCallback finishes the flow and answers like SignIn.
+func (h *Handlers) OAuthCallback(w http.ResponseWriter, r *http.Request) {
+	provider := h.oauthProvider(w, r)
+	if provider == nil {
+		return
+	}
+
+	//the state is single-use, a retry starts over
+	http.SetCookie(w, &http.Cookie{Name: oauthStateCookie, Path: "/api/v1/oauth/", MaxAge: -1})
+	w.Header().Add("Content-Type", "application/json")
+
+	st := oauthState{}
+	msg := ""
+	cookie, err := r.Cookie(oauthStateCookie)
+	switch {
+	case err != nil:
+		msg = "no sign in in progress"
+	case h.signer.Verify(cookie.Value, &st) != nil || st.Purpose != purposeOAuthState ||
+		time.Now().Unix() >= st.ExpiresAt:
+		msg = "sign in expired, start again"
+	case st.Provider != provider.Name() || st.State != r.URL.Query().Get("state"):
+		msg = "state mismatch"
+	case r.URL.Query().Get("error") != "":
+		msg = "provider error: " + r.URL.Query().Get("error")
+	}
+
+	if msg != "" {
+		h.fail(w, r, http.StatusBadRequest, msg)
+		return
+	}
+
+	idToken, err := provider.Exchange(r.URL.Query().Get("code"), st.Verifier, st.Nonce)
+	if err != nil {
+		h.logger.Sugar().Warnf("OAuthCallback:: %s", err)
+		h.fail(w, r, http.StatusBadGateway, "can't sign in with "+provider.Name())
+		return
+	}
+
+	user, err := h.identityUser(r.Context(), provider.Name(), idToken)
+	if err != nil {
+		if err == errIdentityConflict {
+			h.fail(w, r, http.StatusConflict, err.Error())
+			return
+		}
+
+		h.internal(w, r, "OAuthCallback:: %s", err)
+		return
+	}
+
+	//the provider replaces the password, not the second factor
+	if user.TOTPEnabledAt != nil {
+		challenge, err := h.newTOTPChallenge(user)
+		if err != nil {
+			h.internal(w, r, "OAuthCallback:: can't create totp challenge %s", err)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(challenge)
+		if err != nil {
+			h.logger.Sugar().Warnf("OAuthCallback:: can't parse totp challenge %s", err)
+		}
+		return
+	}
+
+	sessTokens, err := h.startSession(r, user)
+	if err != nil {
+		h.internal(w, r, "OAuthCallback:: can't start session %s", err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(sessTokens)
+	if err != nil {
+		h.logger.Sugar().Warnf("OAuthCallback:: can't parse tokens %s", err)
+	}
+}
+
+//identityUser finds the user linked to the identity. Unknown identities
+//are linked to the user with the same email if both the provider and
+//the user verified it, otherwise a new user is created.
+func (h *Handlers) identityUser(ctx context.Context, provider string, idToken *oidc.IDToken) (*users.User, error) {
+	var user *users.User
+	link := func(tx storage.Tx) error {
+		var err error
+		user, err = h.linkIdentity(ctx, tx, provider, idToken)
+		return err
+	}
+
+	err := h.tx.InTx(ctx, link)
+	if err == users.ErrIdentityLinked {
+		//a concurrent callback linked it first, now it is found
+		err = h.tx.InTx(ctx, link)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (h *Handlers) linkIdentity(ctx context.Context, tx storage.Tx, provider string, idToken *oidc.IDToken) (*users.User, error) {
+	us, ids := tx.Users(), tx.Identities()
+
+	identity, err := ids.Get(ctx, provider, idToken.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if identity != nil {
+		user, err := us.GetByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, errors.Errorf("identity of missing user %d", identity.UserID)
+		}
+		return user, nil
+	}
+
+	if idToken.Email == "" {
+		return nil, errors.Errorf("%s gave no email for %s", provider, idToken.Subject)
+	}
+
+	timeNow := time.Now().UTC()
+	user, err := us.GetByEmail(ctx, idToken.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	//an unverified account may be someone else's, registered with
+	//the address before its owner came, linking would let them in
+	if user != nil && (!idToken.EmailVerified || user.EmailVerifiedAt == nil) {
+		return nil, errIdentityConflict
+	}
+
+	if user == nil {
+		user, err = h.newIdentityUser(ctx, us, idToken, timeNow)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = ids.Create(ctx, &users.Identity{
+		Provider:  provider,
+		Subject:   idToken.Subject,
+		UserID:    user.ID,
+		Email:     idToken.Email,
+		CreatedAt: timeNow,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+//newIdentityUser creates a user without a usable password,
+//one can be set later with the password reset flow.
+func (h *Handlers) newIdentityUser(ctx context.Context, us users.Storage, idToken *oidc.IDToken, timeNow time.Time) (*users.User, error) {
+	random, err := oidc.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := h.pm.Hash(random)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &users.User{
+		FirstName: idToken.GivenName,
+		LastName:  idToken.FamilyName,
+		Email:     idToken.Email,
+		Password:  password,
+		Role:      users.RoleUser,
+		CreatedAt: timeNow,
+		UpdatedAt: timeNow,
+	}
+	if idToken.EmailVerified {
+		user.EmailVerifiedAt = &timeNow
+	}
+
+	err = us.Create(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (h *Handlers) Identities(w http.ResponseWriter, r *http.Request) {
+	identities, err := h.ids.ListByUserID(r.Context(), auth.FromContext(r.Context()).UserID)
+	if err != nil {
+		h.internal(w, r, "Identities:: can't list identities %s", err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(identities)
+	if err != nil {
+		h.logger.Sugar().Warnf("Identities:: can't parse identities %s", err)
+	}
+}
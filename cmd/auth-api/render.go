@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"finPrj/internal/robots"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//rows written between flushes of a streamed export
+const streamFlushRows = 100
+
+var robotCSVHeader = []string{
+	"robot_id", "owner_user_id", "parent_robot_id", "is_favorite", "is_active", "ticker",
+	"buy_price", "sell_price", "plan_start", "plan_end", "plan_yield", "fact_yield",
+	"deals_counts", "deleted_at", "activated_at", "deactivated_at", "created_at", "tags",
+}
+
+//csvTime leaves unset times empty
+func csvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+//robotNDJSON is robots.Robot without omitempty, so every line
+//of an export has the same keys as the csv header
+type robotNDJSON struct {
+	RobotID       int64      `json:"robot_id"`
+	OwnerUserID   int64      `json:"owner_user_id"`
+	ParentRobotID int64      `json:"parent_robot_id"`
+	IsFavourite   bool       `json:"is_favorite"`
+	IsActive      bool       `json:"is_active"`
+	Ticker        string     `json:"ticker"`
+	BuyPrice      float64    `json:"buy_price"`
+	SellPrice     float64    `json:"sell_price"`
+	PlanStart     *time.Time `json:"plan_start"`
+	PlanEnd       *time.Time `json:"plan_end"`
+	PlanYield     float64    `json:"plan_yield"`
+	FactYield     float64    `json:"fact_yield"`
+	DealsCount    int64      `json:"deals_counts"`
+	DeletedAt     *time.Time `json:"deleted_at"`
+	ActivatedAt   *time.Time `json:"activated_at"`
+	DeactivatedAt *time.Time `json:"deactivated_at"`
+	CreatedAt     *time.Time `json:"created_at"`
+	Tags          []string   `json:"tags"`
+}
+
+func robotCSVRecord(robot *robots.Robot) []string {
+	return []string{
+		strconv.FormatInt(robot.RobotID, 10),
+		strconv.FormatInt(robot.OwnerUserID, 10),
+		strconv.FormatInt(robot.ParentRobotID, 10),
+		strconv.FormatBool(robot.IsFavourite),
+		strconv.FormatBool(robot.IsActive),
+		robot.Ticker,
+		strconv.FormatFloat(robot.BuyPrice, 'f', -1, 64),
+		strconv.FormatFloat(robot.SellPrice, 'f', -1, 64),
+		csvTime(robot.PlanStart),
+		csvTime(robot.PlanEnd),
+		strconv.FormatFloat(robot.PlanYield, 'f', -1, 64),
+		strconv.FormatFloat(robot.FactYield, 'f', -1, 64),
+		strconv.FormatInt(robot.DealsCount, 10),
+		csvTime(robot.DeletedAt),
+		csvTime(robot.ActivatedAt),
+		csvTime(robot.DeactivatedAt),
+		csvTime(robot.CreatedAt),
+		strings.Join(robot.Tags, " "),
+	}
+}
+
+//writeRobotsCSV writes a header row and one row per robot.
+func writeRobotsCSV(w io.Writer, robos []robots.Robot) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write(robotCSVHeader)
+	if err != nil {
+		return err
+	}
+
+	for i := range robos {
+		err = cw.Write(robotCSVRecord(&robos[i]))
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+//robotStream writes robots as csv or ndjson while they are read
+//from the storage. Headers are sent with the first row, so a failed
+//query can still be answered with a problem.
+type robotStream struct {
+	w       http.ResponseWriter
+	mime    string
+	cw      *csv.Writer
+	enc     *json.Encoder
+	rows    int
+	started bool
+}
+
+func newRobotStream(w http.ResponseWriter, mime string) *robotStream {
+	return &robotStream{w: w, mime: mime, cw: csv.NewWriter(w), enc: json.NewEncoder(w)}
+}
+
+func (s *robotStream) start() error {
+	s.started = true
+	if s.mime == mimeCSV {
+		s.w.Header().Add("Content-Type", mimeCSV+"; charset=utf-8")
+		return s.cw.Write(robotCSVHeader)
+	}
+
+	s.w.Header().Add("Content-Type", mimeNDJSON)
+	return nil
+}
+
+//Write is the storage callback, one call per row
+func (s *robotStream) Write(robot *robots.Robot) error {
+	if !s.started {
+		err := s.start()
+		if err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if s.mime == mimeCSV {
+		err = s.cw.Write(robotCSVRecord(robot))
+	} else {
+		err = s.enc.Encode(robotNDJSON(*robot))
+	}
+	if err != nil {
+		return err
+	}
+
+	s.rows++
+	if s.rows%streamFlushRows == 0 {
+		return s.flush()
+	}
+
+	return nil
+}
+
+func (s *robotStream) flush() error {
+	s.cw.Flush()
+	if err := s.cw.Error(); err != nil {
+		return err
+	}
+
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	return nil
+}
+
+//Close sends what is left, an empty csv export still gets its header
+func (s *robotStream) Close() error {
+	if !s.started {
+		err := s.start()
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.flush()
+}
+
+//streamRobots answers with the robots that query passes to its callback.
+//Once rows are sent an error can't become a problem anymore, the
+//connection is aborted instead so the client sees a broken export
+//rather than a short one.
+func (h *Handlers) streamRobots(w http.ResponseWriter, r *http.Request, mime, fn string,
+	query func(fn func(robo *robots.Robot) error) error) {
+	stream := newRobotStream(w, mime)
+	err := query(stream.Write)
+	if err == nil {
+		err = stream.Close()
+	}
+	if err == nil {
+		return
+	}
+
+	if !stream.started {
+		h.internal(w, r, "%s:: can't get robots %s", fn, err)
+		return
+	}
+
+	h.logger.Sugar().Errorf("%s:: export broke after %d rows %s", fn, stream.rows, err)
+	panic(http.ErrAbortHandler)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"finPrj/internal/robots"
+	"finPrj/internal/validation"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//robotFilter reads the filters, order and page of GET /robots:
+//
+//	ticker, user, is_active, is_favourite, deleted,
+//	plan_start_from, plan_start_to, plan_end_from, plan_end_to (RFC 3339),
+//	plan_yield_min, plan_yield_max, fact_yield_min, fact_yield_max,
+//	sort (a robots.Sort* key, -key sorts descending), limit, cursor
+//
+//paged is false for exports, they list everything unless limit is set.
+func robotFilter(query url.Values, paged bool) (*robots.Filter, error) {
+	errs := validation.Errors{}
+	filter := &robots.Filter{Ticker: query.Get("ticker"), Sort: robots.SortRobotID}
+
+	if value := query.Get("user"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id <= 0 {
+			errs.Add("user", validation.CodeType, "user must be a user id")
+		}
+		filter.OwnerID = id
+	}
+
+	filter.IsActive = queryBool(&errs, query, "is_active")
+	filter.IsFavourite = queryBool(&errs, query, "is_favourite")
+	filter.Deleted = queryBool(&errs, query, "deleted")
+
+	filter.PlanStartFrom = queryTime(&errs, query, "plan_start_from")
+	filter.PlanStartTo = queryTime(&errs, query, "plan_start_to")
+	filter.PlanEndFrom = queryTime(&errs, query, "plan_end_from")
+	filter.PlanEndTo = queryTime(&errs, query, "plan_end_to")
+
+	filter.MinPlanYield = queryFloat(&errs, query, "plan_yield_min")
+	filter.MaxPlanYield = queryFloat(&errs, query, "plan_yield_max")
+	filter.MinFactYield = queryFloat(&errs, query, "fact_yield_min")
+	filter.MaxFactYield = queryFloat(&errs, query, "fact_yield_max")
+
+	if sort := query.Get("sort"); sort != "" {
+		filter.Desc = strings.HasPrefix(sort, "-")
+		filter.Sort = strings.TrimPrefix(sort, "-")
+		if !robots.IsSortKey(filter.Sort) {
+			errs.Add("sort", validation.CodeFormat, "can't sort by "+filter.Sort)
+		}
+	}
+
+	if paged {
+		filter.Limit = robots.DefaultLimit
+	}
+	filter.Limit = queryLimit(&errs, query, filter.Limit)
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		if filter.ParseCursor(cursor) != nil {
+			errs.Add("cursor", validation.CodeFormat, "cursor is malformed or doesn't belong to this sort order")
+		}
+	}
+
+	return filter, errs.Err()
+}
+
+//robotSearch reads q, limit and cursor of GET /robots/search
+func robotSearch(query url.Values) (*robots.Search, error) {
+	errs := validation.Errors{}
+	search := &robots.Search{Query: strings.TrimSpace(query.Get("q"))}
+	errs.Length("q", search.Query, 1, 64)
+	search.Limit = queryLimit(&errs, query, robots.DefaultLimit)
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		if search.ParseCursor(cursor) != nil {
+			errs.Add("cursor", validation.CodeFormat, "cursor is malformed or doesn't belong to a search")
+		}
+	}
+
+	return search, errs.Err()
+}
+
+//queryLimit returns def when no limit is asked for
+func queryLimit(errs *validation.Errors, query url.Values, def int) int {
+	value := query.Get("limit")
+	if value == "" {
+		return def
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > robots.MaxLimit {
+		errs.Add("limit", validation.CodeOutOfRange, "limit must be from 1 to "+strconv.Itoa(robots.MaxLimit))
+	}
+	return limit
+}
+
+func queryBool(errs *validation.Errors, query url.Values, field string) *bool {
+	value := query.Get(field)
+	if value == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		errs.Add(field, validation.CodeType, field+" must be true or false")
+		return nil
+	}
+	return &b
+}
+
+func queryTime(errs *validation.Errors, query url.Values, field string) *time.Time {
+	value := query.Get(field)
+	if value == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		errs.Add(field, validation.CodeFormat, field+" must be an RFC 3339 time")
+		return nil
+	}
+	return &t
+}
+
+func queryFloat(errs *validation.Errors, query url.Values, field string) *float64 {
+	value := query.Get(field)
+	if value == "" {
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		errs.Add(field, validation.CodeType, field+" must be a number")
+		return nil
+	}
+	return &f
+}
+
+//setNextLink points at the next page the way RFC 8288 does,
+//the body stays a plain list.
+func setNextLink(w http.ResponseWriter, r *http.Request, next string) {
+	if next == "" {
+		return
+	}
+
+	query := r.URL.Query()
+	query.Set("cursor", next)
+	w.Header().Set("Link", "<"+r.URL.Path+"?"+query.Encode()+`>; rel="next"`)
+	w.Header().Set("X-Next-Cursor", next)
+}
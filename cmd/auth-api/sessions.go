@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	sessions "finPrj/internal/sessions"
+	"finPrj/internal/storage"
+	"finPrj/internal/tokens"
+	users "finPrj/internal/users"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//SessionTokens is returned by SignIn and RefreshToken.
+type SessionTokens struct {
+	Bearer       string    `json:"bearer"`
+	RefreshToken string    `json:"refresh_token"`
+	ValidUntil   time.Time `json:"valid_until"`
+}
+
+//startSession creates a new session of the user on the device
+//the request came from.
+func (h *Handlers) startSession(r *http.Request, user *users.User) (*SessionTokens, error) {
+	sessionID, err := sessions.NewID()
+	if err != nil {
+		return nil, err
+	}
+
+	timeNow := time.Now().UTC()
+	sess := sessions.Session{
+		SessionID:  sessionID,
+		UserID:     user.ID,
+		UserAgent:  r.UserAgent(),
+		IP:         clientIP(r),
+		CreatedAt:  timeNow,
+		LastSeenAt: timeNow,
+		ExpiresAt:  timeNow.Add(h.lifetime.Absolute),
+	}
+	h.lifetime.Slide(&sess, timeNow)
+
+	token, err := h.newBearer(&sess, user.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	//a session is never stored without its refresh token
+	var refresh string
+	err = h.tx.InTx(r.Context(), func(tx storage.Tx) error {
+		ss := tx.Sessions()
+		err := ss.Create(r.Context(), &sess)
+		if err != nil {
+			return errors.Wrap(err, "can't create session")
+		}
+
+		refresh, err = h.newRefreshToken(r.Context(), ss, &sess, timeNow)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &SessionTokens{Bearer: token, RefreshToken: refresh, ValidUntil: sess.ValidUntil}, nil
+}
+
+//newBearer returns a new bearer of the session and sets its TokenHash.
+//With signed tokens enabled the bearer is a signed token that expires
+//at ValidUntil, otherwise it is an opaque random token.
+func (h *Handlers) newBearer(sess *sessions.Session, role string) (string, error) {
+	var token string
+	var err error
+	if h.keys != nil {
+		claims := tokens.Claims{
+			Subject:   sess.UserID,
+			SessionID: sess.SessionID,
+			Role:      role,
+			ExpiresAt: sess.ValidUntil.Unix(),
+		}
+		claims.SetIssuedAt(sess.LastSeenAt)
+		token, err = h.keys.Sign(claims)
+	} else {
+		token, err = sessions.NewToken()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	sess.TokenHash = sessions.HashToken(token)
+	return token, nil
+}
+
+func (h *Handlers) newRefreshToken(ctx context.Context, ss sessions.Storage, sess *sessions.Session,
+	timeNow time.Time) (string, error) {
+	token, err := sessions.NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = ss.CreateRefreshToken(ctx, &sessions.RefreshToken{
+		TokenHash: sessions.HashToken(token),
+		SessionID: sess.SessionID,
+		UserID:    sess.UserID,
+		CreatedAt: timeNow,
+		ExpiresAt: sess.ExpiresAt,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "can't create refresh token")
+	}
+
+	return token, nil
+}
+
+//RefreshToken exchanges a refresh token for a new bearer and refresh token.
+//Presenting an already used refresh token means it was stolen,
+//so the session it belongs to is revoked.
+func (h *Handlers) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	request := map[string]string{}
+
+	if !h.decodeJSON(w, r, &request, "RefreshToken") {
+		return
+	}
+
+	hash := sessions.HashToken(request["refresh_token"])
+	rt, err := h.ss.GetRefreshToken(r.Context(), hash)
+	if err != nil {
+		h.internal(w, r, "RefreshToken:: can't get refresh token %s", err)
+		return
+	}
+
+	timeNow := time.Now().UTC()
+	if rt == nil || rt.ExpiresAt.Before(timeNow) {
+		h.fail(w, r, http.StatusUnauthorized, "invalid refresh token")
+		return
+	}
+
+	used := rt.UsedAt != nil
+	if !used {
+		ok, err := h.ss.UseRefreshToken(r.Context(), hash, timeNow)
+		if err != nil {
+			h.internal(w, r, "RefreshToken:: can't use refresh token %s", err)
+			return
+		}
+		used = !ok
+	}
+
+	if used {
+		h.logger.Sugar().Warnf("RefreshToken:: refresh token reuse, revoking session %s of user %d",
+			rt.SessionID, rt.UserID)
+		err = h.revokeSession(r.Context(), &sessions.Session{SessionID: rt.SessionID, UserID: rt.UserID})
+		if err != nil {
+			h.logger.Sugar().Errorf("RefreshToken:: %s", err)
+		}
+		h.fail(w, r, http.StatusUnauthorized, "refresh token reuse detected")
+		return
+	}
+
+	sess, err := h.ss.GetBySessionID(r.Context(), rt.SessionID)
+	if err != nil {
+		h.internal(w, r, "RefreshToken:: can't get session %s", err)
+		return
+	}
+
+	if sess == nil || sess.ExpiresAt.Before(timeNow) {
+		h.fail(w, r, http.StatusUnauthorized, "session expired")
+		return
+	}
+
+	user, err := h.us.GetByID(r.Context(), sess.UserID)
+	if err != nil {
+		h.internal(w, r, "RefreshToken:: can't get user %s", err)
+		return
+	}
+
+	if user == nil {
+		h.fail(w, r, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	sess.LastSeenAt = timeNow
+	h.lifetime.Slide(sess, timeNow)
+	token, err := h.newBearer(sess, user.Role)
+	if err != nil {
+		h.internal(w, r, "RefreshToken:: can't create token %s", err)
+		return
+	}
+
+	var refresh string
+	err = h.tx.InTx(r.Context(), func(tx storage.Tx) error {
+		ss := tx.Sessions()
+		err := ss.Rotate(r.Context(), sess)
+		if err != nil {
+			return errors.Wrap(err, "can't rotate session")
+		}
+
+		refresh, err = h.newRefreshToken(r.Context(), ss, sess, timeNow)
+		return err
+	})
+	if err != nil {
+		h.internal(w, r, "RefreshToken:: %s", err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(SessionTokens{Bearer: token, RefreshToken: refresh, ValidUntil: sess.ValidUntil})
+	if err != nil {
+		h.logger.Sugar().Warnf("RefreshToken:: can't parse tokens %s", err)
+	}
+}
+
+//revokeSession deletes the session and, with signed tokens enabled,
+//records a revocation so its access tokens stop working before they expire.
+func (h *Handlers) revokeSession(ctx context.Context, sess *sessions.Session) error {
+	err := h.ss.DeleteBySessionID(ctx, sess.SessionID)
+	if err != nil {
+		return errors.Wrap(err, "can't delete session")
+	}
+
+	return h.recordRevocation(ctx, sessions.Revocation{SessionID: sess.SessionID, UserID: sess.UserID})
+}
+
+func (h *Handlers) revokeUserSessions(ctx context.Context, userID int64) error {
+	err := h.ss.DeleteByUserID(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "can't delete sessions")
+	}
+
+	return h.recordRevocation(ctx, sessions.Revocation{UserID: userID})
+}
+
+func (h *Handlers) recordRevocation(ctx context.Context, rev sessions.Revocation) error {
+	if h.keys == nil {
+		return nil
+	}
+
+	//access tokens live no longer than one idle period
+	rev.RevokedAt = time.Now().UTC()
+	rev.ExpiresAt = rev.RevokedAt.Add(h.lifetime.Idle)
+	err := h.ss.Revoke(ctx, &rev)
+	if err != nil {
+		return errors.Wrap(err, "can't record revocation")
+	}
+
+	h.revoked.Add(rev)
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//allowSignIn answers 429 with Retry-After when the email or
+//the client IP has to wait before the next attempt. An allowed
+//attempt counts as failed until signInPassed or signInSucceeded.
+func (h *Handlers) allowSignIn(w http.ResponseWriter, r *http.Request, email, fn string) bool {
+	wait, err := h.lim.Allow(r.Context(), email, clientIP(r), time.Now().UTC())
+	if err != nil {
+		h.internal(w, r, "%s:: can't check attempts %s", fn, err)
+		return false
+	}
+
+	if wait == 0 {
+		return true
+	}
+
+	seconds := int64((wait + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	h.fail(w, r, http.StatusTooManyRequests, "too many attempts, try again later")
+	return false
+}
+
+//signInPassed is called when a factor is right, but another one is
+//still to be checked.
+func (h *Handlers) signInPassed(r *http.Request, email, fn string) {
+	err := h.lim.Release(r.Context(), email, clientIP(r))
+	if err != nil {
+		h.logger.Sugar().Warnf("%s:: %s", fn, err)
+	}
+}
+
+//signInSucceeded is called once every factor is checked.
+func (h *Handlers) signInSucceeded(r *http.Request, email, fn string) {
+	err := h.lim.Success(r.Context(), email, clientIP(r))
+	if err != nil {
+		h.logger.Sugar().Warnf("%s:: %s", fn, err)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"finPrj/internal/auth"
+	"finPrj/internal/storage"
+	"finPrj/internal/tokens"
+	"finPrj/internal/totp"
+	users "finPrj/internal/users"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	totpIssuer       = "finPrj"
+	purposeTOTPLogin = "signin-totp"
+	totpChallengeTTL = 5 * time.Minute
+)
+
+type totpRequest struct {
+	Challenge    string `json:"challenge"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+//newTOTPChallenge proves the password was right, so the second step
+//doesn't take it again. It is bound to the user and lives a few minutes.
+func (h *Handlers) newTOTPChallenge(user *users.User) (map[string]interface{}, error) {
+	timeNow := time.Now().UTC()
+	challenge, err := h.signer.Sign(tokens.Claims{
+		Subject:   user.ID,
+		Purpose:   purposeTOTPLogin,
+		IssuedAt:  timeNow.Unix(),
+		ExpiresAt: timeNow.Add(totpChallengeTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{"totp_required": true, "challenge": challenge}, nil
+}
+
+//checkSecondFactor accepts either a TOTP code newer than the last one
+//used or an unused recovery code, which is burned. It is called in
+//a transaction with user read in it, so two requests with one code
+//can't both see the old counter.
+func checkSecondFactor(ctx context.Context, us users.Storage, user *users.User,
+	code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		return us.UseRecoveryCode(ctx, user.ID, totp.HashRecoveryCode(recoveryCode))
+	}
+
+	counter, ok, err := totp.Validate(user.TOTPSecret, code, time.Now().UTC(), user.TOTPCounter)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	user.TOTPCounter = counter
+	return true, us.UpdateUser(ctx, user)
+}
+
+var (
+	//errTOTPDisabled ends a transaction that found TOTP turned off
+	errTOTPDisabled = errors.New("totp is not enabled")
+	//errTOTPEnabled ends a transaction that found TOTP already on
+	errTOTPEnabled = errors.New("totp is already enabled")
+	//errNoEnrollment ends a transaction that found nothing to confirm
+	errNoEnrollment = errors.New("no pending totp enrollment")
+)
+
+//SignInTOTP finishes the sign in of users with TOTP enabled.
+func (h *Handlers) SignInTOTP(w http.ResponseWriter, r *http.Request) {
+	request := totpRequest{}
+	if !h.decodeJSON(w, r, &request, "SignInTOTP") {
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+
+	var user *users.User
+	claims, err := h.signer.ParseFor(request.Challenge, purposeTOTPLogin, time.Now().UTC())
+	if err == nil {
+		user, err = h.us.GetByID(r.Context(), claims.Subject)
+		if err != nil {
+			h.internal(w, r, "SignInTOTP:: can't get user %s", err)
+			return
+		}
+	}
+
+	if user == nil || user.TOTPEnabledAt == nil {
+		h.fail(w, r, http.StatusUnauthorized, "invalid or expired challenge")
+		return
+	}
+
+	//codes are short, guessing them is throttled like passwords
+	if !h.allowSignIn(w, r, user.Email, "SignInTOTP") {
+		return
+	}
+
+	var ok bool
+	err = h.tx.InTx(r.Context(), func(tx storage.Tx) error {
+		us := tx.Users()
+		stored, err := us.GetByID(r.Context(), user.ID)
+		if err != nil {
+			return err
+		}
+		if stored == nil || stored.TOTPEnabledAt == nil {
+			ok = false
+			return nil
+		}
+
+		user = stored
+		ok, err = checkSecondFactor(r.Context(), us, user, request.Code, request.RecoveryCode)
+		return err
+	})
+	if err != nil {
+		h.internal(w, r, "SignInTOTP:: can't check code %s", err)
+		return
+	}
+
+	if !ok {
+		h.fail(w, r, http.StatusBadRequest, "wrong code")
+		return
+	}
+
+	h.signInSucceeded(r, user.Email, "SignInTOTP")
+
+	sessTokens, err := h.startSession(r, user)
+	if err != nil {
+		h.internal(w, r, "SignInTOTP:: can't start session %s", err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(sessTokens)
+	if err != nil {
+		h.logger.Sugar().Warnf("SignInTOTP:: can't parse tokens %s", err)
+	}
+}
+
+//EnrollTOTP creates a pending secret. TOTP isn't required
+//at sign in until the secret is confirmed with a code.
+func (h *Handlers) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		h.internal(w, r, "EnrollTOTP:: %s", err)
+		return
+	}
+
+	user, err := h.changeUser(r.Context(), auth.FromContext(r.Context()).UserID, func(user *users.User) error {
+		if user.TOTPEnabledAt != nil {
+			return errTOTPEnabled
+		}
+		user.TOTPSecret = secret
+		user.TOTPCounter = 0
+		return nil
+	})
+	switch {
+	case err == errTOTPEnabled:
+		h.fail(w, r, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		h.internal(w, r, "EnrollTOTP:: can't update user %s", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(map[string]string{
+		"secret": user.TOTPSecret,
+		"uri":    totp.URI(user.TOTPSecret, totpIssuer, user.Email),
+	})
+	if err != nil {
+		h.logger.Sugar().Warnf("EnrollTOTP:: can't parse secret %s", err)
+	}
+}
+
+//ConfirmTOTP enables TOTP and returns recovery codes.
+//They are shown only once and stored hashed.
+func (h *Handlers) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	request := totpRequest{}
+	if !h.decodeJSON(w, r, &request, "ConfirmTOTP") {
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+
+	codes, hashes, err := totp.NewRecoveryCodes()
+	if err != nil {
+		h.internal(w, r, "ConfirmTOTP:: %s", err)
+		return
+	}
+
+	//the codes and the enabled TOTP are stored together against
+	//the enrollment as it is, the user is read again on every attempt
+	var ok bool
+	err = h.tx.InTx(r.Context(), func(tx storage.Tx) error {
+		us := tx.Users()
+		user, err := us.GetByID(r.Context(), auth.FromContext(r.Context()).UserID)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return errNoUser
+		}
+		if user.TOTPEnabledAt != nil || user.TOTPSecret == "" {
+			return errNoEnrollment
+		}
+
+		timeNow := time.Now().UTC()
+		var counter int64
+		counter, ok, err = totp.Validate(user.TOTPSecret, request.Code, timeNow, 0)
+		if err != nil || !ok {
+			return err
+		}
+
+		err = us.ReplaceRecoveryCodes(r.Context(), user.ID, hashes)
+		if err != nil {
+			return errors.Wrap(err, "can't store recovery codes")
+		}
+
+		user.TOTPEnabledAt = &timeNow
+		user.TOTPCounter = counter
+		return us.UpdateUser(r.Context(), user)
+	})
+	switch {
+	case err == errNoEnrollment:
+		h.fail(w, r, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		h.internal(w, r, "ConfirmTOTP:: can't turn totp on %s", err)
+		return
+	case !ok:
+		h.fail(w, r, http.StatusBadRequest, "wrong code")
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+	if err != nil {
+		h.logger.Sugar().Warnf("ConfirmTOTP:: can't parse recovery codes %s", err)
+	}
+}
+
+//DisableTOTP turns TOTP off. It takes a current code or
+//a recovery code, a stolen session alone is not enough.
+func (h *Handlers) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	request := totpRequest{}
+	if !h.decodeJSON(w, r, &request, "DisableTOTP") {
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+
+	//the code is checked and TOTP turned off on the user as it is
+	//in the transaction, the user is read again on every attempt
+	var ok bool
+	err := h.tx.InTx(r.Context(), func(tx storage.Tx) error {
+		us := tx.Users()
+		user, err := us.GetByID(r.Context(), auth.FromContext(r.Context()).UserID)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return errNoUser
+		}
+		if user.TOTPEnabledAt == nil {
+			return errTOTPDisabled
+		}
+
+		ok, err = checkSecondFactor(r.Context(), us, user, request.Code, request.RecoveryCode)
+		if err != nil || !ok {
+			return err
+		}
+
+		err = us.ReplaceRecoveryCodes(r.Context(), user.ID, nil)
+		if err != nil {
+			return errors.Wrap(err, "can't delete recovery codes")
+		}
+
+		user.TOTPSecret = ""
+		user.TOTPEnabledAt = nil
+		user.TOTPCounter = 0
+		return us.UpdateUser(r.Context(), user)
+	})
+	switch {
+	case err == errTOTPDisabled:
+		h.fail(w, r, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		h.internal(w, r, "DisableTOTP:: can't turn totp off %s", err)
+		return
+	case !ok:
+		h.fail(w, r, http.StatusBadRequest, "wrong code")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
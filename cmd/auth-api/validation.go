@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	users "finPrj/internal/users"
+	"finPrj/internal/validation"
+	"net/http"
+)
+
+//decodeJSON answers 400 on malformed json and 422 when
+//a field has a wrong type or format.
+func (h *Handlers) decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}, fn string) bool {
+	err := json.NewDecoder(r.Body).Decode(dst)
+	if err == nil {
+		return true
+	}
+
+	errs := validation.Errors{}
+	switch e := err.(type) {
+	case *json.UnmarshalTypeError:
+		errs.Add(e.Field, validation.CodeType, e.Field+" must be "+e.Type.String())
+	default:
+		if err == users.ErrBirthdayFormat {
+			errs.Add("birthday", validation.CodeFormat, err.Error())
+			break
+		}
+
+		h.logger.Sugar().Warnf("%s:: can't parse json %s", fn, err)
+		h.problem(w, r, &Problem{Status: http.StatusBadRequest, Code: codeMalformed, Detail: "malformed json"})
+		return false
+	}
+
+	h.invalid(w, r, errs)
+	return false
+}
+
+//invalid answers 422 with the field errors in details,
+//errs is validation.Errors.
+func (h *Handlers) invalid(w http.ResponseWriter, r *http.Request, errs error) {
+	h.problem(w, r, &Problem{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    codeValidation,
+		Detail:  "request has invalid fields",
+		Details: errs,
+	})
+}
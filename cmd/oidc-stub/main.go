@@ -0,0 +1,261 @@
+//oidc-stub is an OIDC provider for local testing of single sign-on.
+//It signs in everyone without asking: the user is -email, or the
+//login_hint of the authorization request if one is given.
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"finPrj/internal/oidc"
+	"flag"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type grant struct {
+	redirectURI string
+	challenge   string
+	nonce       string
+	email       string
+	expiresAt   time.Time
+}
+
+type stub struct {
+	logger *zap.Logger
+
+	issuer        string
+	clientID      string
+	clientSecret  string
+	givenName     string
+	familyName    string
+	email         string
+	emailVerified bool
+
+	kid string
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]*grant
+}
+
+func main() {
+	s := &stub{grants: map[string]*grant{}}
+	addr := flag.String("addr", "localhost:9000", "listen address")
+	flag.StringVar(&s.issuer, "issuer", "http://localhost:9000", "issuer, must be the address clients use")
+	flag.StringVar(&s.clientID, "client-id", "auth-api", "the only accepted client")
+	flag.StringVar(&s.clientSecret, "client-secret", "secret", "secret of the client")
+	flag.StringVar(&s.email, "email", "stub@example.com", "email of the signed in user")
+	flag.StringVar(&s.givenName, "given-name", "Stub", "given name of the signed in user")
+	flag.StringVar(&s.familyName, "family-name", "User", "family name of the signed in user")
+	flag.BoolVar(&s.emailVerified, "email-verified", true, "whether the email is reported as verified")
+	flag.Parse()
+
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		log.Fatalf("can't create logger:: %s", err)
+	}
+	defer logger.Sync()
+	s.logger = logger
+
+	s.key, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		logger.Sugar().Fatalf("can't generate key:: %s", err)
+	}
+	s.kid, err = oidc.NewRandom()
+	if err != nil {
+		logger.Sugar().Fatalf("can't generate key id:: %s", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.Discovery)
+	mux.HandleFunc("/authorize", s.Authorize)
+	mux.HandleFunc("/token", s.Token)
+	mux.HandleFunc("/jwks", s.JWKS)
+
+	logger.Sugar().Infof("oidc stub %s listening on %s", s.issuer, *addr)
+	err = http.ListenAndServe(*addr, mux)
+	if err != nil {
+		logger.Sugar().Fatalf("can't listen:: %s", err)
+	}
+}
+
+func (s *stub) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		s.logger.Sugar().Warnf("can't write json %s", err)
+	}
+}
+
+func (s *stub) Discovery(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.issuer,
+		"authorization_endpoint":                s.issuer + "/authorize",
+		"token_endpoint":                        s.issuer + "/token",
+		"jwks_uri":                              s.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *stub) JWKS(w http.ResponseWriter, r *http.Request) {
+	pub := s.key.PublicKey
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kid": s.kid,
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+//Authorize redirects back at once with a code.
+func (s *stub) Authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || q.Get("redirect_uri") == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	back := url.Values{}
+	back.Set("state", q.Get("state"))
+
+	switch {
+	case q.Get("client_id") != s.clientID:
+		back.Set("error", "unauthorized_client")
+	case q.Get("response_type") != "code":
+		back.Set("error", "unsupported_response_type")
+	case q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256":
+		back.Set("error", "invalid_request")
+	default:
+		code, err := oidc.NewRandom()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		email := s.email
+		if hint := q.Get("login_hint"); hint != "" {
+			email = hint
+		}
+
+		s.mu.Lock()
+		s.grants[code] = &grant{
+			redirectURI: q.Get("redirect_uri"),
+			challenge:   q.Get("code_challenge"),
+			nonce:       q.Get("nonce"),
+			email:       email,
+			expiresAt:   time.Now().Add(time.Minute),
+		}
+		s.mu.Unlock()
+
+		back.Set("code", code)
+	}
+
+	redirect.RawQuery = back.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *stub) Token(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != s.clientID || secret != s.clientSecret {
+		s.writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	g := s.grants[code]
+	delete(s.grants, code)
+	s.mu.Unlock()
+
+	if r.PostForm.Get("grant_type") != "authorization_code" || g == nil ||
+		time.Now().After(g.expiresAt) || g.redirectURI != r.PostForm.Get("redirect_uri") ||
+		oidc.Challenge(r.PostForm.Get("code_verifier")) != g.challenge {
+		s.writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	idToken, err := s.sign(map[string]interface{}{
+		"iss":            s.issuer,
+		"sub":            "stub-" + g.email,
+		"aud":            s.clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          g.nonce,
+		"email":          g.email,
+		"email_verified": s.emailVerified,
+		"given_name":     s.givenName,
+		"family_name":    s.familyName,
+	})
+	if err != nil {
+		s.logger.Sugar().Errorf("can't sign id token %s", err)
+		s.writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	accessToken, err := oidc.NewRandom()
+	if err != nil {
+		s.writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (s *stub) sign(claims interface{}) (string, error) {
+	head, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": s.kid})
+	if err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	b64 := base64.RawURLEncoding
+	signingInput := b64.EncodeToString(head) + "." + b64.EncodeToString(body)
+	sum := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + b64.EncodeToString(sig), nil
+}
@@ -1,14 +1,16 @@
 module finPrj
 
-go 1.13
+go 1.16
 
 require (
 	github.com/go-chi/chi v4.1.1+incompatible
 	github.com/golang/protobuf v1.4.1
 	github.com/gorilla/websocket v1.4.2
 	github.com/lib/pq v1.5.1
+	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/pkg/errors v0.9.1
 	go.uber.org/zap v1.15.0
+	golang.org/x/crypto v0.0.0-20200510223506-06a226fb4e37
 	google.golang.org/grpc v1.29.1
 	google.golang.org/protobuf v1.22.0
 )
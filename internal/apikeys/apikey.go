@@ -0,0 +1,105 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//Prefix tells API keys from session bearers.
+//A key looks like fpk_<key id>_<secret>, only its hash is stored.
+const Prefix = "fpk_"
+
+type APIKey struct {
+	KeyID      string     `json:"key_id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	AllowedIPs []string   `json:"allowed_ips,omitempty"` //IPs or CIDRs, empty allows any
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+type Storage interface {
+	Create(ctx context.Context, key *APIKey) error
+	GetByHash(ctx context.Context, hash string) (*APIKey, error)
+	ListByUserID(ctx context.Context, userID int64) ([]APIKey, error)
+	Delete(ctx context.Context, userID int64, keyID string) (bool, error)
+	Touch(ctx context.Context, keyID string, usedAt time.Time) error
+}
+
+//New returns a new key and its id.
+func New() (key string, keyID string, err error) {
+	id := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", errors.Wrap(err, "can't generate key id")
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", errors.Wrap(err, "can't generate key")
+	}
+
+	keyID = hex.EncodeToString(id)
+	return Prefix + keyID + "_" + base64.RawURLEncoding.EncodeToString(secret), keyID, nil
+}
+
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, Prefix)
+}
+
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+func (k *APIKey) AllowsIP(ip string) bool {
+	if len(k.AllowedIPs) == 0 {
+		return true
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+
+	for _, allowed := range k.AllowedIPs {
+		if strings.Contains(allowed, "/") {
+			_, network, err := net.ParseCIDR(allowed)
+			if err == nil && network.Contains(addr) {
+				return true
+			}
+		} else if other := net.ParseIP(allowed); other != nil && other.Equal(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//ValidIPs checks an allow-list before it is stored.
+func ValidIPs(ips []string) error {
+	for _, ip := range ips {
+		if strings.Contains(ip, "/") {
+			if _, _, err := net.ParseCIDR(ip); err != nil {
+				return errors.Errorf("invalid CIDR %q", ip)
+			}
+		} else if net.ParseIP(ip) == nil {
+			return errors.Errorf("invalid IP %q", ip)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+)
+
+//ScopeAll is granted to sessions, they can do anything the user can.
+const ScopeAll = "*"
+
+//scopes that can be granted to API keys
+const (
+	ScopeRobotsRead     = "robots:read"
+	ScopeRobotsWrite    = "robots:write"
+	ScopeRobotsActivate = "robots:activate"
+)
+
+func ValidScope(scope string) bool {
+	return scope == ScopeRobotsRead || scope == ScopeRobotsWrite || scope == ScopeRobotsActivate
+}
+
+//Principal is who made the request.
+//It is resolved once per request and kept in its context.
+type Principal struct {
+	UserID    int64
+	SessionID string
+	APIKeyID  string //set instead of SessionID for API keys
+	Role      string
+	Scopes    []string
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == ScopeAll || s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+//FromContext returns nil for requests that were not authenticated.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
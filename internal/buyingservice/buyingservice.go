@@ -3,7 +3,6 @@ package buyingservice
 import (
 	context "context"
 	ft "finPrj/internal/fintech"
-	pg "finPrj/internal/postgres"
 	"finPrj/internal/robots"
 	"io"
 	sync "sync"
@@ -13,35 +12,39 @@ import (
 	grpc "google.golang.org/grpc"
 )
 
+//updateTimeout bounds one storage call, a stuck one must not
+//hold the prices of the ticker back.
+const updateTimeout = 5 * time.Second
+
 type RoboTrader struct {
 	IsBuying bool //false if is_selling
 	Robot    *robots.Robot
 }
 
-func (rt *RoboTrader) Buy(price float64, rs *pg.RobotStorage) error {
+func (rt *RoboTrader) Buy(ctx context.Context, price float64, rs robots.Storage) error {
 	rt.IsBuying = false
 	rt.Robot.FactYield -= price
-	err := rs.UpdateRobot(rt.Robot)
+	err := rs.UpdateRobot(ctx, rt.Robot)
 	return err
 }
 
-func (rt *RoboTrader) Sell(price float64, rs *pg.RobotStorage) error {
+func (rt *RoboTrader) Sell(ctx context.Context, price float64, rs robots.Storage) error {
 	rt.IsBuying = true
 	rt.Robot.FactYield += price
 	rt.Robot.DealsCount++
-	err := rs.UpdateRobot(rt.Robot)
+	err := rs.UpdateRobot(ctx, rt.Robot)
 	return err
 }
 
 type BuyingService struct {
 	logger *zap.Logger
-	rs     *pg.RobotStorage
+	rs     robots.Storage
 	robots map[string]map[int64]*RoboTrader
 	mutex  sync.Mutex
 	conn   *grpc.ClientConn
 }
 
-func NewBuyingService(logger *zap.Logger, rs *pg.RobotStorage, conn *grpc.ClientConn) *BuyingService {
+func NewBuyingService(logger *zap.Logger, rs robots.Storage, conn *grpc.ClientConn) *BuyingService {
 	return &BuyingService{
 		logger: logger,
 		rs:     rs,
@@ -57,10 +60,13 @@ func (wr *BuyingService) ActivateNewRobots(ctx context.Context) {
 		for {
 			select {
 			case <-sleeper:
-				robos, err := wr.rs.RobotsToRun()
+				runCtx, cancel := context.WithTimeout(ctx, updateTimeout)
+				robos, err := wr.rs.RobotsToRun(runCtx)
+				cancel()
 				if err != nil {
+					//the next tick tries again, one failed query must not stop trading
 					wr.logger.Sugar().Errorf("ActivateRobots:: can't activate robots %s", err)
-					return
+					continue
 				}
 
 				wr.mutex.Lock()
@@ -115,14 +121,14 @@ func (wr *BuyingService) ListenPrices(ctx context.Context, ticker string) {
 		for id, rs := range wr.robots[ticker] {
 			if rs.IsBuying {
 				if rs.Robot.BuyPrice >= price.GetBuyPrice() {
-					err = rs.Buy(price.GetBuyPrice(), wr.rs)
+					err = wr.trade(ctx, rs.Buy, price.GetBuyPrice())
 					if err != nil {
 						inactiveRobots = append(inactiveRobots, id)
 					}
 				}
 			} else {
 				if rs.Robot.SellPrice <= price.GetSellPrice() {
-					err = rs.Sell(price.GetSellPrice(), wr.rs)
+					err = wr.trade(ctx, rs.Sell, price.GetSellPrice())
 					if err != nil {
 						inactiveRobots = append(inactiveRobots, id)
 					}
@@ -144,6 +150,15 @@ func (wr *BuyingService) ListenPrices(ctx context.Context, ticker string) {
 	}
 }
 
+//trade runs a deal with its own deadline
+func (wr *BuyingService) trade(ctx context.Context,
+	deal func(ctx context.Context, price float64, rs robots.Storage) error, price float64) error {
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	return deal(ctx, price, wr.rs)
+}
+
 func (wr *BuyingService) DeleteRoboTraders(ticker string, inactiveUsers ...int64) {
 	wr.mutex.Lock()
 	defer wr.mutex.Unlock()
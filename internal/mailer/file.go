@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+//FileMailer appends messages to a file instead of sending them,
+//for local testing. Tokens can be copied from there.
+type FileMailer struct {
+	mu   sync.Mutex
+	path string
+	from string
+}
+
+func NewFileMailer(path, from string) *FileMailer {
+	return &FileMailer{path: path, from: from}
+}
+
+func (m *FileMailer) Send(msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "can't open mail file")
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(format(m.from, msg, time.Now()), '\r', '\n'))
+	if err != nil {
+		return errors.Wrapf(err, "can't write mail file")
+	}
+
+	return nil
+}
+
+//LogMailer writes messages to the log, it is the default
+//so the service runs without any mail setup.
+type LogMailer struct {
+	logger *zap.Logger
+}
+
+func NewLogMailer(logger *zap.Logger) *LogMailer {
+	return &LogMailer{logger: logger.Named("mailer")}
+}
+
+func (m *LogMailer) Send(msg *Message) error {
+	m.logger.Info("mail", zap.String("to", msg.To), zap.String("subject", msg.Subject),
+		zap.String("body", msg.Body))
+	return nil
+}
@@ -0,0 +1,35 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+//Mailer delivers messages. Send returns once the message is handed
+//over, delivery itself is not guaranteed.
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+//format renders msg in RFC 5322 form.
+func format(from string, msg *Message, date time.Time) []byte {
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	buf.WriteString(strings.Replace(msg.Body, "\n", "\r\n", -1))
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,51 @@
+package mailer
+
+import (
+	"net"
+	"net/smtp"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type SMTPConfig struct {
+	Addr     string //host:port
+	From     string
+	Username string
+	Password string
+}
+
+type SMTPMailer struct {
+	cfg  SMTPConfig
+	auth smtp.Auth
+}
+
+//NewSMTPMailer uses PLAIN auth when a username is given.
+//net/smtp upgrades to TLS if the server supports STARTTLS.
+func NewSMTPMailer(cfg SMTPConfig) (*SMTPMailer, error) {
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid smtp address %q", cfg.Addr)
+	}
+
+	if cfg.From == "" {
+		return nil, errors.New("smtp sender is required")
+	}
+
+	m := &SMTPMailer{cfg: cfg}
+	if cfg.Username != "" {
+		m.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+
+	return m, nil
+}
+
+func (m *SMTPMailer) Send(msg *Message) error {
+	err := smtp.SendMail(m.cfg.Addr, m.auth, m.cfg.From, []string{msg.To},
+		format(m.cfg.From, msg, time.Now()))
+	if err != nil {
+		return errors.Wrapf(err, "can't send mail to %s", msg.To)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"finPrj/internal/apikeys"
+
+	"github.com/pkg/errors"
+)
+
+var _ apikeys.Storage = &APIKeyStorage{}
+
+type APIKeyStorage struct {
+	mutex sync.RWMutex
+	keys  map[string]*apikeys.APIKey
+}
+
+func NewAPIKeyStorage() *APIKeyStorage {
+	return &APIKeyStorage{keys: make(map[string]*apikeys.APIKey)}
+}
+
+func copyAPIKey(key *apikeys.APIKey) apikeys.APIKey {
+	c := *key
+	c.Scopes = append([]string{}, key.Scopes...)
+	c.AllowedIPs = append([]string{}, key.AllowedIPs...)
+	c.ExpiresAt = copyTime(key.ExpiresAt)
+	c.LastUsedAt = copyTime(key.LastUsedAt)
+	return c
+}
+
+func (ks *APIKeyStorage) Create(ctx context.Context, key *apikeys.APIKey) error {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	if _, ok := ks.keys[key.KeyID]; ok {
+		return errors.Errorf("can't create api key: key %s exists", key.KeyID)
+	}
+	for _, other := range ks.keys {
+		if other.KeyHash == key.KeyHash {
+			return errors.New("can't create api key: key hash exists")
+		}
+	}
+
+	c := copyAPIKey(key)
+	c.LastUsedAt = nil
+	ks.keys[key.KeyID] = &c
+
+	return nil
+}
+
+func (ks *APIKeyStorage) GetByHash(ctx context.Context, hash string) (*apikeys.APIKey, error) {
+	ks.mutex.RLock()
+	defer ks.mutex.RUnlock()
+
+	for _, key := range ks.keys {
+		if key.KeyHash == hash {
+			c := copyAPIKey(key)
+			return &c, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (ks *APIKeyStorage) ListByUserID(ctx context.Context, userID int64) ([]apikeys.APIKey, error) {
+	ks.mutex.RLock()
+	defer ks.mutex.RUnlock()
+
+	keys := make([]apikeys.APIKey, 0)
+	for _, key := range ks.keys {
+		if key.UserID == userID {
+			keys = append(keys, copyAPIKey(key))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+
+	return keys, nil
+}
+
+//Delete returns false if the user has no such key.
+func (ks *APIKeyStorage) Delete(ctx context.Context, userID int64, keyID string) (bool, error) {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	key, ok := ks.keys[keyID]
+	if !ok || key.UserID != userID {
+		return false, nil
+	}
+
+	delete(ks.keys, keyID)
+	return true, nil
+}
+
+func (ks *APIKeyStorage) Touch(ctx context.Context, keyID string, usedAt time.Time) error {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	if key, ok := ks.keys[keyID]; ok {
+		key.LastUsedAt = &usedAt
+	}
+
+	return nil
+}
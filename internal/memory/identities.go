@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	users "finPrj/internal/users"
+)
+
+var _ users.IdentityStorage = &IdentityStorage{}
+
+type IdentityStorage struct {
+	mutex      sync.RWMutex
+	identities map[[2]string]users.Identity //by provider and subject
+}
+
+func NewIdentityStorage() *IdentityStorage {
+	return &IdentityStorage{identities: make(map[[2]string]users.Identity)}
+}
+
+//snapshot copies the stored identities, the returned func puts them back
+func (is *IdentityStorage) snapshot() func() {
+	is.mutex.RLock()
+	defer is.mutex.RUnlock()
+
+	identities := make(map[[2]string]users.Identity, len(is.identities))
+	for key, identity := range is.identities {
+		identities[key] = identity
+	}
+
+	return func() {
+		is.mutex.Lock()
+		defer is.mutex.Unlock()
+
+		is.identities = identities
+	}
+}
+
+func (is *IdentityStorage) Get(ctx context.Context, provider, subject string) (*users.Identity, error) {
+	is.mutex.RLock()
+	defer is.mutex.RUnlock()
+
+	identity, ok := is.identities[[2]string{provider, subject}]
+	if !ok {
+		return nil, nil
+	}
+
+	return &identity, nil
+}
+
+func (is *IdentityStorage) Create(ctx context.Context, identity *users.Identity) error {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+
+	key := [2]string{identity.Provider, identity.Subject}
+	if _, ok := is.identities[key]; ok {
+		return users.ErrIdentityLinked
+	}
+
+	is.identities[key] = *identity
+
+	return nil
+}
+
+func (is *IdentityStorage) ListByUserID(ctx context.Context, userID int64) ([]users.Identity, error) {
+	is.mutex.RLock()
+	defer is.mutex.RUnlock()
+
+	identities := make([]users.Identity, 0)
+	for _, identity := range is.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	sort.Slice(identities, func(i, j int) bool { return identities[i].CreatedAt.Before(identities[j].CreatedAt) })
+
+	return identities, nil
+}
@@ -0,0 +1,472 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	robots "finPrj/internal/robots"
+
+	"github.com/pkg/errors"
+)
+
+var _ robots.Storage = &RobotStorage{}
+
+//RobotStorage keeps robots in a map and publishes every change
+//to roboUpd like the postgres storage does, a nil channel
+//publishes nothing.
+type RobotStorage struct {
+	mutex   sync.RWMutex
+	nextID  int64
+	robots  map[int64]*robots.Robot
+	roboUpd chan<- *robots.Robot
+}
+
+func NewRobotStorage(roboUpd chan<- *robots.Robot) *RobotStorage {
+	return &RobotStorage{
+		robots:  make(map[int64]*robots.Robot),
+		roboUpd: roboUpd,
+	}
+}
+
+func copyRobot(robo *robots.Robot) robots.Robot {
+	c := *robo
+	c.PlanStart = copyTime(robo.PlanStart)
+	c.PlanEnd = copyTime(robo.PlanEnd)
+	c.DeletedAt = copyTime(robo.DeletedAt)
+	c.ActivatedAt = copyTime(robo.ActivatedAt)
+	c.DeactivatedAt = copyTime(robo.DeactivatedAt)
+	c.CreatedAt = copyTime(robo.CreatedAt)
+	c.Tags = append([]string{}, robo.Tags...)
+	return c
+}
+
+//snapshot copies the stored robots, the returned func puts them back.
+//Updates already published to roboUpd aren't taken back.
+func (rs *RobotStorage) snapshot() func() {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	robotsCopy := make(map[int64]*robots.Robot, len(rs.robots))
+	for id, robo := range rs.robots {
+		c := copyRobot(robo)
+		robotsCopy[id] = &c
+	}
+
+	return func() {
+		rs.mutex.Lock()
+		defer rs.mutex.Unlock()
+
+		rs.robots = robotsCopy
+	}
+}
+
+//notify is called without the mutex, readers of roboUpd
+//may call the storage
+func (rs *RobotStorage) notify(robo *robots.Robot) {
+	if rs.roboUpd != nil {
+		rs.roboUpd <- robo
+	}
+}
+
+//collect returns copies of the robots match accepts ordered by id
+func (rs *RobotStorage) collect(match func(robo *robots.Robot) bool) []robots.Robot {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	robotsList := make([]robots.Robot, 0)
+	for _, robo := range rs.robots {
+		if match(robo) {
+			robotsList = append(robotsList, copyRobot(robo))
+		}
+	}
+	sort.Slice(robotsList, func(i, j int) bool { return robotsList[i].RobotID < robotsList[j].RobotID })
+
+	return robotsList
+}
+
+//Create sets the id the storage assigned to the robot
+func (rs *RobotStorage) Create(ctx context.Context, robo *robots.Robot) error {
+	rs.mutex.Lock()
+	rs.nextID++
+	robo.RobotID = rs.nextID
+	stored := copyRobot(robo)
+	//deleted_at isn't inserted by the postgres storage either
+	stored.DeletedAt = nil
+	rs.robots[robo.RobotID] = &stored
+	rs.mutex.Unlock()
+
+	rs.notify(robo)
+
+	return nil
+}
+
+//we expect that one of ticker or id is not zero value
+//in other case you should use GetAllRobots
+func (rs *RobotStorage) GetByTickerAndOwnerID(ctx context.Context, ticker string, ownerID int64) ([]robots.Robot, error) {
+	return rs.collect(func(robo *robots.Robot) bool {
+		return (ticker == "" || robo.Ticker == ticker) && (ownerID == 0 || robo.OwnerUserID == ownerID)
+	}), nil
+}
+
+func (rs *RobotStorage) StreamByTickerAndOwnerID(ctx context.Context, ticker string, ownerID int64,
+	fn func(robo *robots.Robot) error) error {
+	robotsList, _ := rs.GetByTickerAndOwnerID(ctx, ticker, ownerID)
+	return stream(ctx, robotsList, fn)
+}
+
+func (rs *RobotStorage) GetByOwnerID(ctx context.Context, ownerID int64) ([]robots.Robot, error) {
+	return rs.collect(func(robo *robots.Robot) bool { return robo.OwnerUserID == ownerID }), nil
+}
+
+func (rs *RobotStorage) GetByRobotID(ctx context.Context, roboID int64) (*robots.Robot, error) {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	robo, ok := rs.robots[roboID]
+	if !ok {
+		return nil, nil
+	}
+
+	robot := copyRobot(robo)
+	return &robot, nil
+}
+
+func (rs *RobotStorage) GetAllRobots(ctx context.Context) ([]robots.Robot, error) {
+	return rs.collect(func(robo *robots.Robot) bool { return true }), nil
+}
+
+//List returns a page of robots and the cursor of the next page,
+//which is empty on the last page.
+func (rs *RobotStorage) List(ctx context.Context, filter *robots.Filter) ([]robots.Robot, string, error) {
+	robotsList, err := rs.list(filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if filter.Limit <= 0 || len(robotsList) <= filter.Limit {
+		return robotsList, "", nil
+	}
+
+	robotsList = robotsList[:filter.Limit]
+	return robotsList, filter.NextCursor(&robotsList[filter.Limit-1]), nil
+}
+
+//StreamList is List without pages calling fn robot by robot
+func (rs *RobotStorage) StreamList(ctx context.Context, filter *robots.Filter, fn func(robo *robots.Robot) error) error {
+	robotsList, err := rs.list(filter)
+	if err != nil {
+		return err
+	}
+
+	if filter.Limit > 0 && len(robotsList) > filter.Limit {
+		robotsList = robotsList[:filter.Limit]
+	}
+
+	return stream(ctx, robotsList, fn)
+}
+
+//list returns every robot of the filter after its cursor, in order
+func (rs *RobotStorage) list(filter *robots.Filter) ([]robots.Robot, error) {
+	var after *robots.Robot
+	if filter.After != nil {
+		var err error
+		after, err = cursorRobot(filter.Sort, filter.After)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	robotsList := rs.collect(func(robo *robots.Robot) bool {
+		if !matches(filter, robo) {
+			return false
+		}
+		if after == nil {
+			return true
+		}
+
+		cmp := compareRobots(filter.Sort, robo, after)
+		return (cmp > 0 && !filter.Desc) || (cmp < 0 && filter.Desc)
+	})
+
+	sort.SliceStable(robotsList, func(i, j int) bool {
+		cmp := compareRobots(filter.Sort, &robotsList[i], &robotsList[j])
+		if filter.Desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	return robotsList, nil
+}
+
+func matches(filter *robots.Filter, robo *robots.Robot) bool {
+	switch {
+	case filter.OwnerID != 0 && robo.OwnerUserID != filter.OwnerID,
+		filter.Ticker != "" && robo.Ticker != filter.Ticker,
+		filter.IsActive != nil && robo.IsActive != *filter.IsActive,
+		filter.IsFavourite != nil && robo.IsFavourite != *filter.IsFavourite,
+		filter.Deleted != nil && (robo.DeletedAt != nil) != *filter.Deleted:
+		return false
+	}
+
+	//like SQL, a range never matches an unset time
+	inTimeRange := func(t, from, to *time.Time) bool {
+		if from == nil && to == nil {
+			return true
+		}
+		return t != nil && (from == nil || !t.Before(*from)) && (to == nil || !t.After(*to))
+	}
+	inRange := func(v float64, min, max *float64) bool {
+		return (min == nil || v >= *min) && (max == nil || v <= *max)
+	}
+
+	return inTimeRange(robo.PlanStart, filter.PlanStartFrom, filter.PlanStartTo) &&
+		inTimeRange(robo.PlanEnd, filter.PlanEndFrom, filter.PlanEndTo) &&
+		inRange(robo.PlanYield, filter.MinPlanYield, filter.MaxPlanYield) &&
+		inRange(robo.FactYield, filter.MinFactYield, filter.MaxFactYield)
+}
+
+//compareRobots orders by the sort key, then by robot_id
+func compareRobots(sortKey string, a, b *robots.Robot) int {
+	cmp := 0
+	switch sortKey {
+	case robots.SortCreatedAt:
+		cmp = compareTimes(createdAt(a), createdAt(b))
+	case robots.SortTicker:
+		cmp = strings.Compare(a.Ticker, b.Ticker)
+	case robots.SortBuyPrice:
+		cmp = compareFloats(a.BuyPrice, b.BuyPrice)
+	case robots.SortSellPrice:
+		cmp = compareFloats(a.SellPrice, b.SellPrice)
+	case robots.SortPlanYield:
+		cmp = compareFloats(a.PlanYield, b.PlanYield)
+	case robots.SortFactYield:
+		cmp = compareFloats(a.FactYield, b.FactYield)
+	case robots.SortDealsCounts:
+		cmp = compareInts(a.DealsCount, b.DealsCount)
+	}
+	if cmp != 0 {
+		return cmp
+	}
+
+	return compareInts(a.RobotID, b.RobotID)
+}
+
+//unset created_at sorts as the zero unix time
+func createdAt(robo *robots.Robot) time.Time {
+	if robo.CreatedAt == nil {
+		return time.Unix(0, 0).UTC()
+	}
+	return *robo.CreatedAt
+}
+
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+//cursorRobot is a robot with the sort key and id of the cursor,
+//the page starts right after it.
+func cursorRobot(sortKey string, cursor *robots.Cursor) (*robots.Robot, error) {
+	robo := &robots.Robot{RobotID: cursor.ID}
+
+	var err error
+	switch sortKey {
+	case robots.SortCreatedAt:
+		var t time.Time
+		t, err = time.Parse(time.RFC3339Nano, cursor.Value)
+		robo.CreatedAt = &t
+	case robots.SortTicker:
+		robo.Ticker = cursor.Value
+	case robots.SortBuyPrice:
+		robo.BuyPrice, err = strconv.ParseFloat(cursor.Value, 64)
+	case robots.SortSellPrice:
+		robo.SellPrice, err = strconv.ParseFloat(cursor.Value, 64)
+	case robots.SortPlanYield:
+		robo.PlanYield, err = strconv.ParseFloat(cursor.Value, 64)
+	case robots.SortFactYield:
+		robo.FactYield, err = strconv.ParseFloat(cursor.Value, 64)
+	case robots.SortDealsCounts:
+		robo.DealsCount, err = strconv.ParseInt(cursor.Value, 10, 64)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(robots.ErrCursor, "can't read cursor value %q", cursor.Value)
+	}
+
+	return robo, nil
+}
+
+//Search ranks robots like the postgres storage does, owners are
+//never matched because users are kept by another storage.
+func (rs *RobotStorage) Search(ctx context.Context, search *robots.Search) ([]robots.SearchHit, string, error) {
+	var afterRank float64
+	if search.After != nil {
+		var err error
+		afterRank, err = strconv.ParseFloat(search.After.Value, 64)
+		if err != nil {
+			return nil, "", errors.Wrapf(robots.ErrCursor, "can't read cursor value %q", search.After.Value)
+		}
+	}
+
+	q := strings.ToLower(search.Query)
+	hits := make([]robots.SearchHit, 0)
+	for _, robo := range rs.collect(func(robo *robots.Robot) bool {
+		return robo.DeletedAt == nil && (search.OwnerID == 0 || robo.OwnerUserID == search.OwnerID)
+	}) {
+		rank := searchRank(&robo, q)
+		if rank == 0 {
+			continue
+		}
+		if search.After != nil && (rank > afterRank || rank == afterRank && robo.RobotID >= search.After.ID) {
+			continue
+		}
+
+		hits = append(hits, robots.SearchHit{Robot: robo, Rank: rank})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Rank != hits[j].Rank {
+			return hits[i].Rank > hits[j].Rank
+		}
+		return hits[i].RobotID > hits[j].RobotID
+	})
+
+	if len(hits) <= search.Limit {
+		return hits, "", nil
+	}
+
+	hits = hits[:search.Limit]
+	return hits, search.NextCursor(&hits[search.Limit-1]), nil
+}
+
+//searchRank is 1 for the exact ticker, 0.8 for a ticker prefix,
+//0.6 for a tag and 0 if nothing matches
+func searchRank(robo *robots.Robot, q string) float64 {
+	ticker := strings.ToLower(robo.Ticker)
+	switch {
+	case ticker == q:
+		return 1
+	case strings.HasPrefix(ticker, q):
+		return 0.8
+	}
+
+	for _, tag := range robo.Tags {
+		if tag == q {
+			return 0.6
+		}
+	}
+
+	return 0
+}
+
+//update runs change on the stored robot and publishes robo,
+//there is nothing to change if the robot doesn't exist.
+func (rs *RobotStorage) update(robo *robots.Robot, change func(stored *robots.Robot)) {
+	rs.mutex.Lock()
+	if stored, ok := rs.robots[robo.RobotID]; ok {
+		change(stored)
+	}
+	rs.mutex.Unlock()
+
+	rs.notify(robo)
+}
+
+//expects that all field are filled with current data
+func (rs *RobotStorage) UpdateRobot(ctx context.Context, robo *robots.Robot) error {
+	rs.update(robo, func(stored *robots.Robot) {
+		kept := *stored
+		*stored = copyRobot(robo)
+		stored.DeletedAt = kept.DeletedAt
+		stored.IsActive = kept.IsActive
+		stored.ActivatedAt = kept.ActivatedAt
+		stored.DeactivatedAt = kept.DeactivatedAt
+	})
+
+	return nil
+}
+
+func (rs *RobotStorage) ActivateRobot(ctx context.Context, robo *robots.Robot) error {
+	timeNow := time.Now().UTC()
+	robo.ActivatedAt = &timeNow
+	robo.IsActive = true
+	rs.update(robo, func(stored *robots.Robot) {
+		stored.IsActive = true
+		stored.ActivatedAt = copyTime(&timeNow)
+	})
+
+	return nil
+}
+
+func (rs *RobotStorage) DeactivateRobot(ctx context.Context, robo *robots.Robot) error {
+	timeNow := time.Now().UTC()
+	robo.DeactivatedAt = &timeNow
+	robo.IsActive = false
+	rs.update(robo, func(stored *robots.Robot) {
+		stored.IsActive = false
+		stored.DeactivatedAt = copyTime(&timeNow)
+	})
+
+	return nil
+}
+
+func (rs *RobotStorage) DeleteRobot(ctx context.Context, robo *robots.Robot) error {
+	timeNow := time.Now().UTC()
+	robo.DeletedAt = &timeNow
+	rs.update(robo, func(stored *robots.Robot) {
+		stored.DeletedAt = copyTime(&timeNow)
+	})
+
+	return nil
+}
+
+func (rs *RobotStorage) RobotsToRun(ctx context.Context) ([]robots.Robot, error) {
+	timeNow := time.Now().UTC()
+	return rs.collect(func(robo *robots.Robot) bool {
+		planned := robo.PlanStart != nil && robo.PlanEnd != nil &&
+			robo.PlanStart.Before(timeNow) && timeNow.Before(*robo.PlanEnd)
+		return robo.DeletedAt == nil && (planned || robo.IsActive)
+	}), nil
+}
+
+//stream calls fn for every robot until fn fails or ctx is done
+func stream(ctx context.Context, robotsList []robots.Robot, fn func(robo *robots.Robot) error) error {
+	for i := range robotsList {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(&robotsList[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
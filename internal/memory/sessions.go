@@ -0,0 +1,291 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	sessions "finPrj/internal/sessions"
+
+	"github.com/pkg/errors"
+)
+
+var _ sessions.Storage = &SessionStorage{}
+
+//SessionStorage keeps sessions, their refresh tokens and revocations.
+//Refresh tokens go away with their session.
+type SessionStorage struct {
+	mutex       sync.RWMutex
+	sessions    map[string]*sessions.Session
+	refresh     map[string]*sessions.RefreshToken
+	revocations []sessions.Revocation
+}
+
+func NewSessionStorage() *SessionStorage {
+	return &SessionStorage{
+		sessions: make(map[string]*sessions.Session),
+		refresh:  make(map[string]*sessions.RefreshToken),
+	}
+}
+
+//snapshot copies the stored sessions, the returned func puts them back
+func (ss *SessionStorage) snapshot() func() {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+
+	sessionsCopy := make(map[string]*sessions.Session, len(ss.sessions))
+	for id, sess := range ss.sessions {
+		c := *sess
+		sessionsCopy[id] = &c
+	}
+	refresh := make(map[string]*sessions.RefreshToken, len(ss.refresh))
+	for hash, rt := range ss.refresh {
+		c := *rt
+		c.UsedAt = copyTime(rt.UsedAt)
+		refresh[hash] = &c
+	}
+	revocations := append([]sessions.Revocation{}, ss.revocations...)
+
+	return func() {
+		ss.mutex.Lock()
+		defer ss.mutex.Unlock()
+
+		ss.sessions, ss.refresh, ss.revocations = sessionsCopy, refresh, revocations
+	}
+}
+
+func (ss *SessionStorage) Create(ctx context.Context, sess *sessions.Session) error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	if _, ok := ss.sessions[sess.SessionID]; ok {
+		return errors.Errorf("can't create session: session %s exists", sess.SessionID)
+	}
+	if ss.byTokenHash(sess.TokenHash) != nil {
+		return errors.New("can't create session: token hash exists")
+	}
+
+	c := *sess
+	ss.sessions[sess.SessionID] = &c
+
+	return nil
+}
+
+//byTokenHash must be called with the mutex held
+func (ss *SessionStorage) byTokenHash(hash string) *sessions.Session {
+	for _, sess := range ss.sessions {
+		if sess.TokenHash == hash {
+			return sess
+		}
+	}
+	return nil
+}
+
+//delete must be called with the mutex held
+func (ss *SessionStorage) delete(sessionID string) {
+	delete(ss.sessions, sessionID)
+	for hash, rt := range ss.refresh {
+		if rt.SessionID == sessionID {
+			delete(ss.refresh, hash)
+		}
+	}
+}
+
+func (ss *SessionStorage) DeleteByUserID(ctx context.Context, userID int64) error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	for id, sess := range ss.sessions {
+		if sess.UserID == userID {
+			ss.delete(id)
+		}
+	}
+
+	return nil
+}
+
+func (ss *SessionStorage) DeleteByTokenHash(ctx context.Context, hash string) error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	if sess := ss.byTokenHash(hash); sess != nil {
+		ss.delete(sess.SessionID)
+	}
+
+	return nil
+}
+
+func (ss *SessionStorage) DeleteBySessionID(ctx context.Context, sessionID string) error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	ss.delete(sessionID)
+
+	return nil
+}
+
+func (ss *SessionStorage) GetBySessionID(ctx context.Context, sessionID string) (*sessions.Session, error) {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+
+	sess, ok := ss.sessions[sessionID]
+	if !ok {
+		return nil, nil
+	}
+
+	c := *sess
+	return &c, nil
+}
+
+func (ss *SessionStorage) GetByTokenHash(ctx context.Context, hash string) (*sessions.Session, error) {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+
+	sess := ss.byTokenHash(hash)
+	if sess == nil {
+		return nil, nil
+	}
+
+	c := *sess
+	return &c, nil
+}
+
+//ListByUserID returns the most recently seen sessions first
+func (ss *SessionStorage) ListByUserID(ctx context.Context, userID int64) ([]sessions.Session, error) {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+
+	sessList := make([]sessions.Session, 0)
+	for _, sess := range ss.sessions {
+		if sess.UserID == userID {
+			sessList = append(sessList, *sess)
+		}
+	}
+	sort.Slice(sessList, func(i, j int) bool { return sessList[i].LastSeenAt.After(sessList[j].LastSeenAt) })
+
+	return sessList, nil
+}
+
+//Touch saves LastSeenAt, IP, UserAgent and ValidUntil of the session.
+func (ss *SessionStorage) Touch(ctx context.Context, sess *sessions.Session) error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	if stored, ok := ss.sessions[sess.SessionID]; ok {
+		stored.LastSeenAt = sess.LastSeenAt
+		stored.IP = sess.IP
+		stored.UserAgent = sess.UserAgent
+		stored.ValidUntil = sess.ValidUntil
+	}
+
+	return nil
+}
+
+//Rotate replaces the bearer of the session, the old one stops working.
+func (ss *SessionStorage) Rotate(ctx context.Context, sess *sessions.Session) error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	stored, ok := ss.sessions[sess.SessionID]
+	if !ok {
+		return nil
+	}
+	if other := ss.byTokenHash(sess.TokenHash); other != nil && other != stored {
+		return errors.Errorf("can't rotate session %s: token hash exists", sess.SessionID)
+	}
+
+	stored.TokenHash = sess.TokenHash
+	stored.LastSeenAt = sess.LastSeenAt
+	stored.ValidUntil = sess.ValidUntil
+
+	return nil
+}
+
+func (ss *SessionStorage) CreateRefreshToken(ctx context.Context, rt *sessions.RefreshToken) error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	if _, ok := ss.sessions[rt.SessionID]; !ok {
+		return errors.Errorf("can't create refresh token: no session %s", rt.SessionID)
+	}
+	if _, ok := ss.refresh[rt.TokenHash]; ok {
+		return errors.New("can't create refresh token: token hash exists")
+	}
+
+	c := *rt
+	c.UsedAt = nil
+	ss.refresh[rt.TokenHash] = &c
+
+	return nil
+}
+
+func (ss *SessionStorage) GetRefreshToken(ctx context.Context, hash string) (*sessions.RefreshToken, error) {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+
+	rt, ok := ss.refresh[hash]
+	if !ok {
+		return nil, nil
+	}
+
+	c := *rt
+	c.UsedAt = copyTime(rt.UsedAt)
+	return &c, nil
+}
+
+//UseRefreshToken marks the token as used.
+//It returns false if the token was already used, even concurrently.
+func (ss *SessionStorage) UseRefreshToken(ctx context.Context, hash string, usedAt time.Time) (bool, error) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	rt, ok := ss.refresh[hash]
+	if !ok || rt.UsedAt != nil {
+		return false, nil
+	}
+
+	rt.UsedAt = &usedAt
+	return true, nil
+}
+
+func (ss *SessionStorage) Revoke(ctx context.Context, rev *sessions.Revocation) error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	//a session revoked twice keeps its first revocation
+	if rev.SessionID != "" {
+		for _, old := range ss.revocations {
+			if old.SessionID == rev.SessionID {
+				return nil
+			}
+		}
+	}
+
+	ss.revocations = append(ss.revocations, *rev)
+
+	return nil
+}
+
+//RevocationsSince skips and forgets the expired revocations.
+func (ss *SessionStorage) RevocationsSince(ctx context.Context, since time.Time) ([]sessions.Revocation, error) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	timeNow := time.Now().UTC()
+	revs := make([]sessions.Revocation, 0)
+	kept := ss.revocations[:0]
+	for _, rev := range ss.revocations {
+		if !rev.ExpiresAt.After(timeNow) {
+			continue
+		}
+
+		kept = append(kept, rev)
+		if rev.RevokedAt.After(since) {
+			revs = append(revs, rev)
+		}
+	}
+	ss.revocations = kept
+
+	return revs, nil
+}
@@ -0,0 +1,22 @@
+package memory
+
+import (
+	"testing"
+
+	"finPrj/internal/storagetest"
+)
+
+func newStorages(t *testing.T) storagetest.Storages {
+	us, is, ss, rs := NewUserStorage(), NewIdentityStorage(), NewSessionStorage(), NewRobotStorage(nil)
+	return storagetest.Storages{
+		Users:      us,
+		Identities: is,
+		Sessions:   ss,
+		Robots:     rs,
+		Transactor: NewTransactor(us, is, ss, rs),
+	}
+}
+
+func TestStorages(t *testing.T) {
+	storagetest.Run(t, newStorages)
+}
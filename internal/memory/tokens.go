@@ -0,0 +1,40 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"finPrj/internal/tokens"
+)
+
+var _ tokens.UsedStorage = &UsedTokenStorage{}
+
+type UsedTokenStorage struct {
+	mutex sync.Mutex
+	used  map[string]time.Time //expiry by token id
+}
+
+func NewUsedTokenStorage() *UsedTokenStorage {
+	return &UsedTokenStorage{used: make(map[string]time.Time)}
+}
+
+func (ts *UsedTokenStorage) Use(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	//tokens are used rarely, so expired ones are dropped on the way
+	timeNow := time.Now().UTC()
+	for id, exp := range ts.used {
+		if exp.Before(timeNow) {
+			delete(ts.used, id)
+		}
+	}
+
+	if _, ok := ts.used[tokenID]; ok {
+		return false, nil
+	}
+
+	ts.used[tokenID] = expiresAt
+	return true, nil
+}
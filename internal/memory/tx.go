@@ -0,0 +1,61 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	robots "finPrj/internal/robots"
+	sessions "finPrj/internal/sessions"
+	"finPrj/internal/storage"
+	users "finPrj/internal/users"
+)
+
+var _ storage.Transactor = &Transactor{}
+
+//Transactor runs units of work one at a time. The storages are
+//copied before fn and put back if it fails.
+type Transactor struct {
+	mutex sync.Mutex
+	tx    tx
+}
+
+type tx struct {
+	us *UserStorage
+	is *IdentityStorage
+	ss *SessionStorage
+	rs *RobotStorage
+}
+
+func (tx tx) Users() users.Storage              { return tx.us }
+func (tx tx) Identities() users.IdentityStorage { return tx.is }
+func (tx tx) Sessions() sessions.Storage        { return tx.ss }
+func (tx tx) Robots() robots.Storage            { return tx.rs }
+
+func NewTransactor(us *UserStorage, is *IdentityStorage, ss *SessionStorage, rs *RobotStorage) *Transactor {
+	return &Transactor{tx: tx{us: us, is: is, ss: ss, rs: rs}}
+}
+
+func (t *Transactor) InTx(ctx context.Context, fn func(tx storage.Tx) error) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	restore := []func(){
+		t.tx.us.snapshot(),
+		t.tx.is.snapshot(),
+		t.tx.ss.snapshot(),
+		t.tx.rs.snapshot(),
+	}
+
+	err := fn(t.tx)
+	if err != nil {
+		for _, r := range restore {
+			r()
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,183 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	users "finPrj/internal/users"
+)
+
+var _ users.Storage = &UserStorage{}
+
+//UserStorage keeps users in maps. Users are copied in and out,
+//changing a returned user changes nothing until UpdateUser.
+type UserStorage struct {
+	mutex  sync.RWMutex
+	nextID int64
+	users  map[int64]*users.User
+	//recovery codes by user and hash, nil for unused ones
+	codes map[int64]map[string]*time.Time
+}
+
+func NewUserStorage() *UserStorage {
+	return &UserStorage{
+		users: make(map[int64]*users.User),
+		codes: make(map[int64]map[string]*time.Time),
+	}
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+func copyUser(user *users.User) *users.User {
+	c := *user
+	c.Birthday = copyTime(user.Birthday)
+	c.EmailVerifiedAt = copyTime(user.EmailVerifiedAt)
+	c.TOTPEnabledAt = copyTime(user.TOTPEnabledAt)
+	return &c
+}
+
+//snapshot copies the stored users, the returned func puts them back.
+//Ids are not given back, like sequences of a database.
+func (us *UserStorage) snapshot() func() {
+	us.mutex.RLock()
+	defer us.mutex.RUnlock()
+
+	usersCopy := make(map[int64]*users.User, len(us.users))
+	for id, user := range us.users {
+		usersCopy[id] = copyUser(user)
+	}
+	codesCopy := make(map[int64]map[string]*time.Time, len(us.codes))
+	for id, codes := range us.codes {
+		c := make(map[string]*time.Time, len(codes))
+		for hash, usedAt := range codes {
+			c[hash] = copyTime(usedAt)
+		}
+		codesCopy[id] = c
+	}
+
+	return func() {
+		us.mutex.Lock()
+		defer us.mutex.Unlock()
+
+		us.users, us.codes = usersCopy, codesCopy
+	}
+}
+
+//emailTaken must be called with the mutex held
+func (us *UserStorage) emailTaken(email string, id int64) bool {
+	for _, user := range us.users {
+		if user.Email == email && user.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+//Create sets the id the storage assigned to the user
+func (us *UserStorage) Create(ctx context.Context, user *users.User) error {
+	us.mutex.Lock()
+	defer us.mutex.Unlock()
+
+	if us.emailTaken(user.Email, 0) {
+		return users.ErrEmailTaken
+	}
+
+	us.nextID++
+	user.ID = us.nextID
+	us.users[user.ID] = copyUser(user)
+
+	return nil
+}
+
+func (us *UserStorage) GetByID(ctx context.Context, id int64) (*users.User, error) {
+	us.mutex.RLock()
+	defer us.mutex.RUnlock()
+
+	user, ok := us.users[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return copyUser(user), nil
+}
+
+func (us *UserStorage) GetByEmail(ctx context.Context, email string) (*users.User, error) {
+	us.mutex.RLock()
+	defer us.mutex.RUnlock()
+
+	for _, user := range us.users {
+		if user.Email == email {
+			return copyUser(user), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (us *UserStorage) GetAll(ctx context.Context) ([]users.User, error) {
+	us.mutex.RLock()
+	defer us.mutex.RUnlock()
+
+	usersList := make([]users.User, 0, len(us.users))
+	for _, user := range us.users {
+		usersList = append(usersList, *copyUser(user))
+	}
+	sort.Slice(usersList, func(i, j int) bool { return usersList[i].ID < usersList[j].ID })
+
+	return usersList, nil
+}
+
+//UpdateUser does nothing if there is no such user, as an UPDATE would
+func (us *UserStorage) UpdateUser(ctx context.Context, user *users.User) error {
+	us.mutex.Lock()
+	defer us.mutex.Unlock()
+
+	if _, ok := us.users[user.ID]; !ok {
+		return nil
+	}
+	if us.emailTaken(user.Email, user.ID) {
+		return users.ErrEmailTaken
+	}
+
+	us.users[user.ID] = copyUser(user)
+
+	return nil
+}
+
+//ReplaceRecoveryCodes drops all codes of the user, used or not.
+func (us *UserStorage) ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes []string) error {
+	us.mutex.Lock()
+	defer us.mutex.Unlock()
+
+	codes := make(map[string]*time.Time, len(hashes))
+	for _, hash := range hashes {
+		codes[hash] = nil
+	}
+	us.codes[userID] = codes
+
+	return nil
+}
+
+//UseRecoveryCode returns false if there is no such unused code.
+func (us *UserStorage) UseRecoveryCode(ctx context.Context, userID int64, hash string) (bool, error) {
+	us.mutex.Lock()
+	defer us.mutex.Unlock()
+
+	usedAt, ok := us.codes[userID][hash]
+	if !ok || usedAt != nil {
+		return false, nil
+	}
+
+	timeNow := time.Now().UTC()
+	us.codes[userID][hash] = &timeNow
+
+	return true, nil
+}
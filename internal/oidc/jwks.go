@@ -0,0 +1,157 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrMalformed = errors.New("malformed id token")
+	ErrSignature = errors.New("invalid id token signature")
+)
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+//keySet caches the RSA keys of a provider. Keys are fetched
+//again when a token is signed with an unknown kid, that is
+//how providers rotate them.
+type keySet struct {
+	client *http.Client
+	url    string
+
+	mu   sync.Mutex
+	keys map[string]*rsa.PublicKey
+}
+
+func (ks *keySet) get(kid string) (*rsa.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if key, ok := ks.keys[kid]; ok {
+		return key, nil
+	}
+
+	keys, err := ks.fetch()
+	if err != nil {
+		return nil, err
+	}
+	ks.keys = keys
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, ErrSignature
+	}
+	return key, nil
+}
+
+func (ks *keySet) fetch() (map[string]*rsa.PublicKey, error) {
+	resp, err := ks.client.Get(ks.url)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't fetch jwks")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("can't fetch jwks: status %d", resp.StatusCode)
+	}
+
+	doc := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't parse jwks")
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range doc.Keys {
+		//other key types are skipped, only RS256 is supported
+		if k.Kty != "RSA" || (k.Alg != "" && k.Alg != "RS256") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid modulus of key %s", k.Kid)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid exponent of key %s", k.Kid)
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	return keys, nil
+}
+
+//verify checks the RS256 signature of token and decodes its claims into dst.
+func (ks *keySet) verify(token string, dst interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrMalformed
+	}
+
+	headData, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return ErrMalformed
+	}
+
+	head := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	err = json.Unmarshal(headData, &head)
+	if err != nil {
+		return ErrMalformed
+	}
+
+	if head.Alg != "RS256" {
+		return ErrSignature
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return ErrMalformed
+	}
+
+	key, err := ks.get(head.Kid)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig) != nil {
+		return ErrSignature
+	}
+
+	body, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ErrMalformed
+	}
+
+	err = json.Unmarshal(body, dst)
+	if err != nil {
+		return ErrMalformed
+	}
+
+	return nil
+}
@@ -0,0 +1,252 @@
+package oidc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrIssuer   = errors.New("id token issued by another provider")
+	ErrAudience = errors.New("id token issued for another client")
+	ErrExpired  = errors.New("id token expired")
+	ErrNonce    = errors.New("id token nonce mismatch")
+)
+
+//Config of one identity provider. RedirectURL must be
+//registered at the provider as is.
+type Config struct {
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+}
+
+//LoadConfigs reads a JSON list of providers. Providers without
+//redirect_url get publicURL/api/v1/oauth/{name}/callback.
+func LoadConfigs(path, publicURL string) ([]Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read providers file")
+	}
+
+	cfgs := []Config{}
+	err = json.Unmarshal(data, &cfgs)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't parse providers file")
+	}
+
+	for i := range cfgs {
+		if cfgs[i].Name == "" || cfgs[i].Issuer == "" || cfgs[i].ClientID == "" {
+			return nil, errors.Errorf("provider %d: name, issuer and client_id are required", i)
+		}
+		if cfgs[i].RedirectURL == "" {
+			cfgs[i].RedirectURL = publicURL + "/api/v1/oauth/" + cfgs[i].Name + "/callback"
+		}
+		if len(cfgs[i].Scopes) == 0 {
+			cfgs[i].Scopes = []string{"openid", "email", "profile"}
+		}
+	}
+
+	return cfgs, nil
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+//Provider runs the authorization code flow with PKCE against one
+//identity provider. The discovery document is fetched on first use,
+//so the service starts even if the provider is down.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu   sync.Mutex
+	doc  *discovery
+	keys *keySet
+}
+
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &Provider{cfg: cfg, client: client}
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *Provider) discover() (*discovery, *keySet, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.doc != nil {
+		return p.doc, p.keys, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	resp, err := p.client.Get(wellKnown)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "can't discover %s", p.cfg.Name)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, errors.Errorf("can't discover %s: status %d", p.cfg.Name, resp.StatusCode)
+	}
+
+	doc := discovery{}
+	err = json.NewDecoder(resp.Body).Decode(&doc)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "can't parse discovery of %s", p.cfg.Name)
+	}
+
+	if doc.Issuer != p.cfg.Issuer {
+		return nil, nil, errors.Errorf("%s: discovered issuer %q, configured %q",
+			p.cfg.Name, doc.Issuer, p.cfg.Issuer)
+	}
+
+	p.doc = &doc
+	p.keys = &keySet{client: p.client, url: doc.JWKSURI}
+	return p.doc, p.keys, nil
+}
+
+//AuthCodeURL is where the user is sent to sign in.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) (string, error) {
+	doc, _, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", Challenge(verifier))
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return doc.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+//audience is a string or a list of strings in id tokens
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if json.Unmarshal(data, &one) == nil {
+		*a = audience{one}
+		return nil
+	}
+
+	var many []string
+	err := json.Unmarshal(data, &many)
+	if err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+//IDToken holds the claims we use from a verified id token.
+type IDToken struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	Expiry        int64    `json:"exp"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	GivenName     string   `json:"given_name"`
+	FamilyName    string   `json:"family_name"`
+}
+
+//Exchange redeems the code and returns the verified id token.
+func (p *Provider) Exchange(code, verifier, nonce string) (*IDToken, error) {
+	doc, keys, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequest(http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create token request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't exchange code")
+	}
+	defer resp.Body.Close()
+
+	body := struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't parse token response")
+	}
+
+	if resp.StatusCode != http.StatusOK || body.IDToken == "" {
+		return nil, errors.Errorf("can't exchange code: %d %s %s",
+			resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+
+	token := IDToken{}
+	err = keys.verify(body.IDToken, &token)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.Issuer != p.cfg.Issuer {
+		return nil, ErrIssuer
+	}
+
+	found := false
+	for _, aud := range token.Audience {
+		found = found || aud == p.cfg.ClientID
+	}
+	if !found {
+		return nil, ErrAudience
+	}
+
+	if time.Now().Unix() >= token.Expiry {
+		return nil, ErrExpired
+	}
+
+	if token.Nonce != nonce {
+		return nil, ErrNonce
+	}
+
+	return &token, nil
+}
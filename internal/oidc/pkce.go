@@ -0,0 +1,26 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+)
+
+//NewRandom returns 32 random bytes in base64url,
+//used for state, nonce and PKCE verifiers.
+func NewRandom() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "can't generate random value")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+//Challenge is the S256 PKCE challenge of verifier (RFC 7636).
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
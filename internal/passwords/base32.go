@@ -0,0 +1,30 @@
+package passwords
+
+import (
+	"crypto/subtle"
+	"encoding/base32"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//Base32 verifies passwords stored before real hashing was introduced.
+//It never produces new hashes, every match is upgraded on sign in.
+type Base32 struct{}
+
+func (Base32) Hash(password string) (string, error) {
+	return "", errors.New("base32 is not a password hash")
+}
+
+func (Base32) Verify(encoded, password string) (bool, error) {
+	other := base32.StdEncoding.EncodeToString([]byte(password))
+	return subtle.ConstantTimeCompare([]byte(encoded), []byte(other)) == 1, nil
+}
+
+func (Base32) Matches(encoded string) bool {
+	return !strings.HasPrefix(encoded, "$")
+}
+
+func (Base32) NeedsRehash(encoded string) bool {
+	return true
+}
@@ -0,0 +1,110 @@
+package passwords
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+//Hasher is one password hashing algorithm.
+//Encoded hashes are self-describing: they carry the algorithm,
+//its cost parameters and the per-user salt, so parameters can be
+//changed without breaking already stored passwords.
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(encoded, password string) (bool, error)
+	//reports whether encoded was produced by this hasher
+	Matches(encoded string) bool
+	//reports whether encoded was produced with parameters
+	//other than the current ones
+	NeedsRehash(encoded string) bool
+}
+
+type Config struct {
+	Algorithm  string //argon2id, bcrypt or scrypt; argon2id by default
+	BcryptCost int
+	Argon2id   Argon2idParams
+	Scrypt     ScryptParams
+}
+
+//Manager hashes new passwords with the configured algorithm
+//and verifies passwords hashed by any known algorithm,
+//including legacy base32 rows.
+type Manager struct {
+	current Hasher
+	hashers []Hasher
+
+	dummyOnce sync.Once
+	dummy     string
+}
+
+func New(cfg Config) (*Manager, error) {
+	bcrypt := NewBcrypt(cfg.BcryptCost)
+	argon := NewArgon2id(cfg.Argon2id)
+	scrypt := NewScrypt(cfg.Scrypt)
+
+	var current Hasher
+	switch cfg.Algorithm {
+	case "", "argon2id":
+		current = argon
+	case "bcrypt":
+		current = bcrypt
+	case "scrypt":
+		current = scrypt
+	default:
+		return nil, errors.Errorf("unknown password hashing algorithm %q", cfg.Algorithm)
+	}
+
+	return NewManager(current, argon, bcrypt, scrypt, Base32{}), nil
+}
+
+func NewManager(current Hasher, known ...Hasher) *Manager {
+	return &Manager{
+		current: current,
+		hashers: append([]Hasher{current}, known...),
+	}
+}
+
+func (m *Manager) Hash(password string) (string, error) {
+	encoded, err := m.current.Hash(password)
+	if err != nil {
+		return "", errors.Wrap(err, "can't hash password")
+	}
+
+	return encoded, nil
+}
+
+//Verify checks password against encoded hash.
+//rehash is true when the password is correct but the hash
+//should be replaced with the one produced by Hash.
+func (m *Manager) Verify(encoded, password string) (ok bool, rehash bool, err error) {
+	for _, hasher := range m.hashers {
+		if !hasher.Matches(encoded) {
+			continue
+		}
+
+		ok, err = hasher.Verify(encoded, password)
+		if err != nil {
+			return false, false, errors.Wrap(err, "can't verify password")
+		}
+		if !ok {
+			return false, false, nil
+		}
+
+		return true, hasher != m.current || hasher.NeedsRehash(encoded), nil
+	}
+
+	return false, false, errors.New("unknown password hash format")
+}
+
+//VerifyDummy takes as long as Verify of a real user, so sign in
+//with an unknown email can't be told apart by response time.
+func (m *Manager) VerifyDummy(password string) {
+	m.dummyOnce.Do(func() {
+		m.dummy, _ = m.current.Hash("dummy password")
+	})
+
+	if m.dummy != "" {
+		_, _ = m.current.Verify(m.dummy, password)
+	}
+}
@@ -0,0 +1,162 @@
+package passwords
+
+import (
+	"encoding/base32"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+//cheap parameters, the defaults would make the tests slow
+var (
+	testArgon2id = Argon2idParams{Memory: 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+	testScrypt   = ScryptParams{LogN: 4, R: 8, P: 1, SaltLen: 16, KeyLen: 32}
+)
+
+func testHashers() map[string]Hasher {
+	return map[string]Hasher{
+		"argon2id": NewArgon2id(testArgon2id),
+		"bcrypt":   NewBcrypt(bcrypt.MinCost),
+		"scrypt":   NewScrypt(testScrypt),
+	}
+}
+
+func TestHashers(t *testing.T) {
+	for name, hasher := range testHashers() {
+		encoded, err := hasher.Hash("Passw0rd!Passw0rd")
+		if err != nil {
+			t.Fatalf("%s: can't hash: %s", name, err)
+		}
+		if !hasher.Matches(encoded) {
+			t.Errorf("%s: doesn't match its own hash %s", name, encoded)
+		}
+		if hasher.NeedsRehash(encoded) {
+			t.Errorf("%s: its own hash needs rehash", name)
+		}
+
+		other, err := hasher.Hash("Passw0rd!Passw0rd")
+		if err != nil {
+			t.Fatalf("%s: can't hash: %s", name, err)
+		}
+		if other == encoded {
+			t.Errorf("%s: two hashes of a password are equal, salt is missing", name)
+		}
+
+		tests := []struct {
+			password string
+			ok       bool
+		}{
+			{"Passw0rd!Passw0rd", true},
+			{"Passw0rd!Passw0rD", false},
+			{"Passw0rd!Passw0rd ", false},
+			{"", false},
+		}
+		for _, tt := range tests {
+			ok, err := hasher.Verify(encoded, tt.password)
+			if err != nil {
+				t.Fatalf("%s: can't verify %q: %s", name, tt.password, err)
+			}
+			if ok != tt.ok {
+				t.Errorf("%s: %q verified as %t, want %t", name, tt.password, ok, tt.ok)
+			}
+		}
+	}
+}
+
+func TestNeedsRehashOnNewParams(t *testing.T) {
+	old := map[string]Hasher{
+		"argon2id": NewArgon2id(testArgon2id),
+		"bcrypt":   NewBcrypt(bcrypt.MinCost),
+		"scrypt":   NewScrypt(testScrypt),
+	}
+	stronger := map[string]Hasher{
+		"argon2id": NewArgon2id(Argon2idParams{Memory: 2048, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}),
+		"bcrypt":   NewBcrypt(bcrypt.MinCost + 1),
+		"scrypt":   NewScrypt(ScryptParams{LogN: 5, R: 8, P: 1, SaltLen: 16, KeyLen: 32}),
+	}
+
+	for name, hasher := range old {
+		encoded, err := hasher.Hash("Passw0rd!Passw0rd")
+		if err != nil {
+			t.Fatalf("%s: can't hash: %s", name, err)
+		}
+		if !stronger[name].NeedsRehash(encoded) {
+			t.Errorf("%s: hash with old parameters doesn't need rehash", name)
+		}
+
+		//hashes keep their parameters, so they still verify
+		ok, err := stronger[name].Verify(encoded, "Passw0rd!Passw0rd")
+		if err != nil || !ok {
+			t.Errorf("%s: hash with old parameters returned %t, %v", name, ok, err)
+		}
+	}
+}
+
+func TestManagerLegacyBase32(t *testing.T) {
+	for name, hasher := range testHashers() {
+		m := NewManager(hasher, NewArgon2id(testArgon2id), NewBcrypt(bcrypt.MinCost),
+			NewScrypt(testScrypt), Base32{})
+		legacy := base32.StdEncoding.EncodeToString([]byte("Passw0rd!Passw0rd"))
+
+		ok, rehash, err := m.Verify(legacy, "Passw0rd!Passw0rd")
+		if err != nil || !ok || !rehash {
+			t.Errorf("%s: legacy hash returned %t, %t, %v, want it verified and rehashed", name, ok, rehash, err)
+		}
+
+		ok, rehash, err = m.Verify(legacy, "wrong password")
+		if err != nil || ok || rehash {
+			t.Errorf("%s: legacy hash with a wrong password returned %t, %t, %v", name, ok, rehash, err)
+		}
+	}
+}
+
+func TestManagerVerify(t *testing.T) {
+	hashers := testHashers()
+	m := NewManager(hashers["argon2id"], hashers["bcrypt"], hashers["scrypt"], Base32{})
+
+	for name, hasher := range hashers {
+		encoded, err := hasher.Hash("Passw0rd!Passw0rd")
+		if err != nil {
+			t.Fatalf("%s: can't hash: %s", name, err)
+		}
+
+		ok, rehash, err := m.Verify(encoded, "Passw0rd!Passw0rd")
+		if err != nil || !ok {
+			t.Fatalf("%s: right password returned %t, %v", name, ok, err)
+		}
+		//only hashes of the current algorithm are kept
+		if rehash != (name != "argon2id") {
+			t.Errorf("%s: rehash is %t", name, rehash)
+		}
+
+		ok, rehash, err = m.Verify(encoded, "wrong password")
+		if err != nil || ok || rehash {
+			t.Errorf("%s: wrong password returned %t, %t, %v", name, ok, rehash, err)
+		}
+	}
+
+	_, _, err := m.Verify("$unknown$hash", "Passw0rd!Passw0rd")
+	if err == nil {
+		t.Errorf("unknown hash format accepted")
+	}
+
+	encoded, err := m.Hash("Passw0rd!Passw0rd")
+	if err != nil {
+		t.Fatalf("can't hash: %s", err)
+	}
+	if !hashers["argon2id"].Matches(encoded) {
+		t.Errorf("manager hashed with another algorithm: %s", encoded)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, algorithm := range []string{"", "argon2id", "bcrypt", "scrypt"} {
+		if _, err := New(Config{Algorithm: algorithm}); err != nil {
+			t.Errorf("algorithm %q: %s", algorithm, err)
+		}
+	}
+
+	if _, err := New(Config{Algorithm: "md5"}); err == nil {
+		t.Errorf("unknown algorithm accepted")
+	}
+}
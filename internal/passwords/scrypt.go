@@ -0,0 +1,110 @@
+package passwords
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+type ScryptParams struct {
+	LogN    uint8 //N = 2^LogN
+	R       int
+	P       int
+	SaltLen int
+	KeyLen  int
+}
+
+var DefaultScryptParams = ScryptParams{
+	LogN:    15,
+	R:       8,
+	P:       1,
+	SaltLen: 16,
+	KeyLen:  32,
+}
+
+//Scrypt uses the PHC-like format:
+//$scrypt$ln=15,r=8,p=1$<salt>$<hash>
+type Scrypt struct {
+	params ScryptParams
+}
+
+func NewScrypt(params ScryptParams) *Scrypt {
+	if params == (ScryptParams{}) {
+		params = DefaultScryptParams
+	}
+
+	return &Scrypt{params: params}
+}
+
+func (s *Scrypt) Hash(password string) (string, error) {
+	salt := make([]byte, s.params.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", errors.Wrap(err, "can't generate salt")
+	}
+
+	key, err := scrypt.Key([]byte(password), salt, 1<<s.params.LogN, s.params.R, s.params.P, s.params.KeyLen)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s",
+		s.params.LogN, s.params.R, s.params.P,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (s *Scrypt) Verify(encoded, password string) (bool, error) {
+	params, salt, key, err := decodeScrypt(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	other, err := scrypt.Key([]byte(password), salt, 1<<params.LogN, params.R, params.P, params.KeyLen)
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (s *Scrypt) Matches(encoded string) bool {
+	return strings.HasPrefix(encoded, "$scrypt$")
+}
+
+func (s *Scrypt) NeedsRehash(encoded string) bool {
+	params, _, _, err := decodeScrypt(encoded)
+	return err != nil || params != s.params
+}
+
+func decodeScrypt(encoded string) (ScryptParams, []byte, []byte, error) {
+	params := ScryptParams{}
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 {
+		return params, nil, nil, errors.New("malformed scrypt hash")
+	}
+
+	_, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &params.LogN, &params.R, &params.P)
+	if err != nil {
+		return params, nil, nil, errors.Wrap(err, "malformed scrypt params")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return params, nil, nil, errors.Wrap(err, "malformed scrypt salt")
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errors.Wrap(err, "malformed scrypt key")
+	}
+
+	params.SaltLen = len(salt)
+	params.KeyLen = len(key)
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,147 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"finPrj/internal/apikeys"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+var _ apikeys.Storage = &APIKeyStorage{}
+
+type APIKeyStorage struct {
+	statementStorage
+
+	CreateStmt       *sql.Stmt
+	GetByHashStmt    *sql.Stmt
+	ListByUserIDStmt *sql.Stmt
+	DeleteStmt       *sql.Stmt
+	TouchStmt        *sql.Stmt
+}
+
+func NewAPIKeyStorage(db *DB) (*APIKeyStorage, error) {
+	ks := &APIKeyStorage{statementStorage: newStatementsStorage(db)}
+
+	stmts := []stmt{
+		{Query: createAPIKeyQuery, Dst: &ks.CreateStmt},
+		{Query: getAPIKeyByHashQuery, Dst: &ks.GetByHashStmt},
+		{Query: listAPIKeysByUserIDQuery, Dst: &ks.ListByUserIDStmt},
+		{Query: deleteAPIKeyQuery, Dst: &ks.DeleteStmt},
+		{Query: touchAPIKeyQuery, Dst: &ks.TouchStmt},
+	}
+
+	if err := ks.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements in api keys")
+	}
+
+	return ks, nil
+}
+
+func scanAPIKey(scanner sqlScanner, key *apikeys.APIKey) error {
+	return scanner.Scan(&key.KeyID, &key.UserID, &key.Name, &key.KeyHash, pq.Array(&key.Scopes),
+		pq.Array(&key.AllowedIPs), &key.ExpiresAt, &key.CreatedAt, &key.LastUsedAt)
+}
+
+const createAPIKeyQuery = `INSERT INTO api_keys (key_id, user_id, name, key_hash, scopes, 
+allowed_ips, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+func (ks *APIKeyStorage) Create(ctx context.Context, key *apikeys.APIKey) error {
+	ctx, cancel := ks.withTimeout(ctx)
+	defer cancel()
+
+	_, err := ks.CreateStmt.ExecContext(ctx, key.KeyID, key.UserID, key.Name, key.KeyHash, pq.Array(key.Scopes),
+		pq.Array(key.AllowedIPs), key.ExpiresAt, key.CreatedAt)
+	if err != nil {
+		return errors.Wrapf(err, "can't create api key")
+	}
+
+	return nil
+}
+
+const getAPIKeyByHashQuery = `SELECT key_id, user_id, name, key_hash, scopes, 
+allowed_ips, expires_at, created_at, last_used_at 
+FROM api_keys WHERE key_hash = $1`
+
+func (ks *APIKeyStorage) GetByHash(ctx context.Context, hash string) (*apikeys.APIKey, error) {
+	ctx, cancel := ks.withTimeout(ctx)
+	defer cancel()
+
+	row := ks.GetByHashStmt.QueryRowContext(ctx, hash)
+	key := apikeys.APIKey{}
+
+	err := scanAPIKey(row, &key)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "can't get api key by hash")
+	}
+
+	return &key, nil
+}
+
+const listAPIKeysByUserIDQuery = `SELECT key_id, user_id, name, key_hash, scopes, 
+allowed_ips, expires_at, created_at, last_used_at 
+FROM api_keys WHERE user_id = $1 ORDER BY created_at`
+
+func (ks *APIKeyStorage) ListByUserID(ctx context.Context, userID int64) ([]apikeys.APIKey, error) {
+	ctx, cancel := ks.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := ks.ListByUserIDStmt.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't list api keys")
+	}
+	defer rows.Close()
+
+	keys := make([]apikeys.APIKey, 0)
+	for rows.Next() {
+		key := apikeys.APIKey{}
+		err := scanAPIKey(rows, &key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't scan api key")
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, errors.Wrap(rows.Err(), "can't list api keys")
+}
+
+const deleteAPIKeyQuery = `DELETE FROM api_keys WHERE user_id = $1 AND key_id = $2`
+
+//Delete returns false if the user has no such key.
+func (ks *APIKeyStorage) Delete(ctx context.Context, userID int64, keyID string) (bool, error) {
+	ctx, cancel := ks.withTimeout(ctx)
+	defer cancel()
+
+	res, err := ks.DeleteStmt.ExecContext(ctx, userID, keyID)
+	if err != nil {
+		return false, errors.Wrapf(err, "can't delete api key %s", keyID)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(err, "can't delete api key %s", keyID)
+	}
+
+	return n == 1, nil
+}
+
+const touchAPIKeyQuery = `UPDATE api_keys SET last_used_at = $1 WHERE key_id = $2`
+
+func (ks *APIKeyStorage) Touch(ctx context.Context, keyID string, usedAt time.Time) error {
+	ctx, cancel := ks.withTimeout(ctx)
+	defer cancel()
+
+	_, err := ks.TouchStmt.ExecContext(ctx, usedAt, keyID)
+	if err != nil {
+		return errors.Wrapf(err, "can't touch api key %s", keyID)
+	}
+
+	return nil
+}
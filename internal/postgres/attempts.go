@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"finPrj/internal/throttle"
+
+	"github.com/pkg/errors"
+)
+
+var _ throttle.Store = &AttemptStorage{}
+
+//AttemptStorage shares sign in failures between instances.
+type AttemptStorage struct {
+	statementStorage
+
+	GetStmt           *sql.Stmt
+	FailStmt          *sql.Stmt
+	ForgiveStmt       *sql.Stmt
+	ResetStmt         *sql.Stmt
+	DeleteExpiredStmt *sql.Stmt
+}
+
+func NewAttemptStorage(db *DB) (*AttemptStorage, error) {
+	as := &AttemptStorage{statementStorage: newStatementsStorage(db)}
+
+	stmts := []stmt{
+		{Query: getAttemptsQuery, Dst: &as.GetStmt},
+		{Query: failAttemptQuery, Dst: &as.FailStmt},
+		{Query: forgiveAttemptQuery, Dst: &as.ForgiveStmt},
+		{Query: resetAttemptsQuery, Dst: &as.ResetStmt},
+		{Query: deleteExpiredAttemptsQuery, Dst: &as.DeleteExpiredStmt},
+	}
+
+	if err := as.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements in login attempts")
+	}
+
+	return as, nil
+}
+
+const getAttemptsQuery = `SELECT key, failures, last_failure_at FROM login_attempts WHERE key = $1`
+
+func (as *AttemptStorage) Get(ctx context.Context, key string) (*throttle.Entry, error) {
+	ctx, cancel := as.withTimeout(ctx)
+	defer cancel()
+
+	row := as.GetStmt.QueryRowContext(ctx, key)
+	e := throttle.Entry{}
+
+	err := row.Scan(&e.Key, &e.Failures, &e.LastFailure)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "can't scan login attempts")
+	}
+
+	return &e, nil
+}
+
+//the counter starts over when the last failure is older than the window
+const failAttemptQuery = `INSERT INTO login_attempts (key, failures, last_failure_at, expires_at) 
+VALUES ($1, 1, $2, $3) 
+ON CONFLICT (key) DO UPDATE SET 
+failures = CASE WHEN login_attempts.expires_at <= $2 THEN 1 ELSE login_attempts.failures + 1 END, 
+last_failure_at = $2, expires_at = $3 
+RETURNING key, failures, last_failure_at`
+
+const deleteExpiredAttemptsQuery = `DELETE FROM login_attempts WHERE expires_at <= $1`
+
+func (as *AttemptStorage) Fail(ctx context.Context, key string, now time.Time, window time.Duration) (*throttle.Entry, error) {
+	ctx, cancel := as.withTimeout(ctx)
+	defer cancel()
+
+	_, err := as.DeleteExpiredStmt.ExecContext(ctx, now)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't delete expired login attempts")
+	}
+
+	row := as.FailStmt.QueryRowContext(ctx, key, now, now.Add(window))
+	e := throttle.Entry{}
+
+	err = row.Scan(&e.Key, &e.Failures, &e.LastFailure)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't record login attempt")
+	}
+
+	return &e, nil
+}
+
+const forgiveAttemptQuery = `UPDATE login_attempts SET failures = failures - 1 WHERE key = $1 AND failures > 0`
+
+func (as *AttemptStorage) Forgive(ctx context.Context, key string) error {
+	ctx, cancel := as.withTimeout(ctx)
+	defer cancel()
+
+	_, err := as.ForgiveStmt.ExecContext(ctx, key)
+	if err != nil {
+		return errors.Wrapf(err, "can't forgive login attempt")
+	}
+
+	return nil
+}
+
+const resetAttemptsQuery = `DELETE FROM login_attempts WHERE key = $1`
+
+func (as *AttemptStorage) Reset(ctx context.Context, key string) error {
+	ctx, cancel := as.withTimeout(ctx)
+	defer cancel()
+
+	_, err := as.ResetStmt.ExecContext(ctx, key)
+	if err != nil {
+		return errors.Wrapf(err, "can't reset login attempts")
+	}
+
+	return nil
+}
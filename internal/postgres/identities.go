@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	users "finPrj/internal/users"
+
+	"github.com/pkg/errors"
+)
+
+var _ users.IdentityStorage = &IdentityStorage{}
+
+type IdentityStorage struct {
+	statementStorage
+
+	GetStmt          *sql.Stmt
+	CreateStmt       *sql.Stmt
+	ListByUserIDStmt *sql.Stmt
+}
+
+func NewIdentityStorage(db *DB) (*IdentityStorage, error) {
+	is := &IdentityStorage{statementStorage: newStatementsStorage(db)}
+
+	if err := is.initStatements(is.stmts()); err != nil {
+		return nil, errors.Wrap(err, "can't init statements in identities")
+	}
+
+	return is, nil
+}
+
+func (is *IdentityStorage) stmts() []stmt {
+	return []stmt{
+		{Query: getIdentityQuery, Dst: &is.GetStmt},
+		{Query: createIdentityQuery, Dst: &is.CreateStmt},
+		{Query: listIdentitiesByUserIDQuery, Dst: &is.ListByUserIDStmt},
+	}
+}
+
+//WithTx returns a copy of the storage working in tx
+func (is *IdentityStorage) WithTx(tx *Tx) *IdentityStorage {
+	txis := *is
+	txis.withTx(tx, txis.stmts())
+	return &txis
+}
+
+func scanIdentity(scanner sqlScanner, identity *users.Identity) error {
+	return scanner.Scan(&identity.Provider, &identity.Subject, &identity.UserID,
+		&identity.Email, &identity.CreatedAt)
+}
+
+const getIdentityQuery = `SELECT provider, subject, user_id, email, created_at 
+FROM user_identities WHERE provider = $1 AND subject = $2`
+
+func (is *IdentityStorage) Get(ctx context.Context, provider, subject string) (*users.Identity, error) {
+	ctx, cancel := is.withTimeout(ctx)
+	defer cancel()
+
+	row := is.GetStmt.QueryRowContext(ctx, provider, subject)
+	identity := users.Identity{}
+
+	err := scanIdentity(row, &identity)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "can't scan identity")
+	}
+
+	return &identity, nil
+}
+
+const createIdentityQuery = `INSERT INTO user_identities (provider, subject, user_id, email, created_at) 
+VALUES ($1, $2, $3, $4, $5)`
+
+func (is *IdentityStorage) Create(ctx context.Context, identity *users.Identity) error {
+	ctx, cancel := is.withTimeout(ctx)
+	defer cancel()
+
+	_, err := is.CreateStmt.ExecContext(ctx, identity.Provider, identity.Subject, identity.UserID,
+		identity.Email, identity.CreatedAt)
+	if isUniqueViolation(err) {
+		return users.ErrIdentityLinked
+	}
+	if err != nil {
+		return errors.Wrapf(err, "can't create identity")
+	}
+
+	return nil
+}
+
+const listIdentitiesByUserIDQuery = `SELECT provider, subject, user_id, email, created_at 
+FROM user_identities WHERE user_id = $1 ORDER BY created_at`
+
+func (is *IdentityStorage) ListByUserID(ctx context.Context, userID int64) ([]users.Identity, error) {
+	ctx, cancel := is.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := is.ListByUserIDStmt.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't list identities")
+	}
+	defer rows.Close()
+
+	identities := make([]users.Identity, 0)
+	for rows.Next() {
+		identity := users.Identity{}
+		err := scanIdentity(rows, &identity)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't scan identity")
+		}
+
+		identities = append(identities, identity)
+	}
+
+	return identities, errors.Wrap(rows.Err(), "can't list identities")
+}
@@ -0,0 +1,253 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//Migrations are NNNN_name.up.sql and NNNN_name.down.sql files,
+//applied in the order of NNNN. Applied files are never edited,
+//changes go into a new migration.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+//any constant works, it only has to be the same for every instance
+const migrationLockID = 7219385502184
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+func loadMigrations() ([]Migration, error) {
+	files, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read migrations")
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, file := range files {
+		name := file.Name()
+		parts := strings.SplitN(strings.TrimSuffix(name, ".sql"), "_", 2)
+		version, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || len(parts) != 2 {
+			return nil, errors.Errorf("migration %s isn't named NNNN_name.up|down.sql", name)
+		}
+
+		data, err := migrationFiles.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read migration %s", name)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version}
+			byVersion[version] = m
+		}
+
+		switch {
+		case strings.HasSuffix(parts[1], ".up"):
+			m.Name, m.Up = strings.TrimSuffix(parts[1], ".up"), string(data)
+		case strings.HasSuffix(parts[1], ".down"):
+			m.Down = string(data)
+		default:
+			return nil, errors.Errorf("migration %s is neither up nor down", name)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, errors.Errorf("migration %d needs both up and down", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+//Migrator applies the embedded migrations. Runs hold an advisory
+//lock, so instances started together migrate one after another.
+type Migrator struct {
+	db         *DB
+	migrations []Migration
+}
+
+func NewMigrator(db *DB) (*Migrator, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+const createMigrationsTableQuery = `CREATE TABLE IF NOT EXISTS schema_migrations (
+version bigint PRIMARY KEY, name text NOT NULL, applied_at timestamptz NOT NULL)`
+
+const appliedMigrationsQuery = `SELECT version, applied_at FROM schema_migrations`
+
+const addMigrationQuery = `INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`
+
+const removeMigrationQuery = `DELETE FROM schema_migrations WHERE version = $1`
+
+//locked runs fn on one connection holding the migration lock,
+//the lock is released with the connection's session.
+func (m *Migrator) locked(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Base.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "can't get connection")
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID)
+	if err != nil {
+		return errors.Wrap(err, "can't lock migrations")
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	_, err = conn.ExecContext(ctx, createMigrationsTableQuery)
+	if err != nil {
+		return errors.Wrap(err, "can't create schema_migrations")
+	}
+
+	return fn(conn)
+}
+
+func applied(conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(context.Background(), appliedMigrationsQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get applied migrations")
+	}
+	defer rows.Close()
+
+	versions := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan applied migration")
+		}
+		versions[version] = appliedAt
+	}
+
+	return versions, errors.Wrap(rows.Err(), "can't read applied migrations")
+}
+
+//run executes the sql of one migration and records it in the same
+//transaction, a failed migration leaves nothing behind.
+func run(conn *sql.Conn, sqlText, record string, args ...interface{}) error {
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, sqlText)
+	if err == nil {
+		_, err = tx.ExecContext(ctx, record, args...)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//Up applies every pending migration and returns them.
+func (m *Migrator) Up() ([]Migration, error) {
+	done := []Migration{}
+	err := m.locked(func(conn *sql.Conn) error {
+		versions, err := applied(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := versions[mig.Version]; ok {
+				continue
+			}
+
+			err = run(conn, mig.Up, addMigrationQuery, mig.Version, mig.Name, time.Now().UTC())
+			if err != nil {
+				return errors.Wrapf(err, "can't apply migration %d_%s", mig.Version, mig.Name)
+			}
+			done = append(done, mig)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+//Down rolls back the last steps applied migrations and returns them.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	done := []Migration{}
+	err := m.locked(func(conn *sql.Conn) error {
+		versions, err := applied(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := versions[mig.Version]; !ok {
+				continue
+			}
+
+			err = run(conn, mig.Down, removeMigrationQuery, mig.Version)
+			if err != nil {
+				return errors.Wrapf(err, "can't roll back migration %d_%s", mig.Version, mig.Name)
+			}
+			done = append(done, mig)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+//Status lists every migration, AppliedAt is nil for pending ones.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	statuses := []MigrationStatus{}
+	err := m.locked(func(conn *sql.Conn) error {
+		versions, err := applied(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			status := MigrationStatus{Migration: mig}
+			if appliedAt, ok := versions[mig.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
@@ -0,0 +1,39 @@
+-- the schema the service had before migrations, deployments
+-- of that time already have these tables and keep them
+CREATE TABLE IF NOT EXISTS users (
+    id         bigint PRIMARY KEY,
+    first_name text NOT NULL,
+    last_name  text NOT NULL,
+    birthday   date,
+    email      text NOT NULL,
+    password   text NOT NULL,
+    created_at timestamptz NOT NULL,
+    updated_at timestamptz NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    session_id  text PRIMARY KEY,
+    user_id     bigint NOT NULL,
+    created_at  timestamptz NOT NULL,
+    valid_until timestamptz NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS robots (
+    robot_id        bigint PRIMARY KEY,
+    owner_user_id   bigint NOT NULL,
+    is_favourite    boolean NOT NULL DEFAULT FALSE,
+    is_active       boolean NOT NULL DEFAULT FALSE,
+    parent_robot_id bigint NOT NULL DEFAULT 0,
+    ticker          text NOT NULL DEFAULT '',
+    buy_price       double precision NOT NULL DEFAULT 0,
+    sell_price      double precision NOT NULL DEFAULT 0,
+    plan_start      timestamptz,
+    plan_end        timestamptz,
+    plan_yield      double precision NOT NULL DEFAULT 0,
+    fact_yield      double precision NOT NULL DEFAULT 0,
+    deals_counts    bigint NOT NULL DEFAULT 0,
+    deleted_at      timestamptz,
+    activated_at    timestamptz,
+    deactivated_at  timestamptz,
+    created_at      timestamptz
+);
@@ -0,0 +1,30 @@
+DROP INDEX robots_owner_user_id;
+ALTER TABLE robots DROP CONSTRAINT robots_owner_user_id_fkey;
+ALTER TABLE robots DROP COLUMN tags;
+
+DROP TABLE login_attempts;
+DROP TABLE used_tokens;
+DROP TABLE api_keys;
+DROP TABLE session_revocations;
+DROP TABLE refresh_tokens;
+
+DROP INDEX sessions_user_id;
+DELETE FROM sessions;
+ALTER TABLE sessions
+    DROP CONSTRAINT sessions_user_id_fkey,
+    DROP COLUMN expires_at,
+    DROP COLUMN last_seen_at,
+    DROP COLUMN ip,
+    DROP COLUMN user_agent,
+    DROP COLUMN token_hash;
+
+DROP TABLE user_identities;
+DROP TABLE recovery_codes;
+
+DROP INDEX users_email;
+ALTER TABLE users
+    DROP COLUMN email_verified_at,
+    DROP COLUMN totp_counter,
+    DROP COLUMN totp_enabled_at,
+    DROP COLUMN totp_secret,
+    DROP COLUMN role;
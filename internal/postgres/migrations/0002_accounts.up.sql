@@ -0,0 +1,92 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS role              text NOT NULL DEFAULT 'user',
+    ADD COLUMN IF NOT EXISTS totp_secret       text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS totp_enabled_at   timestamptz,
+    ADD COLUMN IF NOT EXISTS totp_counter      bigint NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS email_verified_at timestamptz;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email ON users (email);
+
+CREATE TABLE recovery_codes (
+    user_id   bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash text NOT NULL,
+    used_at   timestamptz,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+CREATE TABLE user_identities (
+    provider   text NOT NULL,
+    subject    text NOT NULL,
+    user_id    bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    email      text NOT NULL,
+    created_at timestamptz NOT NULL,
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX user_identities_user_id ON user_identities (user_id);
+
+-- old sessions use the bearer itself as their id, it must not be
+-- kept in clear, so everyone signs in again
+DELETE FROM sessions;
+
+ALTER TABLE sessions
+    ADD COLUMN token_hash   text NOT NULL UNIQUE,
+    ADD COLUMN user_agent   text NOT NULL,
+    ADD COLUMN ip           text NOT NULL,
+    ADD COLUMN last_seen_at timestamptz NOT NULL,
+    ADD COLUMN expires_at   timestamptz NOT NULL,
+    ADD CONSTRAINT sessions_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE INDEX sessions_user_id ON sessions (user_id);
+
+CREATE TABLE refresh_tokens (
+    token_hash text PRIMARY KEY,
+    session_id text NOT NULL REFERENCES sessions (session_id) ON DELETE CASCADE,
+    user_id    bigint NOT NULL,
+    created_at timestamptz NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at    timestamptz
+);
+
+CREATE TABLE session_revocations (
+    session_id text PRIMARY KEY,
+    user_id    bigint NOT NULL,
+    revoked_at timestamptz NOT NULL,
+    expires_at timestamptz NOT NULL
+);
+
+CREATE INDEX session_revocations_revoked_at ON session_revocations (revoked_at);
+
+CREATE TABLE api_keys (
+    key_id       text PRIMARY KEY,
+    user_id      bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name         text NOT NULL,
+    key_hash     text NOT NULL UNIQUE,
+    scopes       text[] NOT NULL DEFAULT '{}',
+    allowed_ips  text[] NOT NULL DEFAULT '{}',
+    expires_at   timestamptz,
+    created_at   timestamptz NOT NULL,
+    last_used_at timestamptz
+);
+
+CREATE INDEX api_keys_user_id ON api_keys (user_id);
+
+CREATE TABLE used_tokens (
+    token_id   text PRIMARY KEY,
+    expires_at timestamptz NOT NULL
+);
+
+CREATE TABLE login_attempts (
+    key             text PRIMARY KEY,
+    failures        integer NOT NULL,
+    last_failure_at timestamptz NOT NULL,
+    expires_at      timestamptz NOT NULL
+);
+
+ALTER TABLE robots ADD COLUMN IF NOT EXISTS tags text[] NOT NULL DEFAULT '{}';
+
+-- robots of users that are gone may exist, only new rows are checked
+ALTER TABLE robots ADD CONSTRAINT robots_owner_user_id_fkey
+    FOREIGN KEY (owner_user_id) REFERENCES users (id) NOT VALID;
+
+CREATE INDEX IF NOT EXISTS robots_owner_user_id ON robots (owner_user_id);
@@ -0,0 +1,4 @@
+DROP INDEX users_name_trgm;
+DROP INDEX users_email_trgm;
+DROP INDEX robots_tags;
+DROP INDEX robots_ticker_trgm;
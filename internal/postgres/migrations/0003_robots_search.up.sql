@@ -0,0 +1,18 @@
+-- pg_trgm is trusted since PostgreSQL 13, a user with CREATE on the
+-- database can add it. Older servers need a superuser to run
+-- CREATE EXTENSION pg_trgm; in the database once before migrating.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm') THEN
+        CREATE EXTENSION pg_trgm;
+    END IF;
+EXCEPTION WHEN insufficient_privilege THEN
+    RAISE EXCEPTION 'pg_trgm is missing and % can''t create it', current_user
+        USING HINT = 'run CREATE EXTENSION pg_trgm; as a superuser in this database, then migrate again';
+END
+$$;
+
+CREATE INDEX robots_ticker_trgm ON robots USING gin (ticker gin_trgm_ops);
+CREATE INDEX robots_tags ON robots USING gin (tags);
+CREATE INDEX users_email_trgm ON users USING gin (email gin_trgm_ops);
+CREATE INDEX users_name_trgm ON users USING gin ((first_name || ' ' || last_name) gin_trgm_ops);
@@ -0,0 +1,2 @@
+ALTER TABLE robots ALTER COLUMN robot_id DROP IDENTITY;
+ALTER TABLE users ALTER COLUMN id DROP IDENTITY;
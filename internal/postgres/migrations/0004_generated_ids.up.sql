@@ -0,0 +1,5 @@
+ALTER TABLE users ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('users', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM users;
+
+ALTER TABLE robots ALTER COLUMN robot_id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('robots', 'robot_id'), COALESCE(MAX(robot_id), 0) + 1, false) FROM robots;
@@ -0,0 +1,11 @@
+DROP INDEX session_revocations_user_id;
+DROP INDEX session_revocations_session_id;
+
+-- only one user-wide revocation fits the old key, the latest one is kept
+DELETE FROM session_revocations WHERE session_id IS NULL AND id <> (
+    SELECT id FROM session_revocations WHERE session_id IS NULL ORDER BY revoked_at DESC LIMIT 1);
+UPDATE session_revocations SET session_id = '' WHERE session_id IS NULL;
+ALTER TABLE session_revocations ALTER COLUMN session_id SET NOT NULL;
+
+ALTER TABLE session_revocations DROP COLUMN id;
+ALTER TABLE session_revocations ADD PRIMARY KEY (session_id);
@@ -0,0 +1,8 @@
+ALTER TABLE session_revocations DROP CONSTRAINT session_revocations_pkey;
+ALTER TABLE session_revocations ADD COLUMN id bigint GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY;
+ALTER TABLE session_revocations ALTER COLUMN session_id DROP NOT NULL;
+UPDATE session_revocations SET session_id = NULL WHERE session_id = '';
+
+CREATE UNIQUE INDEX session_revocations_session_id ON session_revocations (session_id)
+    WHERE session_id IS NOT NULL;
+CREATE INDEX session_revocations_user_id ON session_revocations (user_id, revoked_at);
@@ -4,7 +4,7 @@ import (
 	"database/sql"
 	"time"
 
-	_ "github.com/lib/pq" //postgres drivers.
+	"github.com/lib/pq" //postgres drivers.
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
@@ -12,12 +12,17 @@ import (
 type DB struct {
 	Base   *sql.DB
 	Logger *zap.Logger
+
+	QueryTimeout time.Duration
 }
 
 type Config struct {
 	URL             string
 	MaxConnections  int
 	MaxConnLifetime time.Duration
+	//QueryTimeout is the longest one storage call may take,
+	//streamed exports are bound only by their caller's context
+	QueryTimeout time.Duration
 }
 
 func New(logger *zap.Logger, cfg Config) (*DB, error) {
@@ -32,6 +37,8 @@ func New(logger *zap.Logger, cfg Config) (*DB, error) {
 	return &DB{
 		Base:   db,
 		Logger: logger,
+
+		QueryTimeout: cfg.QueryTimeout,
 	}, nil
 }
 
@@ -60,6 +67,12 @@ func (db *DB) Close() error {
 	return nil
 }
 
+//isUniqueViolation tells if err is a unique constraint violation (23505)
+func isUniqueViolation(err error) bool {
+	pqErr, ok := errors.Cause(err).(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
+
 type sqlScanner interface {
 	Scan(dest ...interface{}) error
 }
@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"strconv"
+	"strings"
+)
+
+//queryBuilder collects the conditions of queries that depend on
+//the request, so one query serves every combination of filters.
+//Only args are taken from requests, never the SQL itself.
+type queryBuilder struct {
+	where []string
+	args  []interface{}
+}
+
+//arg adds a parameter and returns its placeholder
+func (qb *queryBuilder) arg(value interface{}) string {
+	qb.args = append(qb.args, value)
+	return "$" + strconv.Itoa(len(qb.args))
+}
+
+//cond adds a condition, each %s in it is replaced by the
+//placeholder of the next value.
+func (qb *queryBuilder) cond(sql string, values ...interface{}) {
+	for _, value := range values {
+		sql = strings.Replace(sql, "%s", qb.arg(value), 1)
+	}
+	qb.where = append(qb.where, sql)
+}
+
+func (qb *queryBuilder) whereSQL() string {
+	if len(qb.where) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(qb.where, " AND ")
+}
@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	robots "finPrj/internal/robots"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+//Search is backed by the pg_trgm and tags indexes
+//of migrations/0003_robots_search.up.sql.
+
+//likeEscape makes q match literally in LIKE patterns
+func likeEscape(q string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(q)
+}
+
+//searchQuery ranks an exact ticker first, then ticker prefixes,
+//then tags and then owners by how similar their name or email is.
+func searchQuery(search *robots.Search) (string, []interface{}, error) {
+	qb := &queryBuilder{}
+	//upper has range variants too, the type of q is spelled out
+	q := qb.arg(search.Query) + "::text"
+	prefix := qb.arg(likeEscape(search.Query) + "%")
+	tag := qb.arg(pq.Array([]string{strings.ToLower(search.Query)}))
+
+	from := "robots"
+	matches := []string{"ticker ILIKE " + prefix, "tags @> " + tag + "::text[]"}
+	ranks := []string{
+		"CASE WHEN upper(ticker) = upper(" + q + ") THEN 1 WHEN ticker ILIKE " + prefix + " THEN 0.8 ELSE 0 END",
+		"CASE WHEN tags @> " + tag + "::text[] THEN 0.6 ELSE 0 END",
+	}
+
+	if search.MatchOwners {
+		from = `robots JOIN (SELECT id AS owner_id, email AS owner_email,
+first_name || ' ' || last_name AS owner_name FROM users) owners ON owner_id = owner_user_id`
+		contains := qb.arg("%" + likeEscape(search.Query) + "%")
+		matches = append(matches, "owner_email ILIKE "+contains, "owner_name % "+q)
+		ranks = append(ranks,
+			"0.5 * GREATEST(similarity(owner_name, "+q+"), similarity(owner_email, "+q+"))",
+			"CASE WHEN owner_email ILIKE "+contains+" THEN 0.3 ELSE 0 END")
+	}
+
+	qb.cond("deleted_at IS NULL")
+	qb.cond("(" + strings.Join(matches, " OR ") + ")")
+	if search.OwnerID != 0 {
+		qb.cond("owner_user_id = %s", search.OwnerID)
+	}
+
+	hits := "SELECT " + robotColumns + ", GREATEST(" + strings.Join(ranks, ", ") +
+		")::double precision AS rank FROM " + from + qb.whereSQL()
+
+	after := ""
+	if search.After != nil {
+		rank, err := strconv.ParseFloat(search.After.Value, 64)
+		if err != nil {
+			return "", nil, errors.Wrapf(robots.ErrCursor, "can't read cursor value %q", search.After.Value)
+		}
+		after = " WHERE (rank, robot_id) < (" + qb.arg(rank) + "::double precision, " +
+			qb.arg(search.After.ID) + ")"
+	}
+
+	query := "SELECT * FROM (" + hits + ") hits" + after +
+		" ORDER BY rank DESC, robot_id DESC LIMIT " + qb.arg(search.Limit+1)
+
+	return query, qb.args, nil
+}
+
+//Search returns a page of hits and the cursor of the next page,
+//which is empty on the last page.
+func (rs *RobotStorage) Search(ctx context.Context, search *robots.Search) ([]robots.SearchHit, string, error) {
+	ctx, cancel := rs.withTimeout(ctx)
+	defer cancel()
+
+	query, args, err := searchQuery(search)
+	if err != nil {
+		return nil, "", err
+	}
+	rows, err := rs.query(ctx, query, args...)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "can't search robots")
+	}
+	defer rows.Close()
+
+	hits := make([]robots.SearchHit, 0)
+	for rows.Next() {
+		hit := robots.SearchHit{}
+		err = scanRobot(rows, &hit.Robot, &hit.Rank)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "can't scan search hit")
+		}
+
+		hits = append(hits, hit)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, "", errors.Wrapf(err, "can't read search hits")
+	}
+
+	if len(hits) <= search.Limit {
+		return hits, "", nil
+	}
+
+	hits = hits[:search.Limit]
+	return hits, search.NextCursor(&hits[search.Limit-1]), nil
+}
@@ -1,6 +1,7 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 
 	"github.com/pkg/errors"
@@ -9,6 +10,9 @@ import (
 type statementStorage struct {
 	db         *DB
 	statements []*sql.Stmt
+
+	//tx is set on copies made by WithTx
+	tx *Tx
 }
 
 func newStatementsStorage(db *DB) statementStorage {
@@ -32,6 +36,29 @@ type stmt struct {
 	Dst   **sql.Stmt
 }
 
+//withTx makes the copy s and its statements part of tx
+func (s *statementStorage) withTx(tx *Tx, statements []stmt) {
+	s.tx = tx
+	tx.bind(statements)
+}
+
+//query runs queries built at runtime, in the transaction if there is one
+func (s *statementStorage) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if s.tx != nil {
+		return s.tx.tx.QueryContext(ctx, query, args...)
+	}
+	return s.db.Base.QueryContext(ctx, query, args...)
+}
+
+//withTimeout bounds one storage operation by Config.QueryTimeout,
+//callers' deadlines still apply if they are shorter.
+func (s *statementStorage) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.db.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.db.QueryTimeout)
+}
+
 func (s *statementStorage) initStatements(statements []stmt) error {
 	for i := range statements {
 		statement, err := s.db.Base.Prepare(statements[i].Query)
@@ -0,0 +1,251 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"finPrj/internal/storagetest"
+	users "finPrj/internal/users"
+
+	"go.uber.org/zap"
+)
+
+//instance is a throwaway postgres started by TestMain with initdb
+//and pg_ctl from PATH or from $PG_BIN. It listens on a socket in
+//its own directory only, every test gets a new database in it.
+type instance struct {
+	dir  string
+	port int
+
+	mutex   sync.Mutex
+	created int
+}
+
+var testInstance *instance
+
+//dsn is the connection string of a database of the instance
+func (in *instance) dsn(dbname string) string {
+	return fmt.Sprintf("host=%s port=%d user=postgres dbname=%s sslmode=disable", in.dir, in.port, dbname)
+}
+
+func pgCommand(name string) (string, error) {
+	if bin := os.Getenv("PG_BIN"); bin != "" {
+		return filepath.Join(bin, name), nil
+	}
+	return exec.LookPath(name)
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func startInstance() (*instance, error) {
+	initdb, err := pgCommand("initdb")
+	if err != nil {
+		return nil, err
+	}
+	pgCtl, err := pgCommand("pg_ctl")
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "finprj-pg")
+	if err != nil {
+		return nil, err
+	}
+	port, err := freePort()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	data := filepath.Join(dir, "data")
+	out, err := exec.Command(initdb, "-D", data, "-U", "postgres", "-A", "trust", "--no-sync").CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("initdb failed: %s: %s", err, out)
+	}
+
+	opts := fmt.Sprintf("-p %d -k %s -c listen_addresses='' -c fsync=off", port, dir)
+	out, err = exec.Command(pgCtl, "-D", data, "-o", opts, "-l", filepath.Join(dir, "log"), "-w", "start").CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("pg_ctl start failed: %s: %s", err, out)
+	}
+
+	return &instance{dir: dir, port: port}, nil
+}
+
+func (in *instance) stop() {
+	pgCtl, err := pgCommand("pg_ctl")
+	if err == nil {
+		exec.Command(pgCtl, "-D", filepath.Join(in.dir, "data"), "-m", "immediate", "stop").Run()
+	}
+	os.RemoveAll(in.dir)
+}
+
+func TestMain(m *testing.M) {
+	var err error
+	testInstance, err = startInstance()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "postgres tests are skipped, no local instance: %s\n", err)
+	}
+
+	code := m.Run()
+	if testInstance != nil {
+		testInstance.stop()
+	}
+	os.Exit(code)
+}
+
+//createDB creates an empty database without any tables
+func createDB(t *testing.T) *DB {
+	testInstance.mutex.Lock()
+	testInstance.created++
+	dbname := "test_" + strconv.Itoa(testInstance.created)
+	testInstance.mutex.Unlock()
+
+	admin, err := sql.Open("postgres", testInstance.dsn("postgres"))
+	if err != nil {
+		t.Fatalf("can't connect to postgres: %s", err)
+	}
+	defer admin.Close()
+	_, err = admin.Exec("CREATE DATABASE " + dbname)
+	if err != nil {
+		t.Fatalf("can't create database %s: %s", dbname, err)
+	}
+
+	cfg := Config{
+		URL:             testInstance.dsn(dbname),
+		MaxConnections:  10,
+		MaxConnLifetime: time.Minute,
+		QueryTimeout:    5 * time.Second,
+	}
+	db, err := New(zap.NewNop(), cfg)
+	if err != nil {
+		t.Fatalf("can't open database: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func migrate(t *testing.T, db *DB) {
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("can't load migrations: %s", err)
+	}
+	_, err = migrator.Up()
+	if err != nil {
+		t.Fatalf("can't migrate database: %s", err)
+	}
+}
+
+//newDB creates an empty database with every migration applied
+func newDB(t *testing.T) *DB {
+	db := createDB(t)
+	migrate(t, db)
+	return db
+}
+
+func newStorages(t *testing.T) storagetest.Storages {
+	return newStoragesOf(t, newDB(t))
+}
+
+func newStoragesOf(t *testing.T, db *DB) storagetest.Storages {
+	us, err := NewUserStorage(db)
+	if err != nil {
+		t.Fatalf("can't create users storage: %s", err)
+	}
+	is, err := NewIdentityStorage(db)
+	if err != nil {
+		t.Fatalf("can't create identities storage: %s", err)
+	}
+	ss, err := NewSessionStorage(db)
+	if err != nil {
+		t.Fatalf("can't create sessions storage: %s", err)
+	}
+	rs, err := NewRobotStorage(db, storagetest.RobotUpdates(t))
+	if err != nil {
+		t.Fatalf("can't create robots storage: %s", err)
+	}
+
+	return storagetest.Storages{
+		Users:      us,
+		Identities: is,
+		Sessions:   ss,
+		Robots:     rs,
+		Transactor: NewTransactor(db, us, is, ss, rs),
+	}
+}
+
+func TestStorages(t *testing.T) {
+	if testInstance == nil {
+		t.Skip("no local postgres, put initdb and pg_ctl on PATH or set PG_BIN")
+	}
+	storagetest.Run(t, newStorages)
+}
+
+//baselineSchema is what deployments had before migrations existed
+const baselineSchema = `CREATE TABLE users (id bigint PRIMARY KEY, first_name text, last_name text,
+birthday date, email text, password text, created_at timestamptz, updated_at timestamptz);
+CREATE TABLE sessions (session_id text PRIMARY KEY, user_id bigint, created_at timestamptz,
+valid_until timestamptz);
+CREATE TABLE robots (robot_id bigint PRIMARY KEY, owner_user_id bigint, is_favourite boolean,
+is_active boolean, parent_robot_id bigint, ticker text, buy_price double precision,
+sell_price double precision, plan_start timestamptz, plan_end timestamptz,
+plan_yield double precision, fact_yield double precision, deals_counts bigint,
+deleted_at timestamptz, activated_at timestamptz, deactivated_at timestamptz, created_at timestamptz);
+INSERT INTO users VALUES (7, 'Ann', 'Lee', '1990-01-02', 'ann@example.com', 'MFRGGZDFMZTWQ2LK', now(), now());
+INSERT INTO sessions VALUES ('bearer', 7, now(), now() + interval '1 hour');
+INSERT INTO robots VALUES (3, 7, false, false, 0, 'AAPL', 5, 6, NULL, NULL, 0, 0, 0, NULL, NULL, NULL, now());`
+
+func TestMigrateBaseline(t *testing.T) {
+	if testInstance == nil {
+		t.Skip("no local postgres, put initdb and pg_ctl on PATH or set PG_BIN")
+	}
+
+	db := createDB(t)
+	_, err := db.Base.Exec(baselineSchema)
+	if err != nil {
+		t.Fatalf("can't create baseline schema: %s", err)
+	}
+	migrate(t, db)
+
+	st := newStoragesOf(t, db)
+	ctx := context.Background()
+	user, err := st.Users.GetByID(ctx, 7)
+	if err != nil || user == nil {
+		t.Fatalf("baseline user is gone: %v, %v", user, err)
+	}
+	if user.Password != "MFRGGZDFMZTWQ2LK" || user.Role != users.RoleUser {
+		t.Errorf("baseline user came out as %+v", user)
+	}
+
+	robot, err := st.Robots.GetByRobotID(ctx, 3)
+	if err != nil || robot == nil || robot.OwnerUserID != 7 {
+		t.Fatalf("baseline robot came out as %v, %v", robot, err)
+	}
+
+	//ids continue after the baseline rows
+	created := users.User{FirstName: "Bob", LastName: "Lee", Email: "bob@example.com", Password: "hash",
+		Role: users.RoleUser, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	err = st.Users.Create(ctx, &created)
+	if err != nil || created.ID <= 7 {
+		t.Errorf("new user got id %d, %v", created.ID, err)
+	}
+}
@@ -0,0 +1,156 @@
+package robots
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+//Sort keys robots can be listed by, ties are broken by robot_id.
+const (
+	SortRobotID     = "robot_id"
+	SortCreatedAt   = "created_at"
+	SortTicker      = "ticker"
+	SortBuyPrice    = "buy_price"
+	SortSellPrice   = "sell_price"
+	SortPlanYield   = "plan_yield"
+	SortFactYield   = "fact_yield"
+	SortDealsCounts = "deals_counts"
+)
+
+var ErrCursor = errors.New("invalid cursor")
+
+//Filter of a robots listing, nil and zero fields don't filter.
+type Filter struct {
+	OwnerID     int64
+	Ticker      string
+	IsActive    *bool
+	IsFavourite *bool
+	Deleted     *bool
+
+	PlanStartFrom *time.Time
+	PlanStartTo   *time.Time
+	PlanEndFrom   *time.Time
+	PlanEndTo     *time.Time
+
+	MinPlanYield *float64
+	MaxPlanYield *float64
+	MinFactYield *float64
+	MaxFactYield *float64
+
+	Sort string
+	Desc bool
+	//Limit 0 lists everything, it is used by exports
+	Limit int
+	After *Cursor
+}
+
+//Cursor points at the last robot of a page, the next page starts
+//right after it in the same order.
+type Cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+func IsSortKey(sort string) bool {
+	switch sort {
+	case SortRobotID, SortCreatedAt, SortTicker, SortBuyPrice, SortSellPrice,
+		SortPlanYield, SortFactYield, SortDealsCounts:
+		return true
+	}
+	return false
+}
+
+//sortValue is the robot's value of the sort key as the storage
+//compares it, unset created_at sorts as the zero unix time.
+func sortValue(robo *Robot, sort string) string {
+	switch sort {
+	case SortCreatedAt:
+		if robo.CreatedAt == nil {
+			return time.Unix(0, 0).UTC().Format(time.RFC3339Nano)
+		}
+		return robo.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case SortTicker:
+		return robo.Ticker
+	case SortBuyPrice:
+		return strconv.FormatFloat(robo.BuyPrice, 'g', -1, 64)
+	case SortSellPrice:
+		return strconv.FormatFloat(robo.SellPrice, 'g', -1, 64)
+	case SortPlanYield:
+		return strconv.FormatFloat(robo.PlanYield, 'g', -1, 64)
+	case SortFactYield:
+		return strconv.FormatFloat(robo.FactYield, 'g', -1, 64)
+	case SortDealsCounts:
+		return strconv.FormatInt(robo.DealsCount, 10)
+	}
+	return strconv.FormatInt(robo.RobotID, 10)
+}
+
+//NextCursor returns the cursor of the page that follows robo.
+func (f *Filter) NextCursor(robo *Robot) string {
+	return encodeCursor(Cursor{Sort: f.Sort, Desc: f.Desc, Value: sortValue(robo, f.Sort), ID: robo.RobotID})
+}
+
+//ParseCursor checks that the cursor was made for the same order,
+//a cursor of another order would skip or repeat robots.
+func (f *Filter) ParseCursor(cursor string) error {
+	c, err := decodeCursor(cursor, f.Sort, f.Desc)
+	if err != nil {
+		return err
+	}
+
+	f.After = c
+	return nil
+}
+
+func encodeCursor(c Cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor, sort string, desc bool) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrCursor
+	}
+
+	c := Cursor{}
+	err = json.Unmarshal(data, &c)
+	if err != nil || c.Sort != sort || c.Desc != desc || !validValue(sort, c.Value) {
+		return nil, ErrCursor
+	}
+
+	return &c, nil
+}
+
+//validValue tells if value reads as the type of the sort key,
+//storages compare it with their column as it is.
+func validValue(sort, value string) bool {
+	var err error
+	switch sort {
+	case SortCreatedAt:
+		_, err = time.Parse(time.RFC3339Nano, value)
+	case SortTicker:
+	case SortBuyPrice, SortSellPrice, SortPlanYield, SortFactYield, sortRank:
+		var f float64
+		f, err = strconv.ParseFloat(value, 64)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return false
+		}
+	default:
+		//robot_id and deals_counts
+		_, err = strconv.ParseInt(value, 10, 64)
+	}
+	return err == nil
+}
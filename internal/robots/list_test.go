@@ -0,0 +1,55 @@
+package robots
+
+import (
+	"testing"
+)
+
+func TestParseCursor(t *testing.T) {
+	tests := []struct {
+		name  string
+		sort  string
+		value string
+		ok    bool
+	}{
+		{"robot id", SortRobotID, "42", true},
+		{"robot id not a number", SortRobotID, "42abc", false},
+		{"default sort", "", "42", true},
+		{"created at", SortCreatedAt, "2020-01-02T03:04:05.123Z", true},
+		{"created at not a time", SortCreatedAt, "yesterday", false},
+		{"ticker", SortTicker, "anything", true},
+		{"price", SortBuyPrice, "10.5", true},
+		{"price not a number", SortBuyPrice, "ten", false},
+		{"price infinite", SortSellPrice, "Inf", false},
+		{"yield NaN", SortPlanYield, "NaN", false},
+		{"deals count", SortDealsCounts, "3", true},
+		{"deals count fractional", SortDealsCounts, "3.5", false},
+	}
+
+	for _, tt := range tests {
+		cursor := encodeCursor(Cursor{Sort: tt.sort, Value: tt.value, ID: 7})
+		filter := &Filter{Sort: tt.sort}
+		err := filter.ParseCursor(cursor)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: ParseCursor returned %v", tt.name, err)
+		}
+		if err == nil && (filter.After == nil || filter.After.Value != tt.value || filter.After.ID != 7) {
+			t.Errorf("%s: got cursor %+v", tt.name, filter.After)
+		}
+	}
+
+	filter := &Filter{Sort: SortTicker, Desc: true}
+	if filter.ParseCursor(encodeCursor(Cursor{Sort: SortTicker, Value: "AAPL"})) == nil {
+		t.Errorf("cursor of another direction accepted")
+	}
+	if filter.ParseCursor("not base64!") == nil {
+		t.Errorf("malformed cursor accepted")
+	}
+
+	search := &Search{}
+	if search.ParseCursor(encodeCursor(Cursor{Sort: sortRank, Desc: true, Value: "0.8"})) != nil {
+		t.Errorf("search cursor rejected")
+	}
+	if search.ParseCursor(encodeCursor(Cursor{Sort: sortRank, Desc: true, Value: "best"})) == nil {
+		t.Errorf("search cursor with a bad rank accepted")
+	}
+}
@@ -1,6 +1,7 @@
 package robots
 
 import (
+	"context"
 	"time"
 )
 
@@ -22,17 +23,26 @@ type Robot struct {
 	ActivatedAt   *time.Time `json:"activated_at,omitempty"`
 	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
 	CreatedAt     *time.Time `json:"created_at"`
+	Tags          []string   `json:"tags,omitempty"`
 }
 
 type Storage interface {
-	Create(robo *Robot) error
-	GetByTickerAndOwnerID(ticker string, ownerID int64) ([]Robot, error)
-	GetByOwnerID(ownerID int64) ([]Robot, error)
-	GetByRobotID(roboID int64) (*Robot, error)
-	GetAllRobots() ([]Robot, error)
-	UpdateRobot(robo *Robot) error
-	ActivateRobot(robo *Robot) error
-	DeactivateRobot(robo *Robot) error
-	NextID() (int64, error)
-	DeleteRobot(robo *Robot) error
+	Create(ctx context.Context, robo *Robot) error
+	GetByTickerAndOwnerID(ctx context.Context, ticker string, ownerID int64) ([]Robot, error)
+	GetByOwnerID(ctx context.Context, ownerID int64) ([]Robot, error)
+	GetByRobotID(ctx context.Context, roboID int64) (*Robot, error)
+	GetAllRobots(ctx context.Context) ([]Robot, error)
+	StreamByTickerAndOwnerID(ctx context.Context, ticker string, ownerID int64, fn func(robo *Robot) error) error
+	List(ctx context.Context, filter *Filter) ([]Robot, string, error)
+	StreamList(ctx context.Context, filter *Filter, fn func(robo *Robot) error) error
+	Search(ctx context.Context, search *Search) ([]SearchHit, string, error)
+	//UpdateRobot stores the robot as it is, except for deleted_at,
+	//is_active and its times, they have their own methods
+	UpdateRobot(ctx context.Context, robo *Robot) error
+	ActivateRobot(ctx context.Context, robo *Robot) error
+	DeactivateRobot(ctx context.Context, robo *Robot) error
+	DeleteRobot(ctx context.Context, robo *Robot) error
+	//RobotsToRun lists robots that aren't deleted and are active
+	//or inside their planned period
+	RobotsToRun(ctx context.Context) ([]Robot, error)
 }
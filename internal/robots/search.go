@@ -0,0 +1,39 @@
+package robots
+
+import (
+	"strconv"
+)
+
+//sort key of search cursors, hits are always ranked best first
+const sortRank = "rank"
+
+//Search of robots by ticker prefix, tag and, if MatchOwners
+//is set, by the owner's name or email.
+type Search struct {
+	Query       string
+	OwnerID     int64
+	MatchOwners bool
+	Limit       int
+	After       *Cursor
+}
+
+//SearchHit is a robot with its rank, from 0 to 1.
+type SearchHit struct {
+	Robot
+	Rank float64 `json:"rank"`
+}
+
+func (s *Search) NextCursor(hit *SearchHit) string {
+	return encodeCursor(Cursor{Sort: sortRank, Desc: true,
+		Value: strconv.FormatFloat(hit.Rank, 'g', -1, 64), ID: hit.RobotID})
+}
+
+func (s *Search) ParseCursor(cursor string) error {
+	c, err := decodeCursor(cursor, sortRank, true)
+	if err != nil {
+		return err
+	}
+
+	s.After = c
+	return nil
+}
@@ -0,0 +1,119 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+//RevocationList is an in-memory copy of the revocations table.
+//Signed access tokens are checked against it instead of
+//the database, it is reloaded in the background.
+type RevocationList struct {
+	logger  *zap.Logger
+	storage Storage
+
+	mutex    sync.RWMutex
+	sessions map[string]time.Time //session id -> expires at
+	users    map[int64]Revocation
+	loaded   time.Time
+}
+
+func NewRevocationList(logger *zap.Logger, storage Storage) *RevocationList {
+	return &RevocationList{
+		logger:   logger,
+		storage:  storage,
+		sessions: make(map[string]time.Time),
+		users:    make(map[int64]Revocation),
+	}
+}
+
+//Add makes the revocation visible to this process immediately,
+//other processes see it after their next Refresh.
+func (rl *RevocationList) Add(rev Revocation) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	rl.add(rev)
+}
+
+func (rl *RevocationList) add(rev Revocation) {
+	if rev.SessionID != "" {
+		rl.sessions[rev.SessionID] = rev.ExpiresAt
+		return
+	}
+
+	if old, ok := rl.users[rev.UserID]; !ok || old.RevokedAt.Before(rev.RevokedAt) {
+		rl.users[rev.UserID] = rev
+	}
+}
+
+//IsRevoked tells if a token of the session issued at issuedAt was revoked.
+//A user-wide revocation covers tokens issued up to and including its time.
+func (rl *RevocationList) IsRevoked(sessionID string, userID int64, issuedAt time.Time) bool {
+	rl.mutex.RLock()
+	defer rl.mutex.RUnlock()
+
+	if _, ok := rl.sessions[sessionID]; ok {
+		return true
+	}
+
+	rev, ok := rl.users[userID]
+	return ok && !issuedAt.After(rev.RevokedAt)
+}
+
+//Refresh loads revocations made since the previous load
+//and forgets the ones that have expired.
+func (rl *RevocationList) Refresh(ctx context.Context) error {
+	timeNow := time.Now().UTC()
+
+	rl.mutex.RLock()
+	//overlap covers clock skew between processes
+	since := rl.loaded.Add(-time.Minute)
+	rl.mutex.RUnlock()
+
+	revs, err := rl.storage.RevocationsSince(ctx, since)
+	if err != nil {
+		return errors.Wrap(err, "can't load revocations")
+	}
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	for _, rev := range revs {
+		rl.add(rev)
+	}
+
+	for id, expiresAt := range rl.sessions {
+		if expiresAt.Before(timeNow) {
+			delete(rl.sessions, id)
+		}
+	}
+	for id, rev := range rl.users {
+		if rev.ExpiresAt.Before(timeNow) {
+			delete(rl.users, id)
+		}
+	}
+
+	rl.loaded = timeNow
+	return nil
+}
+
+func (rl *RevocationList) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := rl.Refresh(ctx); err != nil {
+				rl.logger.Sugar().Errorf("RevocationList:: %s", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestIsRevoked(t *testing.T) {
+	revokedAt := time.Date(2026, 1, 2, 10, 0, 0, 700*int(time.Millisecond), time.UTC)
+	rl := NewRevocationList(zap.NewNop(), nil)
+	rl.Add(Revocation{UserID: 1, RevokedAt: revokedAt, ExpiresAt: revokedAt.Add(time.Hour)})
+	rl.Add(Revocation{SessionID: "s1", UserID: 2, RevokedAt: revokedAt, ExpiresAt: revokedAt.Add(time.Hour)})
+
+	cases := []struct {
+		name      string
+		sessionID string
+		userID    int64
+		issuedAt  time.Time
+		want      bool
+	}{
+		{"issued a millisecond before", "s2", 1, revokedAt.Add(-time.Millisecond), true},
+		{"issued at the revocation", "s2", 1, revokedAt, true},
+		{"issued earlier in its second", "s2", 1, revokedAt.Truncate(time.Second), true},
+		{"issued a millisecond after", "s2", 1, revokedAt.Add(time.Millisecond), false},
+		{"another user", "s2", 3, revokedAt.Add(-time.Minute), false},
+		{"revoked session", "s1", 2, revokedAt.Add(time.Minute), true},
+	}
+	for _, c := range cases {
+		got := rl.IsRevoked(c.sessionID, c.userID, c.issuedAt)
+		if got != c.want {
+			t.Errorf("%s: IsRevoked returned %v, want %v", c.name, got, c.want)
+		}
+	}
+}
@@ -1,19 +1,79 @@
 package session
 
 import (
+	"context"
 	"time"
 )
 
+//Session is identified by a random SessionID.
+//The bearer token given to the client is never stored,
+//only its hash is, so a leaked sessions table can't be
+//used to sign in.
+//A user can have any number of sessions, one per device.
 type Session struct {
-	SessionID  string
-	UserID     int64
-	CreatedAt  time.Time
-	ValidUntil time.Time
+	SessionID  string    `json:"session_id"`
+	TokenHash  string    `json:"-"`
+	UserID     int64     `json:"user_id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ValidUntil time.Time `json:"valid_until"` //slides forward on every request
+	ExpiresAt  time.Time `json:"expires_at"`  //never moves, ValidUntil can't pass it
+}
+
+//RefreshToken can be exchanged once for a new bearer and a new refresh token.
+//Used tokens are kept until they expire, so a second use of the same
+//token can be detected and the whole session revoked.
+type RefreshToken struct {
+	TokenHash string
+	SessionID string
+	UserID    int64
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+//Revocation makes signed access tokens of the session invalid
+//before they expire. Revocation without SessionID covers every
+//token of the user issued before RevokedAt.
+type Revocation struct {
+	SessionID string
+	UserID    int64
+	RevokedAt time.Time
+	ExpiresAt time.Time //tokens it covers are expired by then anyway
+}
+
+//Lifetime is how long a session lives without requests (Idle)
+//and how long it lives at all (Absolute).
+type Lifetime struct {
+	Idle     time.Duration
+	Absolute time.Duration
+}
+
+//Slide moves ValidUntil of the session forward but not past ExpiresAt.
+func (l Lifetime) Slide(sess *Session, now time.Time) {
+	sess.ValidUntil = now.Add(l.Idle)
+	if sess.ValidUntil.After(sess.ExpiresAt) {
+		sess.ValidUntil = sess.ExpiresAt
+	}
 }
 
 type Storage interface {
-	Create(sess *Session) error
-	DeleteByUserID(userID int64) error
-	GetByUserID(userID int64) (*Session, error)
-	GetByBearer(bearer string) (*Session, error)
+	Create(ctx context.Context, sess *Session) error
+	DeleteByUserID(ctx context.Context, userID int64) error
+	DeleteByTokenHash(ctx context.Context, hash string) error
+	DeleteBySessionID(ctx context.Context, sessionID string) error
+	GetBySessionID(ctx context.Context, sessionID string) (*Session, error)
+	GetByTokenHash(ctx context.Context, hash string) (*Session, error)
+	ListByUserID(ctx context.Context, userID int64) ([]Session, error)
+	Touch(ctx context.Context, sess *Session) error
+	Rotate(ctx context.Context, sess *Session) error
+
+	CreateRefreshToken(ctx context.Context, rt *RefreshToken) error
+	GetRefreshToken(ctx context.Context, hash string) (*RefreshToken, error)
+	UseRefreshToken(ctx context.Context, hash string, usedAt time.Time) (bool, error)
+
+	Revoke(ctx context.Context, rev *Revocation) error
+	RevocationsSince(ctx context.Context, since time.Time) ([]Revocation, error)
 }
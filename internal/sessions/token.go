@@ -0,0 +1,42 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	tokenLen = 32
+	idLen    = 16
+)
+
+//NewToken returns a bearer token built from crypto/rand.
+func NewToken() (string, error) {
+	buf := make([]byte, tokenLen)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.Wrap(err, "can't generate token")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+//NewID returns a random session id, it is safe to show to the user.
+func NewID() (string, error) {
+	buf := make([]byte, idLen)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.Wrap(err, "can't generate session id")
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+//HashToken is what is stored and looked up instead of the token.
+//Tokens have 256 bits of entropy, so a fast hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
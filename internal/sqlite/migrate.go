@@ -0,0 +1,84 @@
+package sqlite
+
+import (
+	"embed"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//Migrations are NNNN_name.sql files applied in the order of NNNN.
+//A sqlite file belongs to one node, which migrates it on start,
+//so there are no down migrations. Applied files are never edited.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const createMigrationsTableQuery = `CREATE TABLE IF NOT EXISTS schema_migrations (
+version integer PRIMARY KEY, name text NOT NULL, applied_at timestamp NOT NULL)`
+
+//Migrate applies the pending migrations, each in its own transaction.
+func (db *DB) Migrate() error {
+	_, err := db.Base.Exec(createMigrationsTableQuery)
+	if err != nil {
+		return errors.Wrap(err, "can't create schema_migrations")
+	}
+
+	//ReadDir sorts by name, that is by version
+	files, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return errors.Wrap(err, "can't read migrations")
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), ".sql")
+		parts := strings.SplitN(name, "_", 2)
+		version, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || len(parts) != 2 {
+			return errors.Errorf("migration %s isn't named NNNN_name.sql", file.Name())
+		}
+
+		err = db.migrate(version, parts[1], path.Join("migrations", file.Name()))
+		if err != nil {
+			return errors.Wrapf(err, "can't apply migration %s", name)
+		}
+	}
+
+	return nil
+}
+
+func (db *DB) migrate(version int64, name, file string) error {
+	data, err := migrationFiles.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Base.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var applied int
+	err = tx.QueryRow(`SELECT count(*) FROM schema_migrations WHERE version = ?1`, version).Scan(&applied)
+	if err != nil || applied > 0 {
+		return err
+	}
+
+	_, err = tx.Exec(string(data))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?1, ?2, ?3)`,
+		version, name, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	db.Logger.Sugar().Infof("Migrate:: applied %d_%s", version, name)
+	return tx.Commit()
+}
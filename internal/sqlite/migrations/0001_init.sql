@@ -0,0 +1,108 @@
+CREATE TABLE users (
+    id                INTEGER PRIMARY KEY AUTOINCREMENT,
+    first_name        text NOT NULL,
+    last_name         text NOT NULL,
+    birthday          date,
+    email             text NOT NULL UNIQUE,
+    password          text NOT NULL,
+    role              text NOT NULL DEFAULT 'user',
+    created_at        timestamp NOT NULL,
+    updated_at        timestamp NOT NULL,
+    totp_secret       text NOT NULL DEFAULT '',
+    totp_enabled_at   timestamp,
+    totp_counter      integer NOT NULL DEFAULT 0,
+    email_verified_at timestamp
+);
+
+CREATE TABLE recovery_codes (
+    user_id   integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash text NOT NULL,
+    used_at   timestamp,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+CREATE TABLE user_identities (
+    provider   text NOT NULL,
+    subject    text NOT NULL,
+    user_id    integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    email      text NOT NULL,
+    created_at timestamp NOT NULL,
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX user_identities_user_id ON user_identities (user_id);
+
+CREATE TABLE sessions (
+    session_id   text PRIMARY KEY,
+    token_hash   text NOT NULL UNIQUE,
+    user_id      integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    user_agent   text NOT NULL,
+    ip           text NOT NULL,
+    created_at   timestamp NOT NULL,
+    last_seen_at timestamp NOT NULL,
+    valid_until  timestamp NOT NULL,
+    expires_at   timestamp NOT NULL
+);
+
+CREATE INDEX sessions_user_id ON sessions (user_id);
+
+CREATE TABLE refresh_tokens (
+    token_hash text PRIMARY KEY,
+    session_id text NOT NULL REFERENCES sessions (session_id) ON DELETE CASCADE,
+    user_id    integer NOT NULL,
+    created_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL,
+    used_at    timestamp
+);
+
+CREATE TABLE session_revocations (
+    session_id text PRIMARY KEY,
+    user_id    integer NOT NULL,
+    revoked_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL
+);
+
+CREATE INDEX session_revocations_revoked_at ON session_revocations (revoked_at);
+
+CREATE TABLE api_keys (
+    key_id       text PRIMARY KEY,
+    user_id      integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name         text NOT NULL,
+    key_hash     text NOT NULL UNIQUE,
+    scopes       text NOT NULL DEFAULT '[]',
+    allowed_ips  text NOT NULL DEFAULT '[]',
+    expires_at   timestamp,
+    created_at   timestamp NOT NULL,
+    last_used_at timestamp
+);
+
+CREATE INDEX api_keys_user_id ON api_keys (user_id);
+
+CREATE TABLE used_tokens (
+    token_id   text PRIMARY KEY,
+    expires_at timestamp NOT NULL
+);
+
+CREATE TABLE robots (
+    robot_id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    owner_user_id   integer NOT NULL REFERENCES users (id),
+    parent_robot_id integer NOT NULL DEFAULT 0,
+    is_favourite    boolean NOT NULL DEFAULT FALSE,
+    is_active       boolean NOT NULL DEFAULT FALSE,
+    ticker          text NOT NULL DEFAULT '',
+    buy_price       real NOT NULL DEFAULT 0,
+    sell_price      real NOT NULL DEFAULT 0,
+    plan_start      timestamp,
+    plan_end        timestamp,
+    plan_yield      real NOT NULL DEFAULT 0,
+    fact_yield      real NOT NULL DEFAULT 0,
+    deals_counts    integer NOT NULL DEFAULT 0,
+    deleted_at      timestamp,
+    activated_at    timestamp,
+    deactivated_at  timestamp,
+    created_at      timestamp,
+    tags            text NOT NULL DEFAULT '[]'
+);
+
+CREATE INDEX robots_owner_user_id ON robots (owner_user_id);
+CREATE INDEX robots_ticker ON robots (ticker);
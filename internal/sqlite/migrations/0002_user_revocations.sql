@@ -0,0 +1,18 @@
+CREATE TABLE session_revocations_new (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id text,
+    user_id    integer NOT NULL,
+    revoked_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL
+);
+
+INSERT INTO session_revocations_new (session_id, user_id, revoked_at, expires_at)
+SELECT NULLIF(session_id, ''), user_id, revoked_at, expires_at FROM session_revocations;
+
+DROP TABLE session_revocations;
+ALTER TABLE session_revocations_new RENAME TO session_revocations;
+
+CREATE UNIQUE INDEX session_revocations_session_id ON session_revocations (session_id)
+    WHERE session_id IS NOT NULL;
+CREATE INDEX session_revocations_revoked_at ON session_revocations (revoked_at);
+CREATE INDEX session_revocations_user_id ON session_revocations (user_id, revoked_at);
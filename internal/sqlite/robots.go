@@ -0,0 +1,541 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	robots "finPrj/internal/robots"
+
+	"github.com/pkg/errors"
+)
+
+var _ robots.Storage = &RobotStorage{}
+
+type RobotStorage struct {
+	statementStorage
+
+	CreateRobotStmt           *sql.Stmt
+	GetByTickerAndOwnerIDStmt *sql.Stmt
+	GetByTickerStmt           *sql.Stmt
+	GetByOwnerIDStmt          *sql.Stmt
+	GetByRobotIDStmt          *sql.Stmt
+	GetAllRobotsStmt          *sql.Stmt
+	UpdateRobotStmt           *sql.Stmt
+	ActivateRobotStmt         *sql.Stmt
+	DeactivateRobotStmt       *sql.Stmt
+	DeleteStmt                *sql.Stmt
+	RobotsToRunStmt           *sql.Stmt
+
+	roboUpd chan<- *robots.Robot
+}
+
+func NewRobotStorage(db *DB, roboUpd chan<- *robots.Robot) (*RobotStorage, error) {
+	rs := &RobotStorage{statementStorage: newStatementsStorage(db), roboUpd: roboUpd}
+
+	if err := rs.initStatements(rs.stmts()); err != nil {
+		return nil, errors.Wrap(err, "can't init statements in users")
+	}
+
+	return rs, nil
+}
+
+func (rs *RobotStorage) stmts() []stmt {
+	return []stmt{
+		{Query: createRobotQuery, Dst: &rs.CreateRobotStmt},
+		{Query: getByTickerAndOwnerIDQuery, Dst: &rs.GetByTickerAndOwnerIDStmt},
+		{Query: getByTickerQuery, Dst: &rs.GetByTickerStmt},
+		{Query: getByOwnerIDQuery, Dst: &rs.GetByOwnerIDStmt},
+		{Query: getByRobotIDQuery, Dst: &rs.GetByRobotIDStmt},
+		{Query: getAllRobotsQuery, Dst: &rs.GetAllRobotsStmt},
+		{Query: updateRobotQuery, Dst: &rs.UpdateRobotStmt},
+		{Query: activateRobotQuery, Dst: &rs.ActivateRobotStmt},
+		{Query: deactivateRobotQuery, Dst: &rs.DeactivateRobotStmt},
+		{Query: deleteQuery, Dst: &rs.DeleteStmt},
+		{Query: robotsToRunQuery, Dst: &rs.RobotsToRunStmt},
+	}
+}
+
+//WithTx returns a copy of the storage working in tx
+func (rs *RobotStorage) WithTx(tx *Tx) *RobotStorage {
+	txrs := *rs
+	txrs.withTx(tx, txrs.stmts())
+	return &txrs
+}
+
+const createRobotQuery = `INSERT INTO robots (owner_user_id, is_favourite,
+is_active, parent_robot_id, ticker, buy_price, sell_price, plan_start,
+plan_end, plan_yield, fact_yield, deals_counts, activated_at,
+deactivated_at, created_at, tags) VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12, ?13, ?14, ?15, ?16) 
+RETURNING robot_id`
+
+//Create sets the id the database assigned to the robot
+func (rs *RobotStorage) Create(ctx context.Context, robo *robots.Robot) error {
+	ctx, cancel := rs.withTimeout(ctx)
+	defer cancel()
+
+	err := rs.CreateRobotStmt.QueryRowContext(ctx, robo.OwnerUserID, robo.IsFavourite,
+		robo.IsActive, robo.ParentRobotID, robo.Ticker, robo.BuyPrice, robo.SellPrice, utc(robo.PlanStart),
+		utc(robo.PlanEnd), robo.PlanYield, robo.FactYield, robo.DealsCount,
+		utc(robo.ActivatedAt), utc(robo.DeactivatedAt), utc(robo.CreatedAt), stringList(robo.Tags)).Scan(&robo.RobotID)
+	if err != nil {
+		return errors.Wrapf(err, "can't create new robot")
+	}
+
+	rs.notify(robo)
+
+	return nil
+}
+
+const getByTickerAndOwnerIDQuery = `SELECT robot_id, owner_user_id, is_favourite,
+is_active, parent_robot_id, ticker, buy_price, sell_price, plan_start,
+plan_end, plan_yield, fact_yield, deals_counts, deleted_at,
+activated_at, deactivated_at, created_at, tags FROM robots WHERE owner_user_id = ?1 AND ticker = ?2`
+
+const getByTickerQuery = `SELECT robot_id, owner_user_id, is_favourite,
+is_active, parent_robot_id, ticker, buy_price, sell_price, plan_start,
+plan_end, plan_yield, fact_yield, deals_counts, deleted_at,
+activated_at, deactivated_at, created_at, tags FROM robots WHERE ticker = ?1`
+
+//we expect that one of ticker or id is not zero value
+//in other case you should use GetAllRobots
+func (rs *RobotStorage) GetByTickerAndOwnerID(ctx context.Context, ticker string, ownerID int64) ([]robots.Robot, error) {
+	ctx, cancel := rs.withTimeout(ctx)
+	defer cancel()
+
+	if ticker == "" {
+		rows, err := rs.GetByOwnerIDStmt.QueryContext(ctx, ownerID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't get by tick&ownID")
+		}
+		return scanRobots(rows, "by tick&ownID")
+	}
+
+	if ownerID == 0 {
+		rows, err := rs.GetByTickerStmt.QueryContext(ctx, ticker)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't get by tick&ownID")
+		}
+		return scanRobots(rows, "by tick&ownID")
+	}
+
+	rows, err := rs.GetByTickerAndOwnerIDStmt.QueryContext(ctx, ownerID, ticker)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't get by tick&ownID")
+	}
+	return scanRobots(rows, "by tick&ownID")
+
+}
+
+//StreamByTickerAndOwnerID is GetByTickerAndOwnerID calling fn
+//row by row instead of collecting the robots
+func (rs *RobotStorage) StreamByTickerAndOwnerID(ctx context.Context, ticker string, ownerID int64,
+	fn func(robo *robots.Robot) error) error {
+	var rows *sql.Rows
+	var err error
+	switch {
+	case ticker == "":
+		rows, err = rs.GetByOwnerIDStmt.QueryContext(ctx, ownerID)
+	case ownerID == 0:
+		rows, err = rs.GetByTickerStmt.QueryContext(ctx, ticker)
+	default:
+		rows, err = rs.GetByTickerAndOwnerIDStmt.QueryContext(ctx, ownerID, ticker)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "can't stream by tick&ownID")
+	}
+
+	return streamRobots(rows, "by tick&ownID", fn)
+}
+
+const getByOwnerIDQuery = `SELECT robot_id, owner_user_id, is_favourite,
+is_active, parent_robot_id, ticker, buy_price, sell_price, plan_start,
+plan_end, plan_yield, fact_yield, deals_counts, deleted_at,
+activated_at, deactivated_at, created_at, tags FROM robots WHERE owner_user_id = ?1`
+
+func (rs *RobotStorage) GetByOwnerID(ctx context.Context, ownerID int64) ([]robots.Robot, error) {
+	ctx, cancel := rs.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := rs.GetByOwnerIDStmt.QueryContext(ctx, ownerID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't get by ownerID")
+	}
+
+	return scanRobots(rows, "by ownerID")
+}
+
+const getByRobotIDQuery = `SELECT robot_id, owner_user_id, is_favourite,
+is_active, parent_robot_id, ticker, buy_price, sell_price, plan_start,
+plan_end, plan_yield, fact_yield, deals_counts, deleted_at,
+activated_at, deactivated_at, created_at, tags FROM robots WHERE robot_id = ?1`
+
+func (rs *RobotStorage) GetByRobotID(ctx context.Context, roboID int64) (*robots.Robot, error) {
+	ctx, cancel := rs.withTimeout(ctx)
+	defer cancel()
+
+	row := rs.GetByRobotIDStmt.QueryRowContext(ctx, roboID)
+
+	robot := robots.Robot{}
+
+	err := scanRobot(row, &robot)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+
+		return nil, errors.Wrapf(err, "can't get robot by id")
+	}
+
+	return &robot, nil
+}
+
+const getAllRobotsQuery = `SELECT robot_id, owner_user_id, is_favourite,
+is_active, parent_robot_id, ticker, buy_price, sell_price, plan_start,
+plan_end, plan_yield, fact_yield, deals_counts, deleted_at,
+activated_at, deactivated_at, created_at, tags FROM robots`
+
+func (rs *RobotStorage) GetAllRobots(ctx context.Context) ([]robots.Robot, error) {
+	ctx, cancel := rs.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := rs.GetAllRobotsStmt.QueryContext(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't get all robots")
+	}
+
+	return scanRobots(rows, "all robots")
+}
+
+const robotColumns = `robot_id, owner_user_id, is_favourite,
+is_active, parent_robot_id, ticker, buy_price, sell_price, plan_start,
+plan_end, plan_yield, fact_yield, deals_counts, deleted_at,
+activated_at, deactivated_at, created_at, tags`
+
+//sortColumns are the expressions behind robots.Sort*, nothing
+//else goes into ORDER BY. Unset created_at sorts as the zero
+//unix time, as it is written by the driver.
+var sortColumns = map[string]string{
+	robots.SortRobotID:     "robot_id",
+	robots.SortCreatedAt:   "COALESCE(created_at, '1970-01-01 00:00:00+00:00')",
+	robots.SortTicker:      "ticker",
+	robots.SortBuyPrice:    "buy_price",
+	robots.SortSellPrice:   "sell_price",
+	robots.SortPlanYield:   "plan_yield",
+	robots.SortFactYield:   "fact_yield",
+	robots.SortDealsCounts: "deals_counts",
+}
+
+//cursorValue is the value of the cursor typed as its column,
+//sqlite compares values of different types by type first.
+func cursorValue(sortKey string, cursor *robots.Cursor) (interface{}, error) {
+	var value interface{}
+	var err error
+	switch sortKey {
+	case robots.SortCreatedAt:
+		var t time.Time
+		t, err = time.Parse(time.RFC3339Nano, cursor.Value)
+		value = t.UTC()
+	case robots.SortTicker:
+		value = cursor.Value
+	case robots.SortBuyPrice, robots.SortSellPrice, robots.SortPlanYield, robots.SortFactYield:
+		value, err = strconv.ParseFloat(cursor.Value, 64)
+	default:
+		//robot_id and deals_counts
+		value, err = strconv.ParseInt(cursor.Value, 10, 64)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(robots.ErrCursor, "can't read cursor value %q", cursor.Value)
+	}
+
+	return value, nil
+}
+
+//listQuery builds the query of a robots listing, robots after the
+//cursor are found by keyset, not by offset.
+func listQuery(filter *robots.Filter) (string, []interface{}, error) {
+	qb := &queryBuilder{}
+
+	if filter.OwnerID != 0 {
+		qb.cond("owner_user_id = %s", filter.OwnerID)
+	}
+	if filter.Ticker != "" {
+		qb.cond("ticker = %s", filter.Ticker)
+	}
+	if filter.IsActive != nil {
+		qb.cond("is_active = %s", *filter.IsActive)
+	}
+	if filter.IsFavourite != nil {
+		qb.cond("is_favourite = %s", *filter.IsFavourite)
+	}
+	if filter.Deleted != nil {
+		if *filter.Deleted {
+			qb.cond("deleted_at IS NOT NULL")
+		} else {
+			qb.cond("deleted_at IS NULL")
+		}
+	}
+
+	ranges := []struct {
+		sql   string
+		value interface{}
+		set   bool
+	}{
+		{"plan_start >= %s", utc(filter.PlanStartFrom), filter.PlanStartFrom != nil},
+		{"plan_start <= %s", utc(filter.PlanStartTo), filter.PlanStartTo != nil},
+		{"plan_end >= %s", utc(filter.PlanEndFrom), filter.PlanEndFrom != nil},
+		{"plan_end <= %s", utc(filter.PlanEndTo), filter.PlanEndTo != nil},
+		{"plan_yield >= %s", filter.MinPlanYield, filter.MinPlanYield != nil},
+		{"plan_yield <= %s", filter.MaxPlanYield, filter.MaxPlanYield != nil},
+		{"fact_yield >= %s", filter.MinFactYield, filter.MinFactYield != nil},
+		{"fact_yield <= %s", filter.MaxFactYield, filter.MaxFactYield != nil},
+	}
+	for _, rg := range ranges {
+		if rg.set {
+			qb.cond(rg.sql, rg.value)
+		}
+	}
+
+	sortKey := filter.Sort
+	if _, ok := sortColumns[sortKey]; !ok {
+		sortKey = robots.SortRobotID
+	}
+	column := sortColumns[sortKey]
+	order, cmp := "ASC", ">"
+	if filter.Desc {
+		order, cmp = "DESC", "<"
+	}
+
+	if filter.After != nil {
+		value, err := cursorValue(sortKey, filter.After)
+		if err != nil {
+			return "", nil, err
+		}
+		qb.cond("("+column+", robot_id) "+cmp+" (%s, %s)", value, filter.After.ID)
+	}
+
+	query := "SELECT " + robotColumns + " FROM robots" + qb.whereSQL() +
+		" ORDER BY " + column + " " + order + ", robot_id " + order
+	if filter.Limit > 0 {
+		query += " LIMIT " + qb.arg(filter.Limit)
+	}
+
+	return query, qb.args, nil
+}
+
+//List returns a page of robots and the cursor of the next page,
+//which is empty on the last page.
+func (rs *RobotStorage) List(ctx context.Context, filter *robots.Filter) ([]robots.Robot, string, error) {
+	ctx, cancel := rs.withTimeout(ctx)
+	defer cancel()
+
+	//one more robot tells if there is a next page
+	page := *filter
+	if page.Limit > 0 {
+		page.Limit++
+	}
+
+	query, args, err := listQuery(&page)
+	if err != nil {
+		return nil, "", err
+	}
+	rows, err := rs.query(ctx, query, args...)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "can't list robots")
+	}
+	defer rows.Close()
+
+	robotsList, err := scanRobots(rows, "robots list")
+	if err != nil {
+		return nil, "", err
+	}
+
+	if filter.Limit <= 0 || len(robotsList) <= filter.Limit {
+		return robotsList, "", nil
+	}
+
+	robotsList = robotsList[:filter.Limit]
+	return robotsList, filter.NextCursor(&robotsList[filter.Limit-1]), nil
+}
+
+//StreamList is List without pages calling fn row by row
+func (rs *RobotStorage) StreamList(ctx context.Context, filter *robots.Filter, fn func(robo *robots.Robot) error) error {
+	query, args, err := listQuery(filter)
+	if err != nil {
+		return err
+	}
+	rows, err := rs.query(ctx, query, args...)
+	if err != nil {
+		return errors.Wrapf(err, "can't stream robots list")
+	}
+
+	return streamRobots(rows, "robots list", fn)
+}
+
+const updateRobotQuery = `UPDATE robots SET owner_user_id=?1, is_favourite=?2,
+parent_robot_id=?3, ticker=?4, buy_price=?5, sell_price=?6, plan_start=?7,
+plan_end=?8, plan_yield=?9, fact_yield=?10, deals_counts=?11,
+created_at=?12, tags=?13 WHERE robot_id = ?14`
+
+//expects that all field are filled with current data,
+//is_active and its times are changed by Activate/DeactivateRobot only
+func (rs *RobotStorage) UpdateRobot(ctx context.Context, robo *robots.Robot) error {
+	ctx, cancel := rs.withTimeout(ctx)
+	defer cancel()
+
+	_, err := rs.UpdateRobotStmt.ExecContext(ctx, robo.OwnerUserID, robo.IsFavourite,
+		robo.ParentRobotID, robo.Ticker, robo.BuyPrice, robo.SellPrice, utc(robo.PlanStart),
+		utc(robo.PlanEnd), robo.PlanYield, robo.FactYield, robo.DealsCount,
+		utc(robo.CreatedAt), stringList(robo.Tags), robo.RobotID)
+	if err != nil {
+		return errors.Wrapf(err, "can't update robot")
+	}
+
+	rs.notify(robo)
+
+	return nil
+}
+
+const activateRobotQuery = `UPDATE robots SET is_active=TRUE, activated_at=?1 WHERE robot_id = ?2`
+
+func (rs *RobotStorage) ActivateRobot(ctx context.Context, robo *robots.Robot) error {
+	ctx, cancel := rs.withTimeout(ctx)
+	defer cancel()
+
+	timeNow := time.Now().UTC()
+	robo.ActivatedAt = &timeNow
+	robo.IsActive = true
+	_, err := rs.ActivateRobotStmt.ExecContext(ctx, utc(robo.ActivatedAt), robo.RobotID)
+	if err != nil {
+		return errors.Wrapf(err, "can't activate robot %d", robo.RobotID)
+	}
+
+	rs.notify(robo)
+
+	return nil
+}
+
+const deactivateRobotQuery = `UPDATE robots SET is_active=FALSE, deactivated_at=?1 WHERE robot_id = ?2`
+
+func (rs *RobotStorage) DeactivateRobot(ctx context.Context, robo *robots.Robot) error {
+	ctx, cancel := rs.withTimeout(ctx)
+	defer cancel()
+
+	timeNow := time.Now().UTC()
+	robo.DeactivatedAt = &timeNow
+	robo.IsActive = false
+	_, err := rs.DeactivateRobotStmt.ExecContext(ctx, utc(robo.DeactivatedAt), robo.RobotID)
+	if err != nil {
+		return errors.Wrapf(err, "can't deactivate robot %d", robo.RobotID)
+	}
+
+	rs.notify(robo)
+
+	return nil
+}
+
+//notify publishes the change of robo, changes made in
+//a transaction are published once it is committed
+func (rs *RobotStorage) notify(robo *robots.Robot) {
+	if rs.tx != nil {
+		rs.tx.AfterCommit(func() { rs.roboUpd <- robo })
+		return
+	}
+
+	rs.roboUpd <- robo
+}
+
+//can be used for both deleting and recovering robot
+const deleteQuery = `UPDATE robots SET deleted_at = ?1 WHERE robot_id = ?2`
+
+func (rs *RobotStorage) DeleteRobot(ctx context.Context, robo *robots.Robot) error {
+	ctx, cancel := rs.withTimeout(ctx)
+	defer cancel()
+
+	timeNow := time.Now().UTC()
+	robo.DeletedAt = &timeNow
+	_, err := rs.DeleteStmt.ExecContext(ctx, utc(robo.DeletedAt), robo.RobotID)
+	if err != nil {
+		return errors.Wrapf(err, "can't delete robot %d", robo.RobotID)
+	}
+
+	rs.notify(robo)
+
+	return nil
+}
+
+const robotsToRunQuery = `SELECT robot_id, owner_user_id, is_favourite,
+is_active, parent_robot_id, ticker, buy_price, sell_price, plan_start,
+plan_end, plan_yield, fact_yield, deals_counts, deleted_at,
+activated_at, deactivated_at, created_at, tags FROM robots 
+WHERE (deleted_at is NULL) and ((plan_start < ?1) and (?1 < plan_end) or (is_active = true)) `
+
+func (rs *RobotStorage) RobotsToRun(ctx context.Context) ([]robots.Robot, error) {
+	ctx, cancel := rs.withTimeout(ctx)
+	defer cancel()
+
+	timeNow := time.Now().UTC()
+	rows, err := rs.RobotsToRunStmt.QueryContext(ctx, timeNow)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't get robots to run")
+	}
+
+	return scanRobots(rows, "robots to run")
+}
+
+//scanRobot scans robotColumns, extra are the columns selected after them
+func scanRobot(scanner sqlScanner, robo *robots.Robot, extra ...interface{}) error {
+	dest := []interface{}{&robo.RobotID, &robo.OwnerUserID, &robo.IsFavourite,
+		&robo.IsActive, &robo.ParentRobotID, &robo.Ticker, &robo.BuyPrice, &robo.SellPrice, &robo.PlanStart,
+		&robo.PlanEnd, &robo.PlanYield, &robo.FactYield, &robo.DealsCount, &robo.DeletedAt,
+		&robo.ActivatedAt, &robo.DeactivatedAt, &robo.CreatedAt, scanList{&robo.Tags}}
+	err := scanner.Scan(append(dest, extra...)...)
+
+	return err
+}
+
+func scanRobots(multiScanner sqlMultiScanner, msg string) ([]robots.Robot, error) {
+	robotsList := make([]robots.Robot, 0)
+	err := eachRobot(multiScanner, msg, func(robo *robots.Robot) error {
+		robotsList = append(robotsList, *robo)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return robotsList, nil
+}
+
+//eachRobot calls fn for every row as soon as it is scanned and
+//stops at the first error. The robot passed to fn is reused.
+func eachRobot(multiScanner sqlMultiScanner, msg string, fn func(robo *robots.Robot) error) error {
+	robot := robots.Robot{}
+	for multiScanner.Next() {
+		err := scanRobot(multiScanner, &robot)
+		if err != nil {
+			return errors.Wrapf(err, "can't scan "+msg)
+		}
+
+		err = fn(&robot)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//streamRobots closes rows, so a client going away mid export
+//doesn't leave the connection busy.
+func streamRobots(rows *sql.Rows, msg string, fn func(robo *robots.Robot) error) error {
+	defer rows.Close()
+
+	err := eachRobot(rows, msg, fn)
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrapf(rows.Err(), "can't read "+msg)
+}
@@ -0,0 +1,339 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	sessions "finPrj/internal/sessions"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var _ sessions.Storage = &SessionStorage{}
+
+type SessionStorage struct {
+	statementStorage
+
+	CreateStmt            *sql.Stmt
+	DeleteByUserIDStmt    *sql.Stmt
+	DeleteByTokenHashStmt *sql.Stmt
+	DeleteBySessionIDStmt *sql.Stmt
+	GetBySessionIDStmt    *sql.Stmt
+	GetByTokenHashStmt    *sql.Stmt
+	ListByUserIDStmt      *sql.Stmt
+	TouchStmt             *sql.Stmt
+	RotateStmt            *sql.Stmt
+
+	CreateRefreshTokenStmt *sql.Stmt
+	GetRefreshTokenStmt    *sql.Stmt
+	UseRefreshTokenStmt    *sql.Stmt
+
+	RevokeStmt           *sql.Stmt
+	RevocationsSinceStmt *sql.Stmt
+}
+
+func NewSessionStorage(db *DB) (*SessionStorage, error) {
+	ss := &SessionStorage{statementStorage: newStatementsStorage(db)}
+
+	if err := ss.initStatements(ss.stmts()); err != nil {
+		return nil, errors.Wrap(err, "can't init statements in sessions")
+	}
+
+	return ss, nil
+}
+
+func (ss *SessionStorage) stmts() []stmt {
+	return []stmt{
+		{Query: createSessionQuery, Dst: &ss.CreateStmt},
+		{Query: deleteByUserIDQuery, Dst: &ss.DeleteByUserIDStmt},
+		{Query: deleteByTokenHashQuery, Dst: &ss.DeleteByTokenHashStmt},
+		{Query: deleteBySessionIDQuery, Dst: &ss.DeleteBySessionIDStmt},
+		{Query: getBySessionIDQuery, Dst: &ss.GetBySessionIDStmt},
+		{Query: getByTokenHashQuery, Dst: &ss.GetByTokenHashStmt},
+		{Query: listByUserIDQuery, Dst: &ss.ListByUserIDStmt},
+		{Query: touchSessionQuery, Dst: &ss.TouchStmt},
+		{Query: rotateSessionQuery, Dst: &ss.RotateStmt},
+		{Query: createRefreshTokenQuery, Dst: &ss.CreateRefreshTokenStmt},
+		{Query: getRefreshTokenQuery, Dst: &ss.GetRefreshTokenStmt},
+		{Query: useRefreshTokenQuery, Dst: &ss.UseRefreshTokenStmt},
+		{Query: revokeQuery, Dst: &ss.RevokeStmt},
+		{Query: revocationsSinceQuery, Dst: &ss.RevocationsSinceStmt},
+	}
+}
+
+//WithTx returns a copy of the storage working in tx
+func (ss *SessionStorage) WithTx(tx *Tx) *SessionStorage {
+	txss := *ss
+	txss.withTx(tx, txss.stmts())
+	return &txss
+}
+
+func scanSession(scanner sqlScanner, sess *sessions.Session) error {
+	return scanner.Scan(&sess.SessionID, &sess.TokenHash, &sess.UserID, &sess.UserAgent, &sess.IP,
+		&sess.CreatedAt, &sess.LastSeenAt, &sess.ValidUntil, &sess.ExpiresAt)
+}
+
+const createSessionQuery = `INSERT INTO sessions (session_id, token_hash, user_id, user_agent, ip, 
+created_at, last_seen_at, valid_until, expires_at) 
+VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9)`
+
+func (ss *SessionStorage) Create(ctx context.Context, sess *sessions.Session) error {
+	ctx, cancel := ss.withTimeout(ctx)
+	defer cancel()
+
+	_, err := ss.CreateStmt.ExecContext(ctx, sess.SessionID, sess.TokenHash, sess.UserID, sess.UserAgent, sess.IP,
+		sess.CreatedAt.UTC(), sess.LastSeenAt.UTC(), sess.ValidUntil.UTC(), sess.ExpiresAt.UTC())
+	if err != nil {
+		return errors.Wrapf(err, "can't create session")
+	}
+
+	return nil
+}
+
+const deleteByUserIDQuery = `DELETE FROM sessions WHERE user_id = ?1`
+
+func (ss *SessionStorage) DeleteByUserID(ctx context.Context, userID int64) error {
+	ctx, cancel := ss.withTimeout(ctx)
+	defer cancel()
+
+	_, err := ss.DeleteByUserIDStmt.ExecContext(ctx, userID)
+	if err != nil {
+		return errors.Wrapf(err, "can't delete session")
+	}
+
+	return nil
+}
+
+const deleteByTokenHashQuery = `DELETE FROM sessions WHERE token_hash = ?1`
+
+func (ss *SessionStorage) DeleteByTokenHash(ctx context.Context, hash string) error {
+	ctx, cancel := ss.withTimeout(ctx)
+	defer cancel()
+
+	_, err := ss.DeleteByTokenHashStmt.ExecContext(ctx, hash)
+	if err != nil {
+		return errors.Wrapf(err, "can't delete session by token hash")
+	}
+
+	return nil
+}
+
+const deleteBySessionIDQuery = `DELETE FROM sessions WHERE session_id = ?1`
+
+func (ss *SessionStorage) DeleteBySessionID(ctx context.Context, sessionID string) error {
+	ctx, cancel := ss.withTimeout(ctx)
+	defer cancel()
+
+	_, err := ss.DeleteBySessionIDStmt.ExecContext(ctx, sessionID)
+	if err != nil {
+		return errors.Wrapf(err, "can't delete session %s", sessionID)
+	}
+
+	return nil
+}
+
+const getBySessionIDQuery = `SELECT session_id, token_hash, user_id, user_agent, ip, 
+created_at, last_seen_at, valid_until, expires_at 
+FROM sessions WHERE session_id = ?1`
+
+func (ss *SessionStorage) GetBySessionID(ctx context.Context, sessionID string) (*sessions.Session, error) {
+	ctx, cancel := ss.withTimeout(ctx)
+	defer cancel()
+
+	row := ss.GetBySessionIDStmt.QueryRowContext(ctx, sessionID)
+	sess := sessions.Session{}
+
+	err := scanSession(row, &sess)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "can't get session by id")
+	}
+
+	return &sess, nil
+}
+
+const getByTokenHashQuery = `SELECT session_id, token_hash, user_id, user_agent, ip, 
+created_at, last_seen_at, valid_until, expires_at 
+FROM sessions WHERE token_hash = ?1`
+
+func (ss *SessionStorage) GetByTokenHash(ctx context.Context, hash string) (*sessions.Session, error) {
+	ctx, cancel := ss.withTimeout(ctx)
+	defer cancel()
+
+	row := ss.GetByTokenHashStmt.QueryRowContext(ctx, hash)
+	sess := sessions.Session{}
+
+	err := scanSession(row, &sess)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "can't get session by token hash")
+	}
+
+	return &sess, nil
+}
+
+const listByUserIDQuery = `SELECT session_id, token_hash, user_id, user_agent, ip, 
+created_at, last_seen_at, valid_until, expires_at 
+FROM sessions WHERE user_id = ?1 ORDER BY last_seen_at DESC`
+
+func (ss *SessionStorage) ListByUserID(ctx context.Context, userID int64) ([]sessions.Session, error) {
+	ctx, cancel := ss.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := ss.ListByUserIDStmt.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't list sessions by user id")
+	}
+	defer rows.Close()
+
+	sess := sessions.Session{}
+	sessList := make([]sessions.Session, 0)
+	for rows.Next() {
+		err := scanSession(rows, &sess)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't scan session")
+		}
+
+		sessList = append(sessList, sess)
+	}
+
+	return sessList, errors.Wrap(rows.Err(), "can't list sessions by user id")
+}
+
+const touchSessionQuery = `UPDATE sessions SET last_seen_at = ?1, ip = ?2, user_agent = ?3, valid_until = ?4 
+WHERE session_id = ?5`
+
+//Touch saves LastSeenAt, IP, UserAgent and ValidUntil of the session.
+func (ss *SessionStorage) Touch(ctx context.Context, sess *sessions.Session) error {
+	ctx, cancel := ss.withTimeout(ctx)
+	defer cancel()
+
+	_, err := ss.TouchStmt.ExecContext(ctx, sess.LastSeenAt.UTC(), sess.IP, sess.UserAgent, sess.ValidUntil.UTC(), sess.SessionID)
+	if err != nil {
+		return errors.Wrapf(err, "can't touch session %s", sess.SessionID)
+	}
+
+	return nil
+}
+
+const rotateSessionQuery = `UPDATE sessions SET token_hash = ?1, last_seen_at = ?2, valid_until = ?3 
+WHERE session_id = ?4`
+
+//Rotate replaces the bearer of the session, the old one stops working.
+func (ss *SessionStorage) Rotate(ctx context.Context, sess *sessions.Session) error {
+	ctx, cancel := ss.withTimeout(ctx)
+	defer cancel()
+
+	_, err := ss.RotateStmt.ExecContext(ctx, sess.TokenHash, sess.LastSeenAt.UTC(), sess.ValidUntil.UTC(), sess.SessionID)
+	if err != nil {
+		return errors.Wrapf(err, "can't rotate session %s", sess.SessionID)
+	}
+
+	return nil
+}
+
+//refresh tokens are removed together with their session by ON DELETE CASCADE
+const createRefreshTokenQuery = `INSERT INTO refresh_tokens (token_hash, session_id, user_id, 
+created_at, expires_at) VALUES (?1, ?2, ?3, ?4, ?5)`
+
+func (ss *SessionStorage) CreateRefreshToken(ctx context.Context, rt *sessions.RefreshToken) error {
+	ctx, cancel := ss.withTimeout(ctx)
+	defer cancel()
+
+	_, err := ss.CreateRefreshTokenStmt.ExecContext(ctx, rt.TokenHash, rt.SessionID, rt.UserID, rt.CreatedAt.UTC(), rt.ExpiresAt.UTC())
+	if err != nil {
+		return errors.Wrapf(err, "can't create refresh token")
+	}
+
+	return nil
+}
+
+const getRefreshTokenQuery = `SELECT token_hash, session_id, user_id, created_at, expires_at, used_at 
+FROM refresh_tokens WHERE token_hash = ?1`
+
+func (ss *SessionStorage) GetRefreshToken(ctx context.Context, hash string) (*sessions.RefreshToken, error) {
+	ctx, cancel := ss.withTimeout(ctx)
+	defer cancel()
+
+	row := ss.GetRefreshTokenStmt.QueryRowContext(ctx, hash)
+	rt := sessions.RefreshToken{}
+
+	err := row.Scan(&rt.TokenHash, &rt.SessionID, &rt.UserID, &rt.CreatedAt, &rt.ExpiresAt, &rt.UsedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "can't get refresh token")
+	}
+
+	return &rt, nil
+}
+
+const useRefreshTokenQuery = `UPDATE refresh_tokens SET used_at = ?1 WHERE token_hash = ?2 AND used_at IS NULL`
+
+//UseRefreshToken marks the token as used.
+//It returns false if the token was already used, even concurrently.
+func (ss *SessionStorage) UseRefreshToken(ctx context.Context, hash string, usedAt time.Time) (bool, error) {
+	ctx, cancel := ss.withTimeout(ctx)
+	defer cancel()
+
+	res, err := ss.UseRefreshTokenStmt.ExecContext(ctx, usedAt.UTC(), hash)
+	if err != nil {
+		return false, errors.Wrapf(err, "can't use refresh token")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(err, "can't use refresh token")
+	}
+
+	return n == 1, nil
+}
+
+//user-wide revocations have no session, they are stored with a NULL one.
+//A session revoked twice keeps its first revocation.
+const revokeQuery = `INSERT OR IGNORE INTO session_revocations (session_id, user_id, revoked_at, expires_at) 
+VALUES (NULLIF(?1, ''), ?2, ?3, ?4)`
+
+func (ss *SessionStorage) Revoke(ctx context.Context, rev *sessions.Revocation) error {
+	ctx, cancel := ss.withTimeout(ctx)
+	defer cancel()
+
+	_, err := ss.RevokeStmt.ExecContext(ctx, rev.SessionID, rev.UserID, rev.RevokedAt.UTC(), rev.ExpiresAt.UTC())
+	if err != nil {
+		return errors.Wrapf(err, "can't revoke session")
+	}
+
+	return nil
+}
+
+const revocationsSinceQuery = `SELECT COALESCE(session_id, ''), user_id, revoked_at, expires_at 
+FROM session_revocations WHERE revoked_at > ?1 AND expires_at > ?2`
+
+func (ss *SessionStorage) RevocationsSince(ctx context.Context, since time.Time) ([]sessions.Revocation, error) {
+	ctx, cancel := ss.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := ss.RevocationsSinceStmt.QueryContext(ctx, since.UTC(), time.Now().UTC())
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't get revocations")
+	}
+	defer rows.Close()
+
+	rev := sessions.Revocation{}
+	revs := make([]sessions.Revocation, 0)
+	for rows.Next() {
+		err := rows.Scan(&rev.SessionID, &rev.UserID, &rev.RevokedAt, &rev.ExpiresAt)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't scan revocation")
+		}
+
+		revs = append(revs, rev)
+	}
+
+	return revs, errors.Wrap(rows.Err(), "can't get revocations")
+}
@@ -0,0 +1,124 @@
+package sqlite
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+//DB is one sqlite file for single node deployments. Writers wait
+//for each other up to Config.BusyTimeout instead of failing at once.
+type DB struct {
+	Base   *sql.DB
+	Logger *zap.Logger
+
+	QueryTimeout time.Duration
+}
+
+type Config struct {
+	//Path of the database file, it is created if it doesn't exist
+	Path        string
+	BusyTimeout time.Duration
+	//QueryTimeout is the longest one storage call may take,
+	//streamed exports are bound only by their caller's context
+	QueryTimeout time.Duration
+}
+
+func New(logger *zap.Logger, cfg Config) (*DB, error) {
+	//immediate transactions take the write lock when they begin,
+	//so two of them never deadlock upgrading a read lock
+	dsn := "file:" + cfg.Path + "?_foreign_keys=1&_journal_mode=WAL&_txlock=immediate" +
+		"&_busy_timeout=" + strconv.FormatInt(cfg.BusyTimeout.Milliseconds(), 10)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't open sqlite database")
+	}
+
+	return &DB{
+		Base:   db,
+		Logger: logger,
+
+		QueryTimeout: cfg.QueryTimeout,
+	}, nil
+}
+
+func (db *DB) CheckConnection() error {
+	return errors.Wrap(db.Base.Ping(), "can't open db")
+}
+
+func (db *DB) Close() error {
+	if err := db.Base.Close(); err != nil {
+		return errors.Wrap(err, "can't close db")
+	}
+	return nil
+}
+
+//isUniqueViolation tells if err is a unique or primary key violation
+func isUniqueViolation(err error) bool {
+	sqliteErr, ok := errors.Cause(err).(sqlite3.Error)
+	return ok && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+		sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+//utc is the value of t as it is stored. Times are kept as text,
+//they compare in order only if they are all in one zone.
+func utc(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+//stringList keeps the text[] columns of postgres as JSON arrays
+type stringList []string
+
+func (l stringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]string(l))
+	return string(data), err
+}
+
+//scanList scans a JSON array into *dst
+type scanList struct {
+	dst *[]string
+}
+
+func (l scanList) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	case nil:
+		*l.dst = nil
+		return nil
+	default:
+		return errors.Errorf("can't scan %T into a list", src)
+	}
+
+	list := []string{}
+	err := json.Unmarshal(data, &list)
+	if err != nil {
+		return errors.Wrap(err, "can't scan list")
+	}
+	*l.dst = list
+	return nil
+}
+
+type sqlScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+type sqlMultiScanner interface {
+	Scan(dest ...interface{}) error
+	Next() bool
+}
@@ -0,0 +1,59 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"finPrj/internal/storagetest"
+
+	"go.uber.org/zap"
+)
+
+//newStorages opens a new database file for every test
+func newStorages(t *testing.T) storagetest.Storages {
+	cfg := Config{
+		Path:         filepath.Join(t.TempDir(), "test.db"),
+		BusyTimeout:  5 * time.Second,
+		QueryTimeout: 5 * time.Second,
+	}
+	db, err := New(zap.NewNop(), cfg)
+	if err != nil {
+		t.Fatalf("can't open database: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	err = db.Migrate()
+	if err != nil {
+		t.Fatalf("can't migrate database: %s", err)
+	}
+
+	us, err := NewUserStorage(db)
+	if err != nil {
+		t.Fatalf("can't create users storage: %s", err)
+	}
+	is, err := NewIdentityStorage(db)
+	if err != nil {
+		t.Fatalf("can't create identities storage: %s", err)
+	}
+	ss, err := NewSessionStorage(db)
+	if err != nil {
+		t.Fatalf("can't create sessions storage: %s", err)
+	}
+	rs, err := NewRobotStorage(db, storagetest.RobotUpdates(t))
+	if err != nil {
+		t.Fatalf("can't create robots storage: %s", err)
+	}
+
+	return storagetest.Storages{
+		Users:      us,
+		Identities: is,
+		Sessions:   ss,
+		Robots:     rs,
+		Transactor: NewTransactor(db, us, is, ss, rs),
+	}
+}
+
+func TestStorages(t *testing.T) {
+	storagetest.Run(t, newStorages)
+}
@@ -0,0 +1,65 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"finPrj/internal/tokens"
+
+	"github.com/pkg/errors"
+)
+
+var _ tokens.UsedStorage = &UsedTokenStorage{}
+
+type UsedTokenStorage struct {
+	statementStorage
+
+	UseStmt           *sql.Stmt
+	DeleteExpiredStmt *sql.Stmt
+}
+
+func NewUsedTokenStorage(db *DB) (*UsedTokenStorage, error) {
+	ts := &UsedTokenStorage{statementStorage: newStatementsStorage(db)}
+
+	stmts := []stmt{
+		{Query: useTokenQuery, Dst: &ts.UseStmt},
+		{Query: deleteExpiredTokensQuery, Dst: &ts.DeleteExpiredStmt},
+	}
+
+	if err := ts.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements in used tokens")
+	}
+
+	return ts, nil
+}
+
+const useTokenQuery = `INSERT INTO used_tokens (token_id, expires_at) VALUES (?1, ?2) 
+ON CONFLICT (token_id) DO NOTHING`
+
+const deleteExpiredTokensQuery = `DELETE FROM used_tokens WHERE expires_at < ?1`
+
+//Use relies on the primary key of token_id, of two concurrent
+//uses only one inserts the row.
+func (ts *UsedTokenStorage) Use(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error) {
+	ctx, cancel := ts.withTimeout(ctx)
+	defer cancel()
+
+	//tokens are used rarely, so the table is pruned on the way
+	_, err := ts.DeleteExpiredStmt.ExecContext(ctx, time.Now().UTC())
+	if err != nil {
+		return false, errors.Wrapf(err, "can't delete expired tokens")
+	}
+
+	res, err := ts.UseStmt.ExecContext(ctx, tokenID, expiresAt.UTC())
+	if err != nil {
+		return false, errors.Wrapf(err, "can't use token")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(err, "can't use token")
+	}
+
+	return n == 1, nil
+}
@@ -0,0 +1,161 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"time"
+
+	robots "finPrj/internal/robots"
+	sessions "finPrj/internal/sessions"
+	"finPrj/internal/storage"
+	users "finPrj/internal/users"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+const maxTxAttempts = 5
+
+//Tx is one unit of work, storages take part in it with WithTx.
+type Tx struct {
+	ctx         context.Context
+	tx          *sql.Tx
+	afterCommit []func()
+}
+
+//bind moves the statements to the transaction, they are closed with it
+func (tx *Tx) bind(statements []stmt) {
+	for i := range statements {
+		*statements[i].Dst = tx.tx.StmtContext(tx.ctx, *statements[i].Dst)
+	}
+}
+
+//AfterCommit runs fn once the transaction is committed,
+//nothing runs for attempts that are rolled back.
+func (tx *Tx) AfterCommit(fn func()) {
+	tx.afterCommit = append(tx.afterCommit, fn)
+}
+
+//isRetryable tells if the database stayed locked by another
+//writer for longer than the busy timeout.
+func isRetryable(err error) bool {
+	sqliteErr, ok := errors.Cause(err).(sqlite3.Error)
+	return ok && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
+
+//InTx runs fn in a transaction and commits it if fn returns nil.
+//sqlite runs one writer at a time, so transactions are serializable;
+//ones that waited too long for the lock are run again, so fn must do
+//nothing but database work through tx.
+func (db *DB) InTx(ctx context.Context, fn func(tx *Tx) error) error {
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err = db.runTx(ctx, fn)
+		if !isRetryable(err) {
+			return err
+		}
+
+		db.Logger.Sugar().Debugf("InTx:: attempt %d found the database locked: %s", attempt, err)
+		select {
+		case <-time.After(time.Duration(attempt*10+rand.Intn(10)) * time.Millisecond):
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "transaction abandoned")
+		}
+	}
+
+	return errors.Wrapf(err, "transaction failed %d times", maxTxAttempts)
+}
+
+func (db *DB) runTx(ctx context.Context, fn func(tx *Tx) error) error {
+	sqlTx, err := db.Base.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "can't begin transaction")
+	}
+
+	tx := &Tx{ctx: ctx, tx: sqlTx}
+	committed := false
+	defer func() {
+		if !committed {
+			sqlTx.Rollback()
+		}
+	}()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	err = sqlTx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "can't commit transaction")
+	}
+	committed = true
+
+	for _, fn := range tx.afterCommit {
+		fn()
+	}
+
+	return nil
+}
+
+var _ storage.Transactor = &Transactor{}
+
+//Transactor runs units of work of the users, identities, sessions and robots
+//storages in serializable transactions, see DB.InTx.
+type Transactor struct {
+	db *DB
+	us *UserStorage
+	is *IdentityStorage
+	ss *SessionStorage
+	rs *RobotStorage
+}
+
+func NewTransactor(db *DB, us *UserStorage, is *IdentityStorage, ss *SessionStorage, rs *RobotStorage) *Transactor {
+	return &Transactor{db: db, us: us, is: is, ss: ss, rs: rs}
+}
+
+func (t *Transactor) InTx(ctx context.Context, fn func(tx storage.Tx) error) error {
+	return t.db.InTx(ctx, func(tx *Tx) error {
+		return fn(&txStorages{t: t, tx: tx})
+	})
+}
+
+//txStorages binds a storage to the transaction on its first use,
+//binding prepares all of its statements on the connection.
+type txStorages struct {
+	t  *Transactor
+	tx *Tx
+	us *UserStorage
+	is *IdentityStorage
+	ss *SessionStorage
+	rs *RobotStorage
+}
+
+func (s *txStorages) Users() users.Storage {
+	if s.us == nil {
+		s.us = s.t.us.WithTx(s.tx)
+	}
+	return s.us
+}
+
+func (s *txStorages) Identities() users.IdentityStorage {
+	if s.is == nil {
+		s.is = s.t.is.WithTx(s.tx)
+	}
+	return s.is
+}
+
+func (s *txStorages) Sessions() sessions.Storage {
+	if s.ss == nil {
+		s.ss = s.t.ss.WithTx(s.tx)
+	}
+	return s.ss
+}
+
+func (s *txStorages) Robots() robots.Storage {
+	if s.rs == nil {
+		s.rs = s.t.rs.WithTx(s.tx)
+	}
+	return s.rs
+}
@@ -0,0 +1,230 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	users "finPrj/internal/users"
+
+	"github.com/pkg/errors"
+)
+
+var _ users.Storage = &UserStorage{}
+
+type UserStorage struct {
+	statementStorage
+
+	CreateStmt     *sql.Stmt
+	GetByIDStmt    *sql.Stmt
+	GetByEmailStmt *sql.Stmt
+	UpdateUserStmt *sql.Stmt
+	GetAllStmt     *sql.Stmt
+
+	DeleteRecoveryCodesStmt *sql.Stmt
+	CreateRecoveryCodeStmt  *sql.Stmt
+	UseRecoveryCodeStmt     *sql.Stmt
+}
+
+func NewUserStorage(db *DB) (*UserStorage, error) {
+	us := &UserStorage{statementStorage: newStatementsStorage(db)}
+
+	if err := us.initStatements(us.stmts()); err != nil {
+		return nil, errors.Wrap(err, "can't init statements in users")
+	}
+
+	return us, nil
+}
+
+func (us *UserStorage) stmts() []stmt {
+	return []stmt{
+		{Query: createUserQuery, Dst: &us.CreateStmt},
+		{Query: getUserByIDQuery, Dst: &us.GetByIDStmt},
+		{Query: getUserByEmailQuery, Dst: &us.GetByEmailStmt},
+		{Query: updateUserQuery, Dst: &us.UpdateUserStmt},
+		{Query: getAllUsersQuery, Dst: &us.GetAllStmt},
+		{Query: deleteRecoveryCodesQuery, Dst: &us.DeleteRecoveryCodesStmt},
+		{Query: createRecoveryCodeQuery, Dst: &us.CreateRecoveryCodeStmt},
+		{Query: useRecoveryCodeQuery, Dst: &us.UseRecoveryCodeStmt},
+	}
+}
+
+//WithTx returns a copy of the storage working in tx
+func (us *UserStorage) WithTx(tx *Tx) *UserStorage {
+	txus := *us
+	txus.withTx(tx, txus.stmts())
+	return &txus
+}
+
+func scanUser(scanner sqlScanner, user *users.User) error {
+	err := scanner.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Birthday, &user.Email,
+		&user.Password, &user.Role, &user.CreatedAt, &user.UpdatedAt,
+		&user.TOTPSecret, &user.TOTPEnabledAt, &user.TOTPCounter, &user.EmailVerifiedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+const createUserQuery = `INSERT INTO users (first_name, last_name, birthday, 
+email, password, role, created_at, updated_at, totp_secret, totp_enabled_at, totp_counter, email_verified_at) 
+VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12) RETURNING id`
+
+//Create sets the id the database assigned to the user
+func (us *UserStorage) Create(ctx context.Context, user *users.User) error {
+	ctx, cancel := us.withTimeout(ctx)
+	defer cancel()
+
+	err := us.CreateStmt.QueryRowContext(ctx, user.FirstName, user.LastName, utc(user.Birthday), user.Email,
+		user.Password, user.Role, user.CreatedAt.UTC(), user.UpdatedAt.UTC(),
+		user.TOTPSecret, utc(user.TOTPEnabledAt), user.TOTPCounter, utc(user.EmailVerifiedAt)).Scan(&user.ID)
+	if isUniqueViolation(err) {
+		return users.ErrEmailTaken
+	}
+	if err != nil {
+		return errors.Wrapf(err, "can't create user with bday")
+	}
+
+	return nil
+}
+
+const getUserByIDQuery = `SELECT id, first_name, last_name, birthday, email, password, role, created_at, updated_at, 
+totp_secret, totp_enabled_at, totp_counter, email_verified_at 
+FROM users 
+WHERE id = ?1`
+
+func (us *UserStorage) GetByID(ctx context.Context, id int64) (*users.User, error) {
+	ctx, cancel := us.withTimeout(ctx)
+	defer cancel()
+
+	row := us.GetByIDStmt.QueryRowContext(ctx, id)
+	user := users.User{}
+	err := scanUser(row, &user)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "can't get user by id")
+	}
+
+	return &user, nil
+}
+
+const getUserByEmailQuery = `SELECT id, first_name, last_name, birthday, email, password, role, created_at, updated_at, 
+totp_secret, totp_enabled_at, totp_counter, email_verified_at 
+FROM users 
+WHERE email = ?1`
+
+func (us *UserStorage) GetByEmail(ctx context.Context, email string) (*users.User, error) {
+	ctx, cancel := us.withTimeout(ctx)
+	defer cancel()
+
+	row := us.GetByEmailStmt.QueryRowContext(ctx, email)
+	user := users.User{}
+	err := scanUser(row, &user)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "can't get user by email")
+	}
+
+	return &user, nil
+}
+
+const getAllUsersQuery = `SELECT id, first_name, last_name, birthday, email, password, role, created_at, updated_at, 
+totp_secret, totp_enabled_at, totp_counter, email_verified_at 
+FROM users 
+ORDER BY id`
+
+func (us *UserStorage) GetAll(ctx context.Context) ([]users.User, error) {
+	ctx, cancel := us.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := us.GetAllStmt.QueryContext(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't get all users")
+	}
+	defer rows.Close()
+
+	user := users.User{}
+	usersList := make([]users.User, 0)
+	for rows.Next() {
+		err := scanUser(rows, &user)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't scan user")
+		}
+
+		usersList = append(usersList, user)
+	}
+
+	return usersList, errors.Wrap(rows.Err(), "can't get all users")
+}
+
+const updateUserQuery = `UPDATE users SET first_name = ?1, last_name = ?2, birthday = ?3, email = ?4, 
+password = ?5, role = ?6, updated_at = ?7, totp_secret = ?8, totp_enabled_at = ?9, 
+totp_counter = ?10, email_verified_at = ?11 WHERE id = ?12`
+
+func (us *UserStorage) UpdateUser(ctx context.Context, user *users.User) error {
+	ctx, cancel := us.withTimeout(ctx)
+	defer cancel()
+
+	_, err := us.UpdateUserStmt.ExecContext(ctx, user.FirstName, user.LastName, utc(user.Birthday),
+		user.Email, user.Password, user.Role, time.Now().UTC(),
+		user.TOTPSecret, utc(user.TOTPEnabledAt), user.TOTPCounter, utc(user.EmailVerifiedAt), user.ID)
+	if isUniqueViolation(err) {
+		return users.ErrEmailTaken
+	}
+	if err != nil {
+		return errors.Wrapf(err, "can't update user")
+	}
+
+	return nil
+}
+
+const deleteRecoveryCodesQuery = `DELETE FROM recovery_codes WHERE user_id = ?1`
+
+const createRecoveryCodeQuery = `INSERT INTO recovery_codes (user_id, code_hash) VALUES (?1, ?2)`
+
+//ReplaceRecoveryCodes drops all codes of the user, used or not,
+//and stores the new ones. Empty hashes just drop the codes.
+func (us *UserStorage) ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes []string) error {
+	ctx, cancel := us.withTimeout(ctx)
+	defer cancel()
+
+	_, err := us.DeleteRecoveryCodesStmt.ExecContext(ctx, userID)
+	if err != nil {
+		return errors.Wrapf(err, "can't delete recovery codes")
+	}
+
+	for _, hash := range hashes {
+		_, err = us.CreateRecoveryCodeStmt.ExecContext(ctx, userID, hash)
+		if err != nil {
+			return errors.Wrapf(err, "can't create recovery code")
+		}
+	}
+
+	return nil
+}
+
+const useRecoveryCodeQuery = `UPDATE recovery_codes SET used_at = ?1 
+WHERE user_id = ?2 AND code_hash = ?3 AND used_at IS NULL`
+
+//UseRecoveryCode returns false if there is no such unused code.
+func (us *UserStorage) UseRecoveryCode(ctx context.Context, userID int64, hash string) (bool, error) {
+	ctx, cancel := us.withTimeout(ctx)
+	defer cancel()
+
+	res, err := us.UseRecoveryCodeStmt.ExecContext(ctx, time.Now().UTC(), userID, hash)
+	if err != nil {
+		return false, errors.Wrapf(err, "can't use recovery code")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(err, "can't use recovery code")
+	}
+
+	return n == 1, nil
+}
@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"context"
+	robots "finPrj/internal/robots"
+	sessions "finPrj/internal/sessions"
+	users "finPrj/internal/users"
+)
+
+//Tx hands out the storages of one unit of work, everything done
+//through them is committed or rolled back together.
+type Tx interface {
+	Users() users.Storage
+	Identities() users.IdentityStorage
+	Sessions() sessions.Storage
+	Robots() robots.Storage
+}
+
+//Transactor runs changes that span several calls or storages.
+//fn may run more than once, so it must do nothing but storage
+//work through tx and must not keep state between runs.
+type Transactor interface {
+	InTx(ctx context.Context, fn func(tx Tx) error) error
+}
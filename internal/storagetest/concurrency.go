@@ -0,0 +1,202 @@
+package storagetest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	robots "finPrj/internal/robots"
+	sessions "finPrj/internal/sessions"
+	users "finPrj/internal/users"
+
+	"github.com/pkg/errors"
+)
+
+//workers is how many goroutines race in each concurrency test
+const workers = 8
+
+//RunConcurrency checks what the storages promise to concurrent callers:
+//ids are never given twice and one-time things are used once.
+func RunConcurrency(t *testing.T, newStorages Factory) {
+	t.Run("CreateUsers", func(t *testing.T) { testConcurrentUsers(t, newStorages(t)) })
+	t.Run("SameEmail", func(t *testing.T) { testConcurrentEmail(t, newStorages(t)) })
+	t.Run("RecoveryCode", func(t *testing.T) { testConcurrentRecoveryCode(t, newStorages(t)) })
+	t.Run("RefreshToken", func(t *testing.T) { testConcurrentRefreshToken(t, newStorages(t)) })
+	t.Run("CreateRobots", func(t *testing.T) { testConcurrentRobots(t, newStorages(t)) })
+}
+
+//race runs fn in workers goroutines at once and returns their errors
+func race(fn func(i int) error) []error {
+	errs := make([]error, workers)
+	start := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			errs[i] = fn(i)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	return errs
+}
+
+func testConcurrentUsers(t *testing.T, st Storages) {
+	ctx := newContext(t)
+
+	created := make([]*users.User, workers)
+	errs := race(func(i int) error {
+		created[i] = newUser(fmt.Sprintf("user%d@example.com", i))
+		return st.Users.Create(ctx, created[i])
+	})
+
+	ids := map[int64]bool{}
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("can't create user %d: %s", i, err)
+		}
+		if ids[created[i].ID] {
+			t.Errorf("id %d was given twice", created[i].ID)
+		}
+		ids[created[i].ID] = true
+	}
+
+	all, err := st.Users.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("can't get all users: %s", err)
+	}
+	if len(all) != workers {
+		t.Errorf("got %d users, want %d", len(all), workers)
+	}
+}
+
+func testConcurrentEmail(t *testing.T, st Storages) {
+	ctx := newContext(t)
+
+	errs := race(func(i int) error {
+		return st.Users.Create(ctx, newUser("ann@example.com"))
+	})
+
+	createdCount := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			createdCount++
+		case errors.Cause(err) != users.ErrEmailTaken:
+			t.Errorf("Create with a taken email returned %v, want ErrEmailTaken", err)
+		}
+	}
+	if createdCount != 1 {
+		t.Errorf("%d users were created with one email, want 1", createdCount)
+	}
+}
+
+func testConcurrentRecoveryCode(t *testing.T, st Storages) {
+	ctx := newContext(t)
+	user := createUser(ctx, t, st.Users, "ann@example.com")
+	err := st.Users.ReplaceRecoveryCodes(ctx, user.ID, []string{"code"})
+	if err != nil {
+		t.Fatalf("can't replace recovery codes: %s", err)
+	}
+
+	used := make([]bool, workers)
+	errs := race(func(i int) error {
+		var err error
+		used[i], err = st.Users.UseRecoveryCode(ctx, user.ID, "code")
+		return err
+	})
+
+	checkUsedOnce(t, "recovery code", used, errs)
+}
+
+func testConcurrentRefreshToken(t *testing.T, st Storages) {
+	ctx := newContext(t)
+	user := createUser(ctx, t, st.Users, "ann@example.com")
+	sess := createSession(ctx, t, st.Sessions, user.ID, "s1", now())
+	rt := &sessions.RefreshToken{
+		TokenHash: "refresh",
+		SessionID: sess.SessionID,
+		UserID:    user.ID,
+		CreatedAt: now(),
+		ExpiresAt: now().Add(time.Hour),
+	}
+	err := st.Sessions.CreateRefreshToken(ctx, rt)
+	if err != nil {
+		t.Fatalf("can't create refresh token: %s", err)
+	}
+
+	used := make([]bool, workers)
+	errs := race(func(i int) error {
+		var err error
+		used[i], err = st.Sessions.UseRefreshToken(ctx, rt.TokenHash, now())
+		return err
+	})
+
+	checkUsedOnce(t, "refresh token", used, errs)
+}
+
+//checkUsedOnce checks that exactly one of the racing uses succeeded
+func checkUsedOnce(t *testing.T, what string, used []bool, errs []error) {
+	t.Helper()
+
+	usedCount := 0
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("can't use %s: %s", what, err)
+		}
+		if used[i] {
+			usedCount++
+		}
+	}
+	if usedCount != 1 {
+		t.Errorf("%s was used %d times, want once", what, usedCount)
+	}
+}
+
+func testConcurrentRobots(t *testing.T, st Storages) {
+	ctx := newContext(t)
+	user := createUser(ctx, t, st.Users, "ann@example.com")
+
+	created := make([]*robots.Robot, workers)
+	errs := race(func(i int) error {
+		created[i] = newRobot(user.ID, "AAPL")
+		return st.Robots.Create(ctx, created[i])
+	})
+
+	want := make([]int64, 0, workers)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("can't create robot %d: %s", i, err)
+		}
+		want = append(want, created[i].RobotID)
+	}
+
+	//activating and deactivating different robots doesn't conflict
+	errs = race(func(i int) error {
+		if i%2 == 0 {
+			return st.Robots.ActivateRobot(ctx, created[i])
+		}
+		return st.Robots.DeactivateRobot(ctx, created[i])
+	})
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("can't change robot %d: %s", created[i].RobotID, err)
+		}
+	}
+
+	list, err := st.Robots.GetByOwnerID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("can't get robots by owner: %s", err)
+	}
+	checkIDSet(t, "GetByOwnerID", list, want...)
+	for i := range list {
+		robo := &list[i]
+		if robo.IsActive != (robo.ActivatedAt != nil) {
+			t.Errorf("robot %d is_active %v, activated_at %v", robo.RobotID, robo.IsActive, robo.ActivatedAt)
+		}
+	}
+}
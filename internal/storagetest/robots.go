@@ -0,0 +1,563 @@
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	robots "finPrj/internal/robots"
+)
+
+//RunRobots checks robots.Storage
+func RunRobots(t *testing.T, newStorages Factory) {
+	t.Run("CreateAndGet", func(t *testing.T) { testCreateRobot(t, newStorages(t)) })
+	t.Run("NotFound", func(t *testing.T) { testRobotNotFound(t, newStorages(t)) })
+	t.Run("Update", func(t *testing.T) { testUpdateRobot(t, newStorages(t)) })
+	t.Run("SoftDelete", func(t *testing.T) { testSoftDelete(t, newStorages(t)) })
+	t.Run("Activation", func(t *testing.T) { testActivation(t, newStorages(t)) })
+	t.Run("TickerAndOwner", func(t *testing.T) { testTickerAndOwner(t, newStorages(t)) })
+	t.Run("ListPages", func(t *testing.T) { testListPages(t, newStorages(t)) })
+	t.Run("RobotsToRun", func(t *testing.T) { testRobotsToRun(t, newStorages(t)) })
+}
+
+func newRobot(ownerID int64, ticker string) *robots.Robot {
+	return &robots.Robot{
+		OwnerUserID: ownerID,
+		Ticker:      ticker,
+		BuyPrice:    10,
+		SellPrice:   12.5,
+		PlanYield:   3,
+		CreatedAt:   timePtr(now()),
+		Tags:        []string{"tech"},
+	}
+}
+
+//createRobot stores robo and fails the test if it can't
+func createRobot(ctx context.Context, t *testing.T, rs robots.Storage, robo *robots.Robot) *robots.Robot {
+	t.Helper()
+
+	err := rs.Create(ctx, robo)
+	if err != nil {
+		t.Fatalf("can't create robot %s: %s", robo.Ticker, err)
+	}
+	if robo.RobotID == 0 {
+		t.Fatalf("robot %s has no id after Create", robo.Ticker)
+	}
+
+	return robo
+}
+
+func sameTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func checkRobot(t *testing.T, got, want *robots.Robot) {
+	t.Helper()
+
+	if got == nil {
+		t.Fatalf("robot %d not found", want.RobotID)
+	}
+	if got.RobotID != want.RobotID || got.OwnerUserID != want.OwnerUserID || got.ParentRobotID != want.ParentRobotID ||
+		got.IsFavourite != want.IsFavourite || got.IsActive != want.IsActive || got.Ticker != want.Ticker ||
+		got.BuyPrice != want.BuyPrice || got.SellPrice != want.SellPrice || got.PlanYield != want.PlanYield ||
+		got.FactYield != want.FactYield || got.DealsCount != want.DealsCount || !sameTags(got.Tags, want.Tags) {
+		t.Errorf("got robot %+v, want %+v", got, want)
+	}
+
+	times := []struct {
+		name      string
+		got, want *time.Time
+	}{
+		{"plan_start", got.PlanStart, want.PlanStart},
+		{"plan_end", got.PlanEnd, want.PlanEnd},
+		{"deleted_at", got.DeletedAt, want.DeletedAt},
+		{"activated_at", got.ActivatedAt, want.ActivatedAt},
+		{"deactivated_at", got.DeactivatedAt, want.DeactivatedAt},
+		{"created_at", got.CreatedAt, want.CreatedAt},
+	}
+	for _, tm := range times {
+		if !sameTimePtr(tm.got, tm.want) {
+			t.Errorf("robot %d: got %s %v, want %v", want.RobotID, tm.name, tm.got, tm.want)
+		}
+	}
+}
+
+//robotIDs are the ids of list in its order
+func robotIDs(list []robots.Robot) []int64 {
+	ids := make([]int64, 0, len(list))
+	for _, robo := range list {
+		ids = append(ids, robo.RobotID)
+	}
+	return ids
+}
+
+//checkIDs compares ids of the robots returned by what with want, in order
+func checkIDs(t *testing.T, what string, list []robots.Robot, want ...int64) {
+	t.Helper()
+
+	got := robotIDs(list)
+	compareIDs(t, what, got, want)
+}
+
+//checkIDSet is checkIDs for methods that return robots in no order
+func checkIDSet(t *testing.T, what string, list []robots.Robot, want ...int64) {
+	t.Helper()
+
+	got := robotIDs(list)
+	sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+	sorted := append([]int64{}, want...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	compareIDs(t, what, got, sorted)
+}
+
+func compareIDs(t *testing.T, what string, got, want []int64) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Errorf("%s returned robots %v, want %v", what, got, want)
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("%s returned robots %v, want %v", what, got, want)
+			return
+		}
+	}
+}
+
+func testCreateRobot(t *testing.T, st Storages) {
+	ctx := newContext(t)
+	user := createUser(ctx, t, st.Users, "ann@example.com")
+
+	planned := newRobot(user.ID, "AAPL")
+	planned.PlanStart = timePtr(now().Add(-time.Hour))
+	planned.PlanEnd = timePtr(now().Add(time.Hour))
+	planned.Tags = []string{"tech", "usa"}
+	createRobot(ctx, t, st.Robots, planned)
+
+	child := newRobot(user.ID, "MSFT")
+	child.ParentRobotID = planned.RobotID
+	child.IsFavourite = true
+	child.Tags = nil
+	createRobot(ctx, t, st.Robots, child)
+	if child.RobotID == planned.RobotID {
+		t.Fatalf("two robots got id %d", child.RobotID)
+	}
+
+	got, err := st.Robots.GetByRobotID(ctx, planned.RobotID)
+	if err != nil {
+		t.Fatalf("can't get robot: %s", err)
+	}
+	checkRobot(t, got, planned)
+
+	got, err = st.Robots.GetByRobotID(ctx, child.RobotID)
+	if err != nil {
+		t.Fatalf("can't get robot: %s", err)
+	}
+	checkRobot(t, got, child)
+
+	all, err := st.Robots.GetAllRobots(ctx)
+	if err != nil {
+		t.Fatalf("can't get all robots: %s", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("got %d robots, want 2", len(all))
+	}
+}
+
+func testRobotNotFound(t *testing.T, st Storages) {
+	ctx := newContext(t)
+
+	robo, err := st.Robots.GetByRobotID(ctx, 1000)
+	if robo != nil || err != nil {
+		t.Errorf("GetByRobotID of a missing robot returned %v, %v, want nil, nil", robo, err)
+	}
+
+	list, err := st.Robots.GetByOwnerID(ctx, 1000)
+	if err != nil || len(list) != 0 {
+		t.Errorf("GetByOwnerID of a user without robots returned %v, %v, want nothing", list, err)
+	}
+
+	list, err = st.Robots.GetAllRobots(ctx)
+	if err != nil || len(list) != 0 {
+		t.Errorf("GetAllRobots of no robots returned %v, %v, want nothing", list, err)
+	}
+}
+
+func testUpdateRobot(t *testing.T, st Storages) {
+	ctx := newContext(t)
+	user := createUser(ctx, t, st.Users, "ann@example.com")
+	robo := createRobot(ctx, t, st.Robots, newRobot(user.ID, "AAPL"))
+
+	robo.Ticker = "GOOG"
+	robo.BuyPrice = 7
+	robo.SellPrice = 9
+	robo.FactYield = 1.5
+	robo.DealsCount = 4
+	robo.IsFavourite = true
+	robo.PlanStart = timePtr(now())
+	robo.PlanEnd = timePtr(now().Add(24 * time.Hour))
+	robo.Tags = []string{"search"}
+	err := st.Robots.UpdateRobot(ctx, robo)
+	if err != nil {
+		t.Fatalf("can't update robot: %s", err)
+	}
+
+	got, err := st.Robots.GetByRobotID(ctx, robo.RobotID)
+	if err != nil {
+		t.Fatalf("can't get robot: %s", err)
+	}
+	checkRobot(t, got, robo)
+
+	//activation has its own methods, UpdateRobot leaves it alone
+	robo.IsActive = true
+	robo.ActivatedAt = timePtr(now())
+	robo.DeactivatedAt = timePtr(now())
+	err = st.Robots.UpdateRobot(ctx, robo)
+	if err != nil {
+		t.Fatalf("can't update robot: %s", err)
+	}
+	got, err = st.Robots.GetByRobotID(ctx, robo.RobotID)
+	if err != nil {
+		t.Fatalf("can't get robot: %s", err)
+	}
+	if got.IsActive || got.ActivatedAt != nil || got.DeactivatedAt != nil {
+		t.Errorf("UpdateRobot set is_active %v, activated_at %v, deactivated_at %v",
+			got.IsActive, got.ActivatedAt, got.DeactivatedAt)
+	}
+}
+
+func testSoftDelete(t *testing.T, st Storages) {
+	ctx := newContext(t)
+	user := createUser(ctx, t, st.Users, "ann@example.com")
+	kept := createRobot(ctx, t, st.Robots, newRobot(user.ID, "AAPL"))
+	deleted := createRobot(ctx, t, st.Robots, newRobot(user.ID, "MSFT"))
+
+	before := now()
+	err := st.Robots.DeleteRobot(ctx, deleted)
+	if err != nil {
+		t.Fatalf("can't delete robot: %s", err)
+	}
+	if deleted.DeletedAt == nil || deleted.DeletedAt.Before(before) {
+		t.Fatalf("DeleteRobot set deleted_at to %v, want the current time", deleted.DeletedAt)
+	}
+
+	//deleted robots stay, only marked
+	got, err := st.Robots.GetByRobotID(ctx, deleted.RobotID)
+	if err != nil {
+		t.Fatalf("can't get deleted robot: %s", err)
+	}
+	checkRobot(t, got, deleted)
+
+	isDeleted, notDeleted := true, false
+	list, _, err := st.Robots.List(ctx, &robots.Filter{Deleted: &isDeleted})
+	if err != nil {
+		t.Fatalf("can't list deleted robots: %s", err)
+	}
+	checkIDs(t, "List of deleted", list, deleted.RobotID)
+
+	list, _, err = st.Robots.List(ctx, &robots.Filter{Deleted: &notDeleted})
+	if err != nil {
+		t.Fatalf("can't list robots: %s", err)
+	}
+	checkIDs(t, "List of not deleted", list, kept.RobotID)
+
+	//UpdateRobot leaves deleted_at alone
+	deletedAt := deleted.DeletedAt
+	deleted.DeletedAt = nil
+	err = st.Robots.UpdateRobot(ctx, deleted)
+	if err != nil {
+		t.Fatalf("can't update deleted robot: %s", err)
+	}
+	got, err = st.Robots.GetByRobotID(ctx, deleted.RobotID)
+	if err != nil {
+		t.Fatalf("can't get deleted robot: %s", err)
+	}
+	if !sameTimePtr(got.DeletedAt, deletedAt) {
+		t.Errorf("UpdateRobot changed deleted_at from %v to %v", deletedAt, got.DeletedAt)
+	}
+}
+
+func testActivation(t *testing.T, st Storages) {
+	ctx := newContext(t)
+	user := createUser(ctx, t, st.Users, "ann@example.com")
+	robo := createRobot(ctx, t, st.Robots, newRobot(user.ID, "AAPL"))
+
+	before := now()
+	err := st.Robots.ActivateRobot(ctx, robo)
+	if err != nil {
+		t.Fatalf("can't activate robot: %s", err)
+	}
+	if !robo.IsActive || robo.ActivatedAt == nil || robo.ActivatedAt.Before(before) {
+		t.Fatalf("ActivateRobot left is_active %v, activated_at %v", robo.IsActive, robo.ActivatedAt)
+	}
+
+	got, err := st.Robots.GetByRobotID(ctx, robo.RobotID)
+	if err != nil {
+		t.Fatalf("can't get robot: %s", err)
+	}
+	checkRobot(t, got, robo)
+
+	before = now()
+	err = st.Robots.DeactivateRobot(ctx, robo)
+	if err != nil {
+		t.Fatalf("can't deactivate robot: %s", err)
+	}
+	if robo.IsActive || robo.DeactivatedAt == nil || robo.DeactivatedAt.Before(before) {
+		t.Fatalf("DeactivateRobot left is_active %v, deactivated_at %v", robo.IsActive, robo.DeactivatedAt)
+	}
+
+	//activated_at stays, the robot was active between the two
+	got, err = st.Robots.GetByRobotID(ctx, robo.RobotID)
+	if err != nil {
+		t.Fatalf("can't get robot: %s", err)
+	}
+	checkRobot(t, got, robo)
+	if got.ActivatedAt == nil || got.ActivatedAt.After(*got.DeactivatedAt) {
+		t.Errorf("robot activated at %v after it was deactivated at %v", got.ActivatedAt, got.DeactivatedAt)
+	}
+}
+
+func testTickerAndOwner(t *testing.T, st Storages) {
+	ctx := newContext(t)
+	ann := createUser(ctx, t, st.Users, "ann@example.com")
+	bob := createUser(ctx, t, st.Users, "bob@example.com")
+	annAAPL := createRobot(ctx, t, st.Robots, newRobot(ann.ID, "AAPL"))
+	annMSFT := createRobot(ctx, t, st.Robots, newRobot(ann.ID, "MSFT"))
+	bobAAPL := createRobot(ctx, t, st.Robots, newRobot(bob.ID, "AAPL"))
+	annDeleted := createRobot(ctx, t, st.Robots, newRobot(ann.ID, "AAPL"))
+	err := st.Robots.DeleteRobot(ctx, annDeleted)
+	if err != nil {
+		t.Fatalf("can't delete robot: %s", err)
+	}
+
+	//deleted robots are found too, callers filter them
+	lookups := []struct {
+		ticker  string
+		ownerID int64
+		want    []int64
+	}{
+		{"AAPL", ann.ID, []int64{annAAPL.RobotID, annDeleted.RobotID}},
+		{"AAPL", 0, []int64{annAAPL.RobotID, bobAAPL.RobotID, annDeleted.RobotID}},
+		{"", ann.ID, []int64{annAAPL.RobotID, annMSFT.RobotID, annDeleted.RobotID}},
+		{"MSFT", bob.ID, nil},
+		{"GOOG", 0, nil},
+	}
+	for _, lookup := range lookups {
+		what := fmt.Sprintf("GetByTickerAndOwnerID(%q, %d)", lookup.ticker, lookup.ownerID)
+		list, err := st.Robots.GetByTickerAndOwnerID(ctx, lookup.ticker, lookup.ownerID)
+		if err != nil {
+			t.Fatalf("%s failed: %s", what, err)
+		}
+		checkIDSet(t, what, list, lookup.want...)
+
+		streamed := make([]robots.Robot, 0)
+		err = st.Robots.StreamByTickerAndOwnerID(ctx, lookup.ticker, lookup.ownerID, func(robo *robots.Robot) error {
+			streamed = append(streamed, *robo)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Stream%s failed: %s", what, err)
+		}
+		checkIDSet(t, "Stream"+what, streamed, lookup.want...)
+	}
+
+	list, err := st.Robots.GetByOwnerID(ctx, bob.ID)
+	if err != nil {
+		t.Fatalf("can't get robots by owner: %s", err)
+	}
+	checkIDSet(t, "GetByOwnerID", list, bobAAPL.RobotID)
+
+	err = st.Robots.ActivateRobot(ctx, annMSFT)
+	if err != nil {
+		t.Fatalf("can't activate robot: %s", err)
+	}
+
+	isActive, notDeleted := true, false
+	filters := []struct {
+		name   string
+		filter robots.Filter
+		want   []int64
+	}{
+		{"owner", robots.Filter{OwnerID: ann.ID, Deleted: &notDeleted}, []int64{annAAPL.RobotID, annMSFT.RobotID}},
+		{"ticker", robots.Filter{Ticker: "AAPL"}, []int64{annAAPL.RobotID, bobAAPL.RobotID, annDeleted.RobotID}},
+		{"owner and ticker", robots.Filter{OwnerID: bob.ID, Ticker: "AAPL"}, []int64{bobAAPL.RobotID}},
+		{"active", robots.Filter{IsActive: &isActive}, []int64{annMSFT.RobotID}},
+		{"nothing", robots.Filter{OwnerID: bob.ID, Ticker: "MSFT"}, nil},
+	}
+	for _, f := range filters {
+		list, next, err := st.Robots.List(ctx, &f.filter)
+		if err != nil {
+			t.Fatalf("List by %s failed: %s", f.name, err)
+		}
+		checkIDs(t, "List by "+f.name, list, f.want...)
+		if next != "" {
+			t.Errorf("List by %s without a limit returned cursor %q", f.name, next)
+		}
+	}
+}
+
+//compareBy compares robots by the sort key and then by id, unset
+//created_at sorts as the zero unix time
+func compareBy(sortKey string, a, b *robots.Robot) int {
+	var c int
+	switch sortKey {
+	case robots.SortCreatedAt:
+		ta, tb := time.Unix(0, 0), time.Unix(0, 0)
+		if a.CreatedAt != nil {
+			ta = *a.CreatedAt
+		}
+		if b.CreatedAt != nil {
+			tb = *b.CreatedAt
+		}
+		c = compareInts(ta.UnixNano(), tb.UnixNano())
+	case robots.SortTicker:
+		c = strings.Compare(a.Ticker, b.Ticker)
+	case robots.SortBuyPrice:
+		c = compareFloats(a.BuyPrice, b.BuyPrice)
+	case robots.SortDealsCounts:
+		c = compareInts(a.DealsCount, b.DealsCount)
+	}
+	if c != 0 {
+		return c
+	}
+	return compareInts(a.RobotID, b.RobotID)
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+//testListPages walks every sort order page by page, the pages
+//must add up to the whole list in the same order
+func testListPages(t *testing.T, st Storages) {
+	ctx := newContext(t)
+	user := createUser(ctx, t, st.Users, "ann@example.com")
+
+	tickers := []string{"MSFT", "AAPL", "GOOG", "AAPL", "TSLA"}
+	for i, ticker := range tickers {
+		robo := newRobot(user.ID, ticker)
+		robo.BuyPrice = float64(i % 3)
+		robo.DealsCount = int64(len(tickers) - i)
+		robo.CreatedAt = timePtr(now().Add(time.Duration(i%2) * time.Minute))
+		if i == 0 {
+			robo.CreatedAt = nil
+		}
+		createRobot(ctx, t, st.Robots, robo)
+	}
+
+	sorts := []string{robots.SortRobotID, robots.SortCreatedAt, robots.SortTicker,
+		robots.SortBuyPrice, robots.SortDealsCounts}
+	for _, sortKey := range sorts {
+		for _, desc := range []bool{false, true} {
+			what := fmt.Sprintf("List sorted by %s, desc %v", sortKey, desc)
+			all, _, err := st.Robots.List(ctx, &robots.Filter{Sort: sortKey, Desc: desc})
+			if err != nil {
+				t.Fatalf("%s failed: %s", what, err)
+			}
+			if len(all) != len(tickers) {
+				t.Fatalf("%s returned %d robots, want %d", what, len(all), len(tickers))
+			}
+			for i := 1; i < len(all); i++ {
+				c := compareBy(sortKey, &all[i-1], &all[i])
+				if desc && c < 0 || !desc && c > 0 {
+					t.Errorf("%s returned robots %v out of order", what, robotIDs(all))
+					break
+				}
+			}
+
+			paged := make([]robots.Robot, 0)
+			filter := &robots.Filter{Sort: sortKey, Desc: desc, Limit: 2}
+			for page := 0; page <= len(tickers); page++ {
+				list, next, err := st.Robots.List(ctx, filter)
+				if err != nil {
+					t.Fatalf("%s, page %d failed: %s", what, page, err)
+				}
+				paged = append(paged, list...)
+				if next == "" {
+					break
+				}
+
+				filter = &robots.Filter{Sort: sortKey, Desc: desc, Limit: 2}
+				err = filter.ParseCursor(next)
+				if err != nil {
+					t.Fatalf("%s, page %d returned a bad cursor: %s", what, page, err)
+				}
+			}
+			checkIDs(t, what+" by pages", paged, robotIDs(all)...)
+		}
+	}
+}
+
+func testRobotsToRun(t *testing.T, st Storages) {
+	ctx := newContext(t)
+	user := createUser(ctx, t, st.Users, "ann@example.com")
+
+	planned := newRobot(user.ID, "AAPL")
+	planned.PlanStart = timePtr(now().Add(-time.Hour))
+	planned.PlanEnd = timePtr(now().Add(time.Hour))
+	createRobot(ctx, t, st.Robots, planned)
+
+	finished := newRobot(user.ID, "MSFT")
+	finished.PlanStart = timePtr(now().Add(-2 * time.Hour))
+	finished.PlanEnd = timePtr(now().Add(-time.Hour))
+	createRobot(ctx, t, st.Robots, finished)
+
+	active := createRobot(ctx, t, st.Robots, newRobot(user.ID, "GOOG"))
+	err := st.Robots.ActivateRobot(ctx, active)
+	if err != nil {
+		t.Fatalf("can't activate robot: %s", err)
+	}
+
+	idle := createRobot(ctx, t, st.Robots, newRobot(user.ID, "TSLA"))
+
+	deleted := newRobot(user.ID, "AMZN")
+	deleted.PlanStart = planned.PlanStart
+	deleted.PlanEnd = planned.PlanEnd
+	createRobot(ctx, t, st.Robots, deleted)
+	err = st.Robots.DeleteRobot(ctx, deleted)
+	if err != nil {
+		t.Fatalf("can't delete robot: %s", err)
+	}
+
+	list, err := st.Robots.RobotsToRun(ctx)
+	if err != nil {
+		t.Fatalf("can't get robots to run: %s", err)
+	}
+
+	run := map[int64]bool{}
+	for _, robo := range list {
+		run[robo.RobotID] = true
+	}
+	if len(list) != 2 || !run[planned.RobotID] || !run[active.RobotID] {
+		t.Errorf("RobotsToRun returned %v, want the planned %d and the active %d, not %d, %d or %d",
+			robotIDs(list), planned.RobotID, active.RobotID, finished.RobotID, idle.RobotID, deleted.RobotID)
+	}
+}
@@ -0,0 +1,346 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sessions "finPrj/internal/sessions"
+)
+
+//RunSessions checks sessions.Storage
+func RunSessions(t *testing.T, newStorages Factory) {
+	t.Run("CreateAndGet", func(t *testing.T) { testCreateSession(t, newStorages(t)) })
+	t.Run("NotFound", func(t *testing.T) { testSessionNotFound(t, newStorages(t)) })
+	t.Run("TouchAndRotate", func(t *testing.T) { testTouchAndRotate(t, newStorages(t)) })
+	t.Run("Delete", func(t *testing.T) { testDeleteSessions(t, newStorages(t)) })
+	t.Run("RefreshTokens", func(t *testing.T) { testRefreshTokens(t, newStorages(t)) })
+	t.Run("Revocations", func(t *testing.T) { testRevocations(t, newStorages(t)) })
+	t.Run("UserRevocations", func(t *testing.T) { testUserRevocations(t, newStorages(t)) })
+}
+
+//createSession stores a session of the user with the id and the
+//token hash "hash-" + id
+func createSession(ctx context.Context, t *testing.T, ss sessions.Storage, userID int64,
+	id string, lastSeenAt time.Time) *sessions.Session {
+	t.Helper()
+
+	sess := &sessions.Session{
+		SessionID:  id,
+		TokenHash:  "hash-" + id,
+		UserID:     userID,
+		UserAgent:  "curl",
+		IP:         "127.0.0.1",
+		CreatedAt:  lastSeenAt,
+		LastSeenAt: lastSeenAt,
+		ValidUntil: lastSeenAt.Add(time.Hour),
+		ExpiresAt:  lastSeenAt.Add(24 * time.Hour),
+	}
+	err := ss.Create(ctx, sess)
+	if err != nil {
+		t.Fatalf("can't create session %s: %s", id, err)
+	}
+
+	return sess
+}
+
+func checkSession(t *testing.T, got, want *sessions.Session) {
+	t.Helper()
+
+	if got == nil {
+		t.Fatalf("session %s not found", want.SessionID)
+	}
+	if got.SessionID != want.SessionID || got.TokenHash != want.TokenHash || got.UserID != want.UserID ||
+		got.UserAgent != want.UserAgent || got.IP != want.IP {
+		t.Errorf("got session %+v, want %+v", got, want)
+	}
+	if !sameTime(got.CreatedAt, want.CreatedAt) || !sameTime(got.LastSeenAt, want.LastSeenAt) ||
+		!sameTime(got.ValidUntil, want.ValidUntil) || !sameTime(got.ExpiresAt, want.ExpiresAt) {
+		t.Errorf("got session times %+v, want %+v", got, want)
+	}
+}
+
+func testCreateSession(t *testing.T, st Storages) {
+	ctx := newContext(t)
+	user := createUser(ctx, t, st.Users, "ann@example.com")
+	timeNow := now()
+	older := createSession(ctx, t, st.Sessions, user.ID, "s1", timeNow.Add(-time.Minute))
+	newer := createSession(ctx, t, st.Sessions, user.ID, "s2", timeNow)
+
+	got, err := st.Sessions.GetBySessionID(ctx, older.SessionID)
+	if err != nil {
+		t.Fatalf("can't get session by id: %s", err)
+	}
+	checkSession(t, got, older)
+
+	got, err = st.Sessions.GetByTokenHash(ctx, newer.TokenHash)
+	if err != nil {
+		t.Fatalf("can't get session by token hash: %s", err)
+	}
+	checkSession(t, got, newer)
+
+	list, err := st.Sessions.ListByUserID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("can't list sessions: %s", err)
+	}
+	if len(list) != 2 || list[0].SessionID != newer.SessionID || list[1].SessionID != older.SessionID {
+		t.Errorf("got sessions %+v, want the most recently seen first", list)
+	}
+}
+
+func testSessionNotFound(t *testing.T, st Storages) {
+	ctx := newContext(t)
+
+	sess, err := st.Sessions.GetBySessionID(ctx, "missing")
+	if sess != nil || err != nil {
+		t.Errorf("GetBySessionID of a missing session returned %v, %v, want nil, nil", sess, err)
+	}
+
+	sess, err = st.Sessions.GetByTokenHash(ctx, "missing")
+	if sess != nil || err != nil {
+		t.Errorf("GetByTokenHash of a missing session returned %v, %v, want nil, nil", sess, err)
+	}
+
+	rt, err := st.Sessions.GetRefreshToken(ctx, "missing")
+	if rt != nil || err != nil {
+		t.Errorf("GetRefreshToken of a missing token returned %v, %v, want nil, nil", rt, err)
+	}
+
+	list, err := st.Sessions.ListByUserID(ctx, 1000)
+	if err != nil || len(list) != 0 {
+		t.Errorf("ListByUserID of a user without sessions returned %v, %v, want nothing", list, err)
+	}
+}
+
+func testTouchAndRotate(t *testing.T, st Storages) {
+	ctx := newContext(t)
+	user := createUser(ctx, t, st.Users, "ann@example.com")
+	sess := createSession(ctx, t, st.Sessions, user.ID, "s1", now().Add(-time.Minute))
+
+	timeNow := now()
+	sess.LastSeenAt = timeNow
+	sess.ValidUntil = timeNow.Add(time.Hour)
+	sess.IP = "10.0.0.1"
+	sess.UserAgent = "firefox"
+	err := st.Sessions.Touch(ctx, sess)
+	if err != nil {
+		t.Fatalf("can't touch session: %s", err)
+	}
+
+	got, err := st.Sessions.GetBySessionID(ctx, sess.SessionID)
+	if err != nil {
+		t.Fatalf("can't get session: %s", err)
+	}
+	checkSession(t, got, sess)
+
+	oldHash := sess.TokenHash
+	sess.TokenHash = "rotated"
+	err = st.Sessions.Rotate(ctx, sess)
+	if err != nil {
+		t.Fatalf("can't rotate session: %s", err)
+	}
+
+	got, err = st.Sessions.GetByTokenHash(ctx, oldHash)
+	if got != nil || err != nil {
+		t.Errorf("old bearer still finds %v, %v", got, err)
+	}
+	got, err = st.Sessions.GetByTokenHash(ctx, "rotated")
+	if err != nil {
+		t.Fatalf("can't get rotated session: %s", err)
+	}
+	checkSession(t, got, sess)
+}
+
+func testDeleteSessions(t *testing.T, st Storages) {
+	ctx := newContext(t)
+	ann := createUser(ctx, t, st.Users, "ann@example.com")
+	bob := createUser(ctx, t, st.Users, "bob@example.com")
+	timeNow := now()
+	for _, id := range []string{"a1", "a2", "a3"} {
+		createSession(ctx, t, st.Sessions, ann.ID, id, timeNow)
+	}
+	createSession(ctx, t, st.Sessions, bob.ID, "b1", timeNow)
+
+	err := st.Sessions.DeleteBySessionID(ctx, "a1")
+	if err != nil {
+		t.Fatalf("can't delete session by id: %s", err)
+	}
+	err = st.Sessions.DeleteByTokenHash(ctx, "hash-a2")
+	if err != nil {
+		t.Fatalf("can't delete session by token hash: %s", err)
+	}
+	for _, id := range []string{"a1", "a2"} {
+		sess, err := st.Sessions.GetBySessionID(ctx, id)
+		if sess != nil || err != nil {
+			t.Errorf("deleted session %s returned %v, %v", id, sess, err)
+		}
+	}
+
+	err = st.Sessions.DeleteByUserID(ctx, ann.ID)
+	if err != nil {
+		t.Fatalf("can't delete sessions of user: %s", err)
+	}
+	list, err := st.Sessions.ListByUserID(ctx, ann.ID)
+	if err != nil || len(list) != 0 {
+		t.Errorf("sessions of user left after DeleteByUserID: %v, %v", list, err)
+	}
+
+	list, err = st.Sessions.ListByUserID(ctx, bob.ID)
+	if err != nil || len(list) != 1 {
+		t.Errorf("sessions of another user were deleted: %v, %v", list, err)
+	}
+
+	//deleting what isn't there is not an error
+	err = st.Sessions.DeleteBySessionID(ctx, "a1")
+	if err != nil {
+		t.Errorf("deleting a missing session returned %s", err)
+	}
+}
+
+func testRefreshTokens(t *testing.T, st Storages) {
+	ctx := newContext(t)
+	user := createUser(ctx, t, st.Users, "ann@example.com")
+	sess := createSession(ctx, t, st.Sessions, user.ID, "s1", now())
+
+	rt := &sessions.RefreshToken{
+		TokenHash: "refresh",
+		SessionID: sess.SessionID,
+		UserID:    user.ID,
+		CreatedAt: now(),
+		ExpiresAt: now().Add(time.Hour),
+	}
+	err := st.Sessions.CreateRefreshToken(ctx, rt)
+	if err != nil {
+		t.Fatalf("can't create refresh token: %s", err)
+	}
+
+	got, err := st.Sessions.GetRefreshToken(ctx, rt.TokenHash)
+	if err != nil || got == nil {
+		t.Fatalf("can't get refresh token: %v, %s", got, err)
+	}
+	if got.SessionID != rt.SessionID || got.UserID != rt.UserID || got.UsedAt != nil ||
+		!sameTime(got.CreatedAt, rt.CreatedAt) || !sameTime(got.ExpiresAt, rt.ExpiresAt) {
+		t.Errorf("got refresh token %+v, want %+v", got, rt)
+	}
+
+	usedAt := now()
+	ok, err := st.Sessions.UseRefreshToken(ctx, rt.TokenHash, usedAt)
+	if err != nil || !ok {
+		t.Fatalf("can't use refresh token: %v, %v", ok, err)
+	}
+	ok, err = st.Sessions.UseRefreshToken(ctx, rt.TokenHash, now())
+	if err != nil || ok {
+		t.Errorf("refresh token was used twice: %v, %v", ok, err)
+	}
+
+	got, err = st.Sessions.GetRefreshToken(ctx, rt.TokenHash)
+	if err != nil || got == nil {
+		t.Fatalf("can't get used refresh token: %v, %s", got, err)
+	}
+	if !sameTimePtr(got.UsedAt, &usedAt) {
+		t.Errorf("got used_at %v, want %v", got.UsedAt, usedAt)
+	}
+
+	//tokens go away with their session
+	err = st.Sessions.DeleteBySessionID(ctx, sess.SessionID)
+	if err != nil {
+		t.Fatalf("can't delete session: %s", err)
+	}
+	got, err = st.Sessions.GetRefreshToken(ctx, rt.TokenHash)
+	if got != nil || err != nil {
+		t.Errorf("refresh token of a deleted session returned %v, %v", got, err)
+	}
+}
+
+func testRevocations(t *testing.T, st Storages) {
+	ctx := newContext(t)
+	timeNow := now()
+
+	revs := []sessions.Revocation{
+		{SessionID: "old", UserID: 1, RevokedAt: timeNow.Add(-time.Hour), ExpiresAt: timeNow.Add(time.Hour)},
+		{SessionID: "new", UserID: 1, RevokedAt: timeNow, ExpiresAt: timeNow.Add(time.Hour)},
+		{SessionID: "expired", UserID: 1, RevokedAt: timeNow, ExpiresAt: timeNow.Add(-time.Second)},
+	}
+	for i := range revs {
+		err := st.Sessions.Revoke(ctx, &revs[i])
+		if err != nil {
+			t.Fatalf("can't revoke session %s: %s", revs[i].SessionID, err)
+		}
+	}
+
+	//signing out twice, or a refresh racing a sign out, revokes a session again
+	again := sessions.Revocation{SessionID: "new", UserID: 1, RevokedAt: timeNow.Add(time.Second),
+		ExpiresAt: timeNow.Add(2 * time.Hour)}
+	err := st.Sessions.Revoke(ctx, &again)
+	if err != nil {
+		t.Fatalf("can't revoke session again: %s", err)
+	}
+
+	got, err := st.Sessions.RevocationsSince(ctx, timeNow.Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("can't get revocations: %s", err)
+	}
+	if len(got) != 1 || got[0].SessionID != "new" || got[0].UserID != 1 ||
+		!sameTime(got[0].RevokedAt, revs[1].RevokedAt) || !sameTime(got[0].ExpiresAt, revs[1].ExpiresAt) {
+		t.Errorf("got revocations %+v, want only the new unexpired one", got)
+	}
+}
+
+//testUserRevocations records revocations without a session, the kind
+//signing out everywhere writes. Any number of them fit in a storage.
+func testUserRevocations(t *testing.T, st Storages) {
+	ctx := newContext(t)
+	timeNow := now()
+	shortLived := timeNow.Add(300 * time.Millisecond)
+
+	revs := []sessions.Revocation{
+		{UserID: 1, RevokedAt: timeNow, ExpiresAt: timeNow.Add(time.Hour)},
+		{UserID: 2, RevokedAt: timeNow, ExpiresAt: timeNow.Add(time.Hour)},
+		{UserID: 1, RevokedAt: timeNow.Add(time.Millisecond), ExpiresAt: timeNow.Add(time.Hour)},
+		{UserID: 1, RevokedAt: timeNow.Add(2 * time.Millisecond), ExpiresAt: shortLived},
+	}
+	for i := range revs {
+		err := st.Sessions.Revoke(ctx, &revs[i])
+		if err != nil {
+			t.Fatalf("can't record revocation %d of user %d: %s", i, revs[i].UserID, err)
+		}
+	}
+
+	got, err := st.Sessions.RevocationsSince(ctx, timeNow.Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("can't get revocations: %s", err)
+	}
+	checkRevocations(t, got, revs)
+
+	time.Sleep(time.Until(shortLived) + 100*time.Millisecond)
+	got, err = st.Sessions.RevocationsSince(ctx, timeNow.Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("can't get revocations: %s", err)
+	}
+	checkRevocations(t, got, revs[:3])
+}
+
+//checkRevocations compares revocations in any order
+func checkRevocations(t *testing.T, got, want []sessions.Revocation) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d revocations %+v, want %d", len(got), got, len(want))
+	}
+
+	found := make([]bool, len(want))
+	for _, rev := range got {
+		for i := range want {
+			if !found[i] && rev.SessionID == want[i].SessionID && rev.UserID == want[i].UserID &&
+				sameTime(rev.RevokedAt, want[i].RevokedAt) && sameTime(rev.ExpiresAt, want[i].ExpiresAt) {
+				found[i] = true
+				break
+			}
+		}
+	}
+	for i := range want {
+		if !found[i] {
+			t.Errorf("revocation %+v is missing from %+v", want[i], got)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+//Package storagetest checks that a storage backend behaves as the
+//handlers expect, whatever keeps the data. Every backend runs the
+//same suite from its own _test.go with a Factory of empty storages.
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	robots "finPrj/internal/robots"
+	sessions "finPrj/internal/sessions"
+	"finPrj/internal/storage"
+	users "finPrj/internal/users"
+)
+
+//Storages share one database, the others refer to users
+type Storages struct {
+	Users      users.Storage
+	Identities users.IdentityStorage
+	Sessions   sessions.Storage
+	Robots     robots.Storage
+	Transactor storage.Transactor
+}
+
+//Factory returns storages of a new empty database, it is called once
+//per test. Robot changes must be consumed, the suite never reads them.
+type Factory func(t *testing.T) Storages
+
+//Run runs the whole suite
+func Run(t *testing.T, newStorages Factory) {
+	t.Run("Users", func(t *testing.T) { RunUsers(t, newStorages) })
+	t.Run("Sessions", func(t *testing.T) { RunSessions(t, newStorages) })
+	t.Run("Robots", func(t *testing.T) { RunRobots(t, newStorages) })
+	t.Run("Tx", func(t *testing.T) { RunTx(t, newStorages) })
+	t.Run("Concurrency", func(t *testing.T) { RunConcurrency(t, newStorages) })
+}
+
+//RobotUpdates is a channel for robot storages that drops what
+//they publish until the test ends
+func RobotUpdates(t *testing.T) chan<- *robots.Robot {
+	roboUpd := make(chan *robots.Robot)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-roboUpd:
+			case <-done:
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() { close(done) })
+
+	return roboUpd
+}
+
+//timePrecision is how much a time may change on its way through
+//a storage, postgres keeps microseconds
+const timePrecision = time.Microsecond
+
+func sameTime(a, b time.Time) bool {
+	d := a.Sub(b)
+	return -timePrecision <= d && d <= timePrecision
+}
+
+func sameTimePtr(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return sameTime(*a, *b)
+}
+
+//now is the current time as every backend can keep it
+func now() time.Time {
+	return time.Now().UTC().Truncate(timePrecision)
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func newContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
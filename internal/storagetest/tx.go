@@ -0,0 +1,115 @@
+package storagetest
+
+import (
+	"testing"
+
+	"finPrj/internal/storage"
+
+	"github.com/pkg/errors"
+)
+
+//RunTx checks storage.Transactor: changes of a unit of work are kept
+//together or not at all
+func RunTx(t *testing.T, newStorages Factory) {
+	t.Run("Commit", func(t *testing.T) { testTxCommit(t, newStorages(t)) })
+	t.Run("Rollback", func(t *testing.T) { testTxRollback(t, newStorages(t)) })
+}
+
+func testTxCommit(t *testing.T, st Storages) {
+	ctx := newContext(t)
+	user := createUser(ctx, t, st.Users, "ann@example.com")
+
+	var robotID int64
+	err := st.Transactor.InTx(ctx, func(tx storage.Tx) error {
+		stored, err := tx.Users().GetByID(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		stored.FirstName = "Anna"
+		err = tx.Users().UpdateUser(ctx, stored)
+		if err != nil {
+			return err
+		}
+
+		robo := newRobot(user.ID, "AAPL")
+		err = tx.Robots().Create(ctx, robo)
+		robotID = robo.RobotID
+		return err
+	})
+	if err != nil {
+		t.Fatalf("can't run transaction: %s", err)
+	}
+
+	got, err := st.Users.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("can't get user: %s", err)
+	}
+	if got.FirstName != "Anna" {
+		t.Errorf("user has first name %q after commit, want %q", got.FirstName, "Anna")
+	}
+	robo, err := st.Robots.GetByRobotID(ctx, robotID)
+	if err != nil {
+		t.Fatalf("can't get robot: %s", err)
+	}
+	if robo == nil {
+		t.Errorf("robot %d not found after commit", robotID)
+	}
+}
+
+func testTxRollback(t *testing.T, st Storages) {
+	ctx := newContext(t)
+	user := createUser(ctx, t, st.Users, "ann@example.com")
+	createSession(ctx, t, st.Sessions, user.ID, "kept", now())
+
+	errFailed := errors.New("failed")
+	var robotID int64
+	err := st.Transactor.InTx(ctx, func(tx storage.Tx) error {
+		stored, err := tx.Users().GetByID(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		stored.FirstName = "Anna"
+		err = tx.Users().UpdateUser(ctx, stored)
+		if err != nil {
+			return err
+		}
+
+		robo := newRobot(user.ID, "AAPL")
+		err = tx.Robots().Create(ctx, robo)
+		if err != nil {
+			return err
+		}
+		robotID = robo.RobotID
+
+		err = tx.Sessions().DeleteByUserID(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		return errFailed
+	})
+	if err != errFailed {
+		t.Fatalf("InTx returned %v, want the error of fn", err)
+	}
+
+	got, err := st.Users.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("can't get user: %s", err)
+	}
+	if got.FirstName != user.FirstName {
+		t.Errorf("user has first name %q after rollback, want %q", got.FirstName, user.FirstName)
+	}
+	robo, err := st.Robots.GetByRobotID(ctx, robotID)
+	if err != nil {
+		t.Fatalf("can't get robot: %s", err)
+	}
+	if robo != nil {
+		t.Errorf("robot %d created in a rolled back transaction", robotID)
+	}
+	sess, err := st.Sessions.GetBySessionID(ctx, "kept")
+	if err != nil {
+		t.Fatalf("can't get session: %s", err)
+	}
+	if sess == nil {
+		t.Errorf("session deleted in a rolled back transaction")
+	}
+}
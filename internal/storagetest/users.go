@@ -0,0 +1,253 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	users "finPrj/internal/users"
+
+	"github.com/pkg/errors"
+)
+
+//RunUsers checks users.Storage
+func RunUsers(t *testing.T, newStorages Factory) {
+	t.Run("CreateAndGet", func(t *testing.T) { testCreateUser(t, newStorages(t).Users) })
+	t.Run("NotFound", func(t *testing.T) { testUserNotFound(t, newStorages(t).Users) })
+	t.Run("EmailTaken", func(t *testing.T) { testEmailTaken(t, newStorages(t).Users) })
+	t.Run("Update", func(t *testing.T) { testUpdateUser(t, newStorages(t).Users) })
+	t.Run("RecoveryCodes", func(t *testing.T) { testRecoveryCodes(t, newStorages(t).Users) })
+	t.Run("Identities", func(t *testing.T) { testIdentities(t, newStorages(t)) })
+}
+
+func newUser(email string) *users.User {
+	timeNow := now()
+	return &users.User{
+		FirstName: "Ann",
+		LastName:  "Lee",
+		Birthday:  timePtr(time.Date(1990, 1, 2, 0, 0, 0, 0, time.UTC)),
+		Email:     email,
+		Password:  "hash",
+		Role:      users.RoleUser,
+		CreatedAt: timeNow,
+		UpdatedAt: timeNow,
+	}
+}
+
+//createUser stores a user with the email and fails the test if it can't
+func createUser(ctx context.Context, t *testing.T, us users.Storage, email string) *users.User {
+	t.Helper()
+
+	user := newUser(email)
+	err := us.Create(ctx, user)
+	if err != nil {
+		t.Fatalf("can't create user %s: %s", email, err)
+	}
+	if user.ID == 0 {
+		t.Fatalf("user %s has no id after Create", email)
+	}
+
+	return user
+}
+
+func checkUser(t *testing.T, got, want *users.User) {
+	t.Helper()
+
+	if got == nil {
+		t.Fatalf("user %d not found", want.ID)
+	}
+	if got.ID != want.ID || got.FirstName != want.FirstName || got.LastName != want.LastName ||
+		got.Email != want.Email || got.Password != want.Password || got.Role != want.Role ||
+		got.TOTPSecret != want.TOTPSecret || got.TOTPCounter != want.TOTPCounter {
+		t.Errorf("got user %+v, want %+v", got, want)
+	}
+	if !sameTimePtr(got.Birthday, want.Birthday) {
+		t.Errorf("got birthday %v, want %v", got.Birthday, want.Birthday)
+	}
+	if !sameTime(got.CreatedAt, want.CreatedAt) {
+		t.Errorf("got created_at %v, want %v", got.CreatedAt, want.CreatedAt)
+	}
+	if !sameTimePtr(got.TOTPEnabledAt, want.TOTPEnabledAt) {
+		t.Errorf("got totp_enabled_at %v, want %v", got.TOTPEnabledAt, want.TOTPEnabledAt)
+	}
+	if !sameTimePtr(got.EmailVerifiedAt, want.EmailVerifiedAt) {
+		t.Errorf("got email_verified_at %v, want %v", got.EmailVerifiedAt, want.EmailVerifiedAt)
+	}
+}
+
+func testCreateUser(t *testing.T, us users.Storage) {
+	ctx := newContext(t)
+	ann := createUser(ctx, t, us, "ann@example.com")
+	bob := createUser(ctx, t, us, "bob@example.com")
+	if ann.ID == bob.ID {
+		t.Fatalf("two users got id %d", ann.ID)
+	}
+
+	got, err := us.GetByID(ctx, ann.ID)
+	if err != nil {
+		t.Fatalf("can't get user by id: %s", err)
+	}
+	checkUser(t, got, ann)
+
+	got, err = us.GetByEmail(ctx, bob.Email)
+	if err != nil {
+		t.Fatalf("can't get user by email: %s", err)
+	}
+	checkUser(t, got, bob)
+
+	all, err := us.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("can't get all users: %s", err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("got %d users, want 2", len(all))
+	}
+}
+
+func testUserNotFound(t *testing.T, us users.Storage) {
+	ctx := newContext(t)
+
+	user, err := us.GetByID(ctx, 1000)
+	if user != nil || err != nil {
+		t.Errorf("GetByID of a missing user returned %v, %v, want nil, nil", user, err)
+	}
+
+	user, err = us.GetByEmail(ctx, "nobody@example.com")
+	if user != nil || err != nil {
+		t.Errorf("GetByEmail of a missing user returned %v, %v, want nil, nil", user, err)
+	}
+
+	all, err := us.GetAll(ctx)
+	if err != nil || len(all) != 0 {
+		t.Errorf("GetAll of no users returned %v, %v, want nothing", all, err)
+	}
+}
+
+func testEmailTaken(t *testing.T, us users.Storage) {
+	ctx := newContext(t)
+	createUser(ctx, t, us, "ann@example.com")
+	bob := createUser(ctx, t, us, "bob@example.com")
+
+	err := us.Create(ctx, newUser("ann@example.com"))
+	if errors.Cause(err) != users.ErrEmailTaken {
+		t.Errorf("Create with a taken email returned %v, want ErrEmailTaken", err)
+	}
+
+	bob.Email = "ann@example.com"
+	err = us.UpdateUser(ctx, bob)
+	if errors.Cause(err) != users.ErrEmailTaken {
+		t.Errorf("UpdateUser with a taken email returned %v, want ErrEmailTaken", err)
+	}
+}
+
+func testUpdateUser(t *testing.T, us users.Storage) {
+	ctx := newContext(t)
+	user := createUser(ctx, t, us, "ann@example.com")
+
+	timeNow := now()
+	user.FirstName = "Anna"
+	user.Email = "anna@example.com"
+	user.Birthday = nil
+	user.TOTPSecret = "secret"
+	user.TOTPEnabledAt = &timeNow
+	user.TOTPCounter = 3
+	user.EmailVerifiedAt = &timeNow
+	err := us.UpdateUser(ctx, user)
+	if err != nil {
+		t.Fatalf("can't update user: %s", err)
+	}
+
+	got, err := us.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("can't get user: %s", err)
+	}
+	checkUser(t, got, user)
+
+	old, err := us.GetByEmail(ctx, "ann@example.com")
+	if old != nil || err != nil {
+		t.Errorf("old email still finds %v, %v", old, err)
+	}
+}
+
+func testRecoveryCodes(t *testing.T, us users.Storage) {
+	ctx := newContext(t)
+	user := createUser(ctx, t, us, "ann@example.com")
+
+	err := us.ReplaceRecoveryCodes(ctx, user.ID, []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("can't replace recovery codes: %s", err)
+	}
+
+	uses := []struct {
+		hash string
+		want bool
+	}{
+		{"a", true},
+		{"a", false}, //codes work once
+		{"c", false},
+	}
+	for _, use := range uses {
+		ok, err := us.UseRecoveryCode(ctx, user.ID, use.hash)
+		if err != nil || ok != use.want {
+			t.Errorf("UseRecoveryCode(%q) returned %v, %v, want %v", use.hash, ok, err, use.want)
+		}
+	}
+
+	ok, err := us.UseRecoveryCode(ctx, user.ID+1, "b")
+	if err != nil || ok {
+		t.Errorf("code of another user was used: %v, %v", ok, err)
+	}
+
+	//replacing drops the unused codes too
+	err = us.ReplaceRecoveryCodes(ctx, user.ID, []string{"c"})
+	if err != nil {
+		t.Fatalf("can't replace recovery codes: %s", err)
+	}
+	ok, err = us.UseRecoveryCode(ctx, user.ID, "b")
+	if err != nil || ok {
+		t.Errorf("replaced code was used: %v, %v", ok, err)
+	}
+	ok, err = us.UseRecoveryCode(ctx, user.ID, "c")
+	if err != nil || !ok {
+		t.Errorf("new code wasn't used: %v, %v", ok, err)
+	}
+}
+
+func testIdentities(t *testing.T, st Storages) {
+	ctx := newContext(t)
+	ann := createUser(ctx, t, st.Users, "ann@example.com")
+	bob := createUser(ctx, t, st.Users, "bob@example.com")
+
+	identity := &users.Identity{Provider: "google", Subject: "1", UserID: ann.ID,
+		Email: ann.Email, CreatedAt: now()}
+	err := st.Identities.Create(ctx, identity)
+	if err != nil {
+		t.Fatalf("can't create identity: %s", err)
+	}
+
+	got, err := st.Identities.Get(ctx, "google", "1")
+	if err != nil || got == nil || got.UserID != ann.ID || !sameTime(got.CreatedAt, identity.CreatedAt) {
+		t.Fatalf("Get returned %+v, %v, want %+v", got, err, identity)
+	}
+
+	got, err = st.Identities.Get(ctx, "github", "1")
+	if got != nil || err != nil {
+		t.Errorf("Get of a missing identity returned %v, %v, want nil, nil", got, err)
+	}
+
+	//the subject is linked once whoever links it
+	err = st.Identities.Create(ctx, &users.Identity{Provider: "google", Subject: "1", UserID: bob.ID,
+		Email: bob.Email, CreatedAt: now()})
+	if errors.Cause(err) != users.ErrIdentityLinked {
+		t.Errorf("Create of a linked identity returned %v, want ErrIdentityLinked", err)
+	}
+
+	list, err := st.Identities.ListByUserID(ctx, bob.ID)
+	if err != nil || len(list) != 0 {
+		t.Errorf("bob has identities %v, %v, want none", list, err)
+	}
+	list, err = st.Identities.ListByUserID(ctx, ann.ID)
+	if err != nil || len(list) != 1 {
+		t.Errorf("ann has identities %v, %v, want one", list, err)
+	}
+}
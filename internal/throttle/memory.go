@@ -0,0 +1,88 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//MemoryStore keeps failures of one process only.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+type memoryEntry struct {
+	Entry
+	window time.Duration
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]*memoryEntry{}}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := e.Entry
+	return &copied, nil
+}
+
+func (s *MemoryStore) Fail(ctx context.Context, key string, now time.Time, window time.Duration) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	e, ok := s.entries[key]
+	if !ok || now.Sub(e.LastFailure) >= window {
+		e = &memoryEntry{Entry: Entry{Key: key}}
+		s.entries[key] = e
+	}
+	e.Failures++
+	e.LastFailure = now
+	e.window = window
+
+	copied := e.Entry
+	return &copied, nil
+}
+
+func (s *MemoryStore) Forgive(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok && e.Failures > 0 {
+		e.Failures--
+	}
+	return nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+//sweep drops forgotten entries once a minute,
+//so addresses seen once don't stay forever.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+
+	for key, e := range s.entries {
+		if now.Sub(e.LastFailure) >= e.window {
+			delete(s.entries, key)
+		}
+	}
+	s.lastSweep = now
+}
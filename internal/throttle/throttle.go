@@ -0,0 +1,199 @@
+package throttle
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+//Entry is the failure history of one key.
+type Entry struct {
+	Key         string
+	Failures    int
+	LastFailure time.Time
+}
+
+//Store keeps failures per key. Failures older than window
+//are forgotten: Fail starts counting from one again.
+//Fail must count atomically, concurrent attempts rely on it.
+type Store interface {
+	Get(ctx context.Context, key string) (*Entry, error)
+	Fail(ctx context.Context, key string, now time.Time, window time.Duration) (*Entry, error)
+	//Forgive takes one failure back
+	Forgive(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+}
+
+//Policy of one kind of key. The first FreeAttempts failures cost
+//nothing, then every next attempt has to wait BaseDelay doubled
+//per failure, up to MaxDelay. After LockoutAfter failures the key is
+//locked for LockoutFor, every failure after that locks it again.
+type Policy struct {
+	Window       time.Duration
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	LockoutAfter int
+	LockoutFor   time.Duration
+}
+
+//DefaultEmail is the policy for attempts on one account.
+var DefaultEmail = Policy{
+	Window:       time.Hour,
+	FreeAttempts: 3,
+	BaseDelay:    time.Second,
+	MaxDelay:     30 * time.Second,
+	LockoutAfter: 10,
+	LockoutFor:   15 * time.Minute,
+}
+
+//DefaultIP is the policy for attempts from one address. It is looser
+//than DefaultEmail, many users can share an address.
+var DefaultIP = Policy{
+	Window:       time.Hour,
+	FreeAttempts: 20,
+	BaseDelay:    time.Second,
+	MaxDelay:     30 * time.Second,
+	LockoutAfter: 100,
+	LockoutFor:   15 * time.Minute,
+}
+
+//wait returns how long after now the next attempt is allowed.
+func (p Policy) wait(e *Entry, now time.Time) time.Duration {
+	if e == nil || now.Sub(e.LastFailure) >= p.Window {
+		return 0
+	}
+
+	var next time.Time
+	switch {
+	case e.Failures >= p.LockoutAfter:
+		next = e.LastFailure.Add(p.LockoutFor)
+	case e.Failures >= p.FreeAttempts:
+		delay := p.BaseDelay << uint(e.Failures-p.FreeAttempts)
+		if delay > p.MaxDelay || delay <= 0 {
+			delay = p.MaxDelay
+		}
+		next = e.LastFailure.Add(delay)
+	default:
+		return 0
+	}
+
+	if next.After(now) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+//Limiter throttles sign in attempts by email and by client IP.
+type Limiter struct {
+	store Store
+	email Policy
+	ip    Policy
+	audit *zap.Logger
+}
+
+func New(logger *zap.Logger, store Store, email, ip Policy) *Limiter {
+	return &Limiter{
+		store: store,
+		email: email,
+		ip:    ip,
+		audit: logger.Named("audit"),
+	}
+}
+
+func emailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+//Allow returns how long the caller must wait before the attempt,
+//zero means the attempt can be made now. Allowed attempts are counted
+//as failed right away, so concurrent ones can't all slip through
+//before the first fails. Release or Success takes them back.
+func (l *Limiter) Allow(ctx context.Context, email, ip string, now time.Time) (time.Duration, error) {
+	byEmail, wait, err := l.reserve(ctx, emailKey(email), l.email, now)
+	if err != nil || wait > 0 {
+		return wait, errors.Wrap(err, "can't count attempt by email")
+	}
+
+	byIP, wait, err := l.reserve(ctx, ipKey(ip), l.ip, now)
+	if err != nil || wait > 0 {
+		return wait, errors.Wrap(err, "can't count attempt by ip")
+	}
+
+	if byEmail.Failures == l.email.LockoutAfter {
+		l.audit.Warn("signin locked", zap.String("email", email), zap.String("ip", ip),
+			zap.Int("failures", byEmail.Failures), zap.Time("until", now.Add(l.email.LockoutFor)))
+	}
+	if byIP.Failures == l.ip.LockoutAfter {
+		l.audit.Warn("signin locked", zap.String("ip", ip),
+			zap.Int("failures", byIP.Failures), zap.Time("until", now.Add(l.ip.LockoutFor)))
+	}
+
+	return 0, nil
+}
+
+//reserve counts an attempt on the key unless the key has to wait.
+//The wait is checked again against the count the store returns: attempts
+//counted since Get were made just now, the ones that lose keep counting.
+func (l *Limiter) reserve(ctx context.Context, key string, p Policy, now time.Time) (*Entry, time.Duration, error) {
+	prev, err := l.store.Get(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if wait := p.wait(prev, now); wait > 0 {
+		return nil, wait, nil
+	}
+
+	e, err := l.store.Fail(ctx, key, now, p.Window)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	before := Entry{Key: key, Failures: e.Failures - 1, LastFailure: now}
+	if prev != nil && prev.Failures == before.Failures {
+		before.LastFailure = prev.LastFailure
+	}
+
+	return e, p.wait(&before, now), nil
+}
+
+//Release takes back the attempt counted by Allow when it
+//didn't fail but wasn't the last step of the sign in either.
+func (l *Limiter) Release(ctx context.Context, email, ip string) error {
+	err := l.store.Forgive(ctx, emailKey(email))
+	if err != nil {
+		return errors.Wrap(err, "can't release attempt by email")
+	}
+
+	err = l.store.Forgive(ctx, ipKey(ip))
+	if err != nil {
+		return errors.Wrap(err, "can't release attempt by ip")
+	}
+
+	return nil
+}
+
+//Success forgets the failures of the email. Failures of the IP
+//are kept, otherwise signing in to an own account would reset them,
+//only the attempt counted by Allow is taken back.
+func (l *Limiter) Success(ctx context.Context, email, ip string) error {
+	err := l.store.Reset(ctx, emailKey(email))
+	if err != nil {
+		return errors.Wrap(err, "can't reset attempts")
+	}
+
+	err = l.store.Forgive(ctx, ipKey(ip))
+	if err != nil {
+		return errors.Wrap(err, "can't release attempt by ip")
+	}
+
+	return nil
+}
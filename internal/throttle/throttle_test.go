@@ -0,0 +1,140 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var testPolicy = Policy{
+	Window:       time.Hour,
+	FreeAttempts: 3,
+	BaseDelay:    time.Minute,
+	MaxDelay:     time.Hour,
+	LockoutAfter: 10,
+	LockoutFor:   time.Hour,
+}
+
+func newLimiter() (*Limiter, *MemoryStore) {
+	store := NewMemoryStore()
+	return New(zap.NewNop(), store, testPolicy, testPolicy), store
+}
+
+func failures(t *testing.T, store *MemoryStore, key string) int {
+	t.Helper()
+
+	e, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("can't get %s: %s", key, err)
+	}
+	if e == nil {
+		return 0
+	}
+	return e.Failures
+}
+
+func TestAllowConcurrent(t *testing.T) {
+	lim, _ := newLimiter()
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := lim.Allow(context.Background(), "ann@example.com", "10.0.0.1", now)
+			if err != nil {
+				t.Errorf("can't allow: %s", err)
+			}
+			if wait == 0 {
+				mutex.Lock()
+				allowed++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != testPolicy.FreeAttempts {
+		t.Errorf("%d concurrent attempts were allowed, want %d", allowed, testPolicy.FreeAttempts)
+	}
+}
+
+func TestAllowBackoff(t *testing.T) {
+	ctx := context.Background()
+	lim, _ := newLimiter()
+	now := time.Now()
+
+	for i := 0; i < testPolicy.FreeAttempts; i++ {
+		wait, err := lim.Allow(ctx, "ann@example.com", "10.0.0.1", now)
+		if err != nil || wait != 0 {
+			t.Fatalf("free attempt %d returned %v, %v", i, wait, err)
+		}
+	}
+
+	wait, err := lim.Allow(ctx, "ann@example.com", "10.0.0.2", now)
+	if err != nil || wait != testPolicy.BaseDelay {
+		t.Fatalf("attempt after the free ones returned %v, %v, want %v", wait, err, testPolicy.BaseDelay)
+	}
+
+	//attempts that have to wait aren't counted
+	now = now.Add(testPolicy.BaseDelay)
+	wait, err = lim.Allow(ctx, "ann@example.com", "10.0.0.2", now)
+	if err != nil || wait != 0 {
+		t.Fatalf("attempt after the delay returned %v, %v", wait, err)
+	}
+
+	wait, err = lim.Allow(ctx, "ann@example.com", "10.0.0.2", now)
+	if err != nil || wait != 2*testPolicy.BaseDelay {
+		t.Errorf("next attempt returned %v, %v, want %v", wait, err, 2*testPolicy.BaseDelay)
+	}
+}
+
+func TestSuccessAndRelease(t *testing.T) {
+	ctx := context.Background()
+	lim, store := newLimiter()
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		_, err := lim.Allow(ctx, "ann@example.com", "10.0.0.1", now)
+		if err != nil {
+			t.Fatalf("can't allow: %s", err)
+		}
+	}
+
+	//a right password with a second factor to come
+	_, err := lim.Allow(ctx, "ann@example.com", "10.0.0.1", now)
+	if err != nil {
+		t.Fatalf("can't allow: %s", err)
+	}
+	err = lim.Release(ctx, "ann@example.com", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("can't release: %s", err)
+	}
+	if got := failures(t, store, emailKey("ann@example.com")); got != 2 {
+		t.Errorf("email has %d failures after release, want 2", got)
+	}
+	if got := failures(t, store, ipKey("10.0.0.1")); got != 2 {
+		t.Errorf("ip has %d failures after release, want 2", got)
+	}
+
+	_, err = lim.Allow(ctx, "ann@example.com", "10.0.0.1", now)
+	if err != nil {
+		t.Fatalf("can't allow: %s", err)
+	}
+	err = lim.Success(ctx, "ann@example.com", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("can't succeed: %s", err)
+	}
+	if got := failures(t, store, emailKey("ann@example.com")); got != 0 {
+		t.Errorf("email has %d failures after success, want 0", got)
+	}
+	if got := failures(t, store, ipKey("10.0.0.1")); got != 2 {
+		t.Errorf("ip has %d failures after success, want the 2 earlier ones", got)
+	}
+}
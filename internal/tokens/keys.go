@@ -0,0 +1,125 @@
+package tokens
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+//Key signs and verifies tokens, it is found by its ID (kid).
+type Key struct {
+	ID  string
+	Alg string
+
+	secret  []byte
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+//KeySet signs with the active key and verifies with any of the keys,
+//so keys can be rotated: add a new key, make it active,
+//remove the old one once tokens signed by it have expired.
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+}
+
+//keys file format:
+//{
+//  "active": "2020-06",
+//  "keys": [
+//    {"kid": "2020-05", "alg": "HS256", "secret": "<base64>"},
+//    {"kid": "2020-06", "alg": "EdDSA", "seed": "<base64 of 32 bytes>"},
+//    {"kid": "2020-04", "alg": "EdDSA", "public_key": "<base64>"}
+//  ]
+//}
+//Ed25519 keys with only public_key can't be active.
+type keysFile struct {
+	Active string `json:"active"`
+	Keys   []struct {
+		ID        string `json:"kid"`
+		Alg       string `json:"alg"`
+		Secret    string `json:"secret"`
+		Seed      string `json:"seed"`
+		PublicKey string `json:"public_key"`
+	} `json:"keys"`
+}
+
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read keys file")
+	}
+
+	file := keysFile{}
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't parse keys file")
+	}
+
+	ks := &KeySet{keys: make(map[string]*Key)}
+	for _, k := range file.Keys {
+		key := &Key{ID: k.ID, Alg: k.Alg}
+		switch k.Alg {
+		case AlgHS256:
+			key.secret, err = base64.StdEncoding.DecodeString(k.Secret)
+			if err != nil || len(key.secret) < 32 {
+				return nil, errors.Errorf("key %q: secret must be at least 32 base64 encoded bytes", k.ID)
+			}
+		case AlgEdDSA:
+			if k.Seed != "" {
+				seed, err := base64.StdEncoding.DecodeString(k.Seed)
+				if err != nil || len(seed) != ed25519.SeedSize {
+					return nil, errors.Errorf("key %q: seed must be %d base64 encoded bytes", k.ID, ed25519.SeedSize)
+				}
+				key.private = ed25519.NewKeyFromSeed(seed)
+				key.public = key.private.Public().(ed25519.PublicKey)
+			} else {
+				public, err := base64.StdEncoding.DecodeString(k.PublicKey)
+				if err != nil || len(public) != ed25519.PublicKeySize {
+					return nil, errors.Errorf("key %q: public_key must be %d base64 encoded bytes",
+						k.ID, ed25519.PublicKeySize)
+				}
+				key.public = public
+			}
+		default:
+			return nil, errors.Errorf("key %q: unsupported alg %q", k.ID, k.Alg)
+		}
+
+		if _, ok := ks.keys[k.ID]; ok {
+			return nil, errors.Errorf("duplicate key %q", k.ID)
+		}
+		ks.keys[k.ID] = key
+	}
+
+	ks.active = ks.keys[file.Active]
+	if ks.active == nil {
+		return nil, errors.Errorf("active key %q not found", file.Active)
+	}
+	if ks.active.Alg == AlgEdDSA && ks.active.private == nil {
+		return nil, errors.Errorf("active key %q has no private part", file.Active)
+	}
+
+	return ks, nil
+}
+
+//NewRandomKeySet returns a set with one HS256 key that lives
+//only as long as the process does.
+func NewRandomKeySet() (*KeySet, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, errors.Wrap(err, "can't generate key")
+	}
+
+	key := &Key{ID: "ephemeral", Alg: AlgHS256, secret: secret}
+	return &KeySet{active: key, keys: map[string]*Key{key.ID: key}}, nil
+}
@@ -0,0 +1,174 @@
+package tokens
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrMalformed = errors.New("malformed token")
+	ErrSignature = errors.New("invalid token signature")
+	ErrExpired   = errors.New("token expired")
+	ErrPurpose   = errors.New("token issued for another purpose")
+)
+
+//Claims of signed tokens. Access tokens have no Purpose,
+//one-time tokens (sign in challenges etc.) always have one,
+//so they can't be used in place of each other.
+type Claims struct {
+	Subject    int64  `json:"sub"`
+	SessionID  string `json:"sid,omitempty"`
+	Role       string `json:"role,omitempty"` //role changes reach signed tokens on refresh
+	Purpose    string `json:"pur,omitempty"`
+	ID         string `json:"jti,omitempty"`   //set on single-use tokens, see UsedStorage
+	Email      string `json:"email,omitempty"` //the address a verification was sent to
+	IssuedAt   int64  `json:"iat"`
+	IssuedAtMs int64  `json:"iat_ms,omitempty"` //iat in milliseconds, revocations need more than seconds
+	ExpiresAt  int64  `json:"exp"`
+}
+
+//SetIssuedAt sets iat and iat_ms
+func (c *Claims) SetIssuedAt(t time.Time) {
+	c.IssuedAt = t.Unix()
+	c.IssuedAtMs = t.UnixNano() / int64(time.Millisecond)
+}
+
+//Issued is when the token was issued, as precise as the token tells
+func (c *Claims) Issued() time.Time {
+	if c.IssuedAtMs != 0 {
+		return time.Unix(0, c.IssuedAtMs*int64(time.Millisecond))
+	}
+	return time.Unix(c.IssuedAt, 0)
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+var b64 = base64.RawURLEncoding
+
+//LooksSigned tells signed tokens from opaque session bearers.
+func LooksSigned(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+//Sign returns a compact JWS (JWT) signed with the active key.
+func (ks *KeySet) Sign(claims interface{}) (string, error) {
+	key := ks.active
+	head, err := json.Marshal(header{Alg: key.Alg, Typ: "JWT", Kid: key.ID})
+	if err != nil {
+		return "", errors.Wrap(err, "can't marshal token header")
+	}
+
+	body, err := json.Marshal(claims)
+	if err != nil {
+		return "", errors.Wrap(err, "can't marshal token claims")
+	}
+
+	signingInput := b64.EncodeToString(head) + "." + b64.EncodeToString(body)
+
+	var sig []byte
+	switch key.Alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, key.secret)
+		mac.Write([]byte(signingInput))
+		sig = mac.Sum(nil)
+	case AlgEdDSA:
+		sig = ed25519.Sign(key.private, []byte(signingInput))
+	}
+
+	return signingInput + "." + b64.EncodeToString(sig), nil
+}
+
+//Verify checks the signature of token and decodes its claims into dst.
+//Expiration is checked by the caller.
+func (ks *KeySet) Verify(token string, dst interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrMalformed
+	}
+
+	headData, err := b64.DecodeString(parts[0])
+	if err != nil {
+		return ErrMalformed
+	}
+
+	head := header{}
+	err = json.Unmarshal(headData, &head)
+	if err != nil {
+		return ErrMalformed
+	}
+
+	sig, err := b64.DecodeString(parts[2])
+	if err != nil {
+		return ErrMalformed
+	}
+
+	key := ks.keys[head.Kid]
+	//alg from the header must match the key,
+	//otherwise public keys could be used as HMAC secrets
+	if key == nil || key.Alg != head.Alg {
+		return ErrSignature
+	}
+
+	signingInput := []byte(parts[0] + "." + parts[1])
+	switch key.Alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, key.secret)
+		mac.Write(signingInput)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrSignature
+		}
+	case AlgEdDSA:
+		if !ed25519.Verify(key.public, signingInput, sig) {
+			return ErrSignature
+		}
+	default:
+		return ErrSignature
+	}
+
+	body, err := b64.DecodeString(parts[1])
+	if err != nil {
+		return ErrMalformed
+	}
+
+	err = json.Unmarshal(body, dst)
+	if err != nil {
+		return ErrMalformed
+	}
+
+	return nil
+}
+
+//Parse verifies an access token and checks that it has not expired.
+func (ks *KeySet) Parse(token string, now time.Time) (*Claims, error) {
+	return ks.ParseFor(token, "", now)
+}
+
+//ParseFor verifies a token issued for purpose and checks that it has not expired.
+func (ks *KeySet) ParseFor(token string, purpose string, now time.Time) (*Claims, error) {
+	claims := Claims{}
+	err := ks.Verify(token, &claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Purpose != purpose {
+		return nil, ErrPurpose
+	}
+
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, ErrExpired
+	}
+
+	return &claims, nil
+}
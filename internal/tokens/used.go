@@ -0,0 +1,14 @@
+package tokens
+
+import (
+	"context"
+	"time"
+)
+
+//UsedStorage remembers the IDs of single-use tokens that were
+//already accepted. An ID is only kept until its token expires,
+//after that the signature check rejects the token anyway.
+type UsedStorage interface {
+	//Use marks the token as used and returns false if it already was.
+	Use(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error)
+}
@@ -0,0 +1,150 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+//rfcSecret is the SHA-1 key of RFC 6238 appendix B, "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238(t *testing.T) {
+	//the RFC gives 8 digits, we show the last 6 of them
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Counter(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("can't get code at %d: %s", tt.unix, err)
+		}
+		if code != tt.code {
+			t.Errorf("code at %d is %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestValidateWindow(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Counter(now)
+
+	tests := []struct {
+		name    string
+		counter int64
+		ok      bool
+	}{
+		{"previous step", current - 1, true},
+		{"current step", current, true},
+		{"next step", current + 1, true},
+		{"two steps ago", current - 2, false},
+		{"two steps ahead", current + 2, false},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, tt.counter)
+		if err != nil {
+			t.Fatalf("can't get code: %s", err)
+		}
+
+		counter, ok, err := Validate(rfcSecret, code, now, 0)
+		if err != nil {
+			t.Fatalf("%s: can't validate: %s", tt.name, err)
+		}
+		if ok != tt.ok {
+			t.Errorf("%s: valid is %t, want %t", tt.name, ok, tt.ok)
+		}
+		if ok && counter != tt.counter {
+			t.Errorf("%s: matched counter %d, want %d", tt.name, counter, tt.counter)
+		}
+	}
+}
+
+func TestValidateReusedCounter(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, err := Code(rfcSecret, Counter(now))
+	if err != nil {
+		t.Fatalf("can't get code: %s", err)
+	}
+
+	counter, ok, err := Validate(rfcSecret, code, now, 0)
+	if err != nil || !ok {
+		t.Fatalf("first use returned %t, %v", ok, err)
+	}
+
+	_, ok, err = Validate(rfcSecret, code, now, counter)
+	if err != nil {
+		t.Fatalf("can't validate: %s", err)
+	}
+	if ok {
+		t.Errorf("code accepted twice")
+	}
+
+	//a code of an earlier step is rejected too, once a later one was used
+	previous, err := Code(rfcSecret, counter-1)
+	if err != nil {
+		t.Fatalf("can't get code: %s", err)
+	}
+	_, ok, err = Validate(rfcSecret, previous, now, counter)
+	if err != nil {
+		t.Fatalf("can't validate: %s", err)
+	}
+	if ok {
+		t.Errorf("code of an earlier step accepted after a later one")
+	}
+}
+
+func TestValidateMalformed(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+		_, ok, err := Validate(rfcSecret, code, now, 0)
+		if err != nil || ok {
+			t.Errorf("code %q returned %t, %v", code, ok, err)
+		}
+	}
+
+	_, _, err := Validate("not base32!", "123456", now, 0)
+	if err == nil {
+		t.Errorf("malformed secret accepted")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes()
+	if err != nil {
+		t.Fatalf("can't generate recovery codes: %s", err)
+	}
+	if len(codes) != recoveryCodesCount || len(hashes) != recoveryCodesCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodesCount)
+	}
+
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		if seen[hashes[i]] {
+			t.Errorf("hash of code %s repeats", code)
+		}
+		seen[hashes[i]] = true
+
+		//users may type codes in upper case, without dashes or with spaces around
+		typed := []string{code, strings.ToUpper(code), strings.Replace(code, "-", "", -1), " " + code + " "}
+		for _, c := range typed {
+			if HashRecoveryCode(c) != hashes[i] {
+				t.Errorf("hash of %q doesn't match the hash of %q", c, code)
+			}
+		}
+	}
+
+	if HashRecoveryCode("aaaa-bbbb-cccc-dddd") == HashRecoveryCode("aaaa-bbbb-cccc-dddx") {
+		t.Errorf("different codes have the same hash")
+	}
+}
@@ -0,0 +1,27 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+//ErrIdentityLinked is returned by IdentityStorage.Create when the
+//identity is already linked to a user, checks before it can race.
+var ErrIdentityLinked = errors.New("identity is already linked")
+
+//Identity links an account at an external identity provider
+//to a user. Subject is the provider's stable user id.
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"`
+	UserID    int64     `json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type IdentityStorage interface {
+	Get(ctx context.Context, provider, subject string) (*Identity, error)
+	Create(ctx context.Context, identity *Identity) error
+	ListByUserID(ctx context.Context, userID int64) ([]Identity, error)
+}
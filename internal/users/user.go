@@ -1,11 +1,35 @@
 package user
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"strconv"
 	"time"
 )
 
+//ErrBirthdayFormat is returned by UnmarshalJSON, birthdays are YYYY-MM-DD.
+var ErrBirthdayFormat = errors.New("birthday must be YYYY-MM-DD")
+
+//ErrEmailTaken is returned by Storage.Create and UpdateUser when
+//another user has the email, checks before them can race.
+var ErrEmailTaken = errors.New("email is already registered")
+
+const (
+	RoleUser    = "user"
+	RoleAdmin   = "admin"
+	RoleAuditor = "auditor" //can read everything an admin can, can't change anything
+)
+
+func ValidRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin || role == RoleAuditor
+}
+
+//CanReadAll reports whether the role can see data of other users.
+func CanReadAll(role string) bool {
+	return role == RoleAdmin || role == RoleAuditor
+}
+
 type User struct {
 	ID        int64      `json:"-"`
 	FirstName string     `json:"first_name"`
@@ -13,24 +37,41 @@ type User struct {
 	Birthday  *time.Time `json:"birthday,omitempty"`
 	Email     string     `json:"email"`
 	Password  string     `json:"-"`
+	Role      string     `json:"-"`
 	CreatedAt time.Time  `json:"-"`
 	UpdatedAt time.Time  `json:"-"`
+
+	//EmailVerifiedAt is reset when the email changes
+	EmailVerifiedAt *time.Time `json:"-"`
+
+	//TOTP is enabled once TOTPEnabledAt is set,
+	//before that TOTPSecret is pending confirmation.
+	//TOTPCounter is the last accepted time step, codes can't be reused.
+	TOTPSecret    string     `json:"-"`
+	TOTPEnabledAt *time.Time `json:"-"`
+	TOTPCounter   int64      `json:"-"`
 }
 
 type Storage interface {
-	Create(user *User) error
-	GetByID(id int64) (*User, error)
-	GetByEmail(email string) (*User, error)
-	NextID() (int64, error)
-	UpdateUser(user *User) error
+	Create(ctx context.Context, user *User) error
+	GetByID(ctx context.Context, id int64) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	GetAll(ctx context.Context) ([]User, error)
+	UpdateUser(ctx context.Context, user *User) error
+
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes []string) error
+	UseRecoveryCode(ctx context.Context, userID int64, hash string) (bool, error)
 }
 
 func (user *User) MarshalJSON() ([]byte, error) {
 	value := map[string]string{
-		"user_id":    strconv.FormatInt(user.ID, 10),
-		"first_name": user.FirstName,
-		"last_name":  user.LastName,
-		"email":      user.Email,
+		"user_id":        strconv.FormatInt(user.ID, 10),
+		"first_name":     user.FirstName,
+		"last_name":      user.LastName,
+		"email":          user.Email,
+		"role":           user.Role,
+		"totp_enabled":   strconv.FormatBool(user.TOTPEnabledAt != nil),
+		"email_verified": strconv.FormatBool(user.EmailVerifiedAt != nil),
 	}
 	if user.Birthday != nil {
 		value["birthday"] = user.Birthday.String()[:10]
@@ -39,6 +80,7 @@ func (user *User) MarshalJSON() ([]byte, error) {
 	return json.Marshal(value)
 }
 
+//role is never read from requests, see ValidRole
 func (user *User) UnmarshalJSON(data []byte) error {
 	request := map[string]string{}
 	err := json.Unmarshal(data, &request)
@@ -65,7 +107,7 @@ func (user *User) UnmarshalJSON(data []byte) error {
 	if _, ok := request["birthday"]; ok {
 		birthday, err := time.Parse(time.RFC3339, request["birthday"]+"T00:00:00Z")
 		if err != nil {
-			return err
+			return ErrBirthdayFormat
 		}
 		user.Birthday = &birthday
 	}
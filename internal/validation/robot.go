@@ -0,0 +1,85 @@
+package validation
+
+import (
+	"regexp"
+	"strconv"
+
+	"finPrj/internal/robots"
+)
+
+//exchange tickers: upper case letters and digits, dots for share classes
+var tickerRe = regexp.MustCompile(`^[A-Z][A-Z0-9.]{0,9}$`)
+
+//Robot checks the fields a user sets on PostRobot and UpdateRobot.
+func Robot(robot *robots.Robot) error {
+	errs := Errors{}
+
+	if robot.Ticker == "" {
+		errs.Add("ticker", CodeRequired, "ticker is required")
+	} else if !tickerRe.MatchString(robot.Ticker) {
+		errs.Add("ticker", CodeFormat, "ticker must be 1-10 upper case letters, digits or dots")
+	}
+
+	if robot.BuyPrice <= 0 {
+		errs.Add("buy_price", CodeOutOfRange, "buy_price must be positive")
+	}
+
+	//no sell price means the robot only buys
+	if robot.SellPrice < 0 {
+		errs.Add("sell_price", CodeOutOfRange, "sell_price must not be negative")
+	} else if robot.SellPrice > 0 && robot.BuyPrice > 0 && robot.SellPrice <= robot.BuyPrice {
+		errs.Add("sell_price", CodeInconsistent, "sell_price must be greater than buy_price")
+	}
+
+	switch {
+	case (robot.PlanStart == nil) != (robot.PlanEnd == nil):
+		field := "plan_end"
+		if robot.PlanStart == nil {
+			field = "plan_start"
+		}
+		errs.Add(field, CodeRequired, "plan_start and plan_end are set together")
+	case robot.PlanStart != nil && !robot.PlanEnd.After(*robot.PlanStart):
+		errs.Add("plan_end", CodeInconsistent, "plan_end must be after plan_start")
+	}
+
+	if robot.PlanYield < -100 || robot.PlanYield > 1000 {
+		errs.Add("plan_yield", CodeOutOfRange, "plan_yield must be between -100 and 1000 percent")
+	}
+
+	if robot.FactYield < -100 {
+		errs.Add("fact_yield", CodeOutOfRange, "fact_yield must not be below -100 percent")
+	}
+
+	if robot.DealsCount < 0 {
+		errs.Add("deals_counts", CodeOutOfRange, "deals_counts must not be negative")
+	}
+
+	errs.Tags("tags", robot.Tags)
+
+	return errs.Err()
+}
+
+const maxTags = 10
+
+var tagRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+//Tags are lower case words, so searching them needs no normalization.
+func (e *Errors) Tags(field string, tags []string) {
+	if len(tags) > maxTags {
+		e.Add(field, CodeTooLong, field+" can't have more than 10 tags")
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		switch {
+		case !tagRe.MatchString(tag):
+			e.Add(field, CodeFormat, "tag "+strconv.Quote(tag)+" must be 1-32 lower case letters, digits or dashes")
+			return
+		case seen[tag]:
+			e.Add(field, CodeInconsistent, "tag "+strconv.Quote(tag)+" is repeated")
+			return
+		}
+		seen[tag] = true
+	}
+}
@@ -0,0 +1,63 @@
+package validation
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	users "finPrj/internal/users"
+)
+
+const (
+	PasswordMinLength = 8
+	PasswordMaxLength = 128 //hashing long passwords is slow on purpose
+)
+
+var minBirthday = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+
+//Password requires letters and digits and rejects the email as password.
+func (e *Errors) Password(field, password, email string) {
+	if !e.Length(field, password, PasswordMinLength, PasswordMaxLength) {
+		return
+	}
+
+	letter, digit := false, false
+	for _, r := range password {
+		letter = letter || unicode.IsLetter(r)
+		digit = digit || unicode.IsDigit(r)
+	}
+
+	if !letter || !digit {
+		e.Add(field, CodeWeak, field+" must contain letters and digits")
+		return
+	}
+
+	if email != "" && strings.EqualFold(password, email) {
+		e.Add(field, CodeWeak, field+" must not be the email")
+	}
+}
+
+func (e *Errors) Birthday(field string, birthday *time.Time, now time.Time) {
+	if birthday == nil {
+		return
+	}
+
+	if birthday.Before(minBirthday) || birthday.After(now) {
+		e.Add(field, CodeOutOfRange, field+" must be between 1900-01-01 and today")
+	}
+}
+
+//User checks a user sent to SignUp or PutUser. The password is
+//required on sign up only, PutUser keeps the old one if it is empty.
+func User(user *users.User, passwordRequired bool) error {
+	errs := Errors{}
+	errs.Email("email", user.Email)
+	errs.Name("first_name", user.FirstName)
+	errs.Name("last_name", user.LastName)
+	errs.Birthday("birthday", user.Birthday, time.Now().UTC())
+	if passwordRequired || user.Password != "" {
+		errs.Password("password", user.Password, user.Email)
+	}
+
+	return errs.Err()
+}
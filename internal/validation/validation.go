@@ -0,0 +1,94 @@
+package validation
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//Codes of field errors, clients should match on them, not on messages.
+const (
+	CodeRequired     = "required"
+	CodeFormat       = "invalid_format"
+	CodeType         = "invalid_type"
+	CodeTooShort     = "too_short"
+	CodeTooLong      = "too_long"
+	CodeOutOfRange   = "out_of_range"
+	CodeWeak         = "weak"
+	CodeInconsistent = "inconsistent"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+//Errors of one request, every invalid field is reported,
+//not only the first one.
+type Errors []FieldError
+
+func (e *Errors) Add(field, code, message string) {
+	*e = append(*e, FieldError{Field: field, Code: code, Message: message})
+}
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Field+": "+fe.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+//Err returns nil when there are no errors, so the result
+//can be checked with err != nil.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+//Length checks the number of runes, not bytes.
+func (e *Errors) Length(field, value string, min, max int) bool {
+	n := utf8.RuneCountInString(value)
+	switch {
+	case n == 0 && min > 0:
+		e.Add(field, CodeRequired, field+" is required")
+	case n < min:
+		e.Add(field, CodeTooShort, field+" is too short")
+	case n > max:
+		e.Add(field, CodeTooLong, field+" is too long")
+	default:
+		return true
+	}
+	return false
+}
+
+//local@domain.tld without spaces, the only real check is a mail
+var emailRe = regexp.MustCompile(`^[^@\s]+@[^@\s.]+(\.[^@\s.]+)+$`)
+
+func (e *Errors) Email(field, value string) {
+	if !e.Length(field, value, 1, 254) {
+		return
+	}
+
+	if !emailRe.MatchString(value) {
+		e.Add(field, CodeFormat, field+" is not a valid email")
+	}
+}
+
+//Name allows letters of any script, spaces, dots, dashes and apostrophes.
+func (e *Errors) Name(field, value string) {
+	if !e.Length(field, value, 1, 100) {
+		return
+	}
+
+	for _, r := range value {
+		if !unicode.IsLetter(r) && !unicode.IsMark(r) && !strings.ContainsRune(" .-'", r) {
+			e.Add(field, CodeFormat, field+" contains invalid characters")
+			return
+		}
+	}
+}
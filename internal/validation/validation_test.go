@@ -0,0 +1,276 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"finPrj/internal/robots"
+	users "finPrj/internal/users"
+)
+
+//codes lists errors as field:code, messages are free to change
+func codes(err error) string {
+	if err == nil {
+		return ""
+	}
+	list := []string{}
+	for _, fe := range err.(Errors) {
+		list = append(list, fe.Field+":"+fe.Code)
+	}
+	return strings.Join(list, ",")
+}
+
+func TestErrors(t *testing.T) {
+	errs := Errors{}
+	if errs.Err() != nil {
+		t.Errorf("no errors returned %v", errs.Err())
+	}
+
+	errs.Add("email", CodeRequired, "email is required")
+	errs.Add("password", CodeWeak, "password is weak")
+	if got := codes(errs.Err()); got != "email:required,password:weak" {
+		t.Errorf("got %s", got)
+	}
+	if got := errs.Error(); got != "email: email is required; password: password is weak" {
+		t.Errorf("got message %q", got)
+	}
+}
+
+func TestLength(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", "f:required"},
+		{"ab", "f:too_short"},
+		{"abc", ""},
+		{"abcde", ""},
+		{"abcdef", "f:too_long"},
+		//runes are counted, not bytes
+		{"жжжжж", ""},
+	}
+
+	for _, tt := range tests {
+		errs := Errors{}
+		ok := errs.Length("f", tt.value, 3, 5)
+		if got := codes(errs.Err()); got != tt.want || ok != (tt.want == "") {
+			t.Errorf("Length(%q) = %t, %s, want %s", tt.value, ok, got, tt.want)
+		}
+	}
+}
+
+func TestEmail(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"ann@example.com", ""},
+		{"ann.lee+robots@mail.example.co.uk", ""},
+		{"", "email:required"},
+		{"ann", "email:invalid_format"},
+		{"ann@example", "email:invalid_format"},
+		{"ann@@example.com", "email:invalid_format"},
+		{"ann lee@example.com", "email:invalid_format"},
+		{"ann@example..com", "email:invalid_format"},
+		{strings.Repeat("a", 250) + "@example.com", "email:too_long"},
+	}
+
+	for _, tt := range tests {
+		errs := Errors{}
+		errs.Email("email", tt.value)
+		if got := codes(errs.Err()); got != tt.want {
+			t.Errorf("Email(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"Ann", ""},
+		{"Mary-Jane O'Neil Jr.", ""},
+		{"Анна", ""},
+		{"José", ""},
+		{"", "name:required"},
+		{"Ann1", "name:invalid_format"},
+		{"<script>", "name:invalid_format"},
+		{strings.Repeat("a", 101), "name:too_long"},
+	}
+
+	for _, tt := range tests {
+		errs := Errors{}
+		errs.Name("name", tt.value)
+		if got := codes(errs.Err()); got != tt.want {
+			t.Errorf("Name(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestPassword(t *testing.T) {
+	tests := []struct {
+		password string
+		email    string
+		want     string
+	}{
+		{"Passw0rd!Passw0rd", "ann@example.com", ""},
+		{"", "ann@example.com", "password:required"},
+		{"pa55", "ann@example.com", "password:too_short"},
+		{strings.Repeat("a1", 65), "ann@example.com", "password:too_long"},
+		{"passwordpassword", "ann@example.com", "password:weak"},
+		{"1234567890", "ann@example.com", "password:weak"},
+		{"Ann1@example.com", "ann1@example.com", "password:weak"},
+		{"Ann1@example.com", "", ""},
+	}
+
+	for _, tt := range tests {
+		errs := Errors{}
+		errs.Password("password", tt.password, tt.email)
+		if got := codes(errs.Err()); got != tt.want {
+			t.Errorf("Password(%q, %q) = %s, want %s", tt.password, tt.email, got, tt.want)
+		}
+	}
+}
+
+func TestBirthday(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	day := func(y int, m time.Month, d int) *time.Time {
+		t := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+
+	tests := []struct {
+		name     string
+		birthday *time.Time
+		want     string
+	}{
+		{"not set", nil, ""},
+		{"usual", day(1990, 1, 2), ""},
+		{"first allowed", day(1900, 1, 1), ""},
+		{"today", day(2020, 6, 1), ""},
+		{"too old", day(1899, 12, 31), "birthday:out_of_range"},
+		{"future", day(2020, 6, 2), "birthday:out_of_range"},
+	}
+
+	for _, tt := range tests {
+		errs := Errors{}
+		errs.Birthday("birthday", tt.birthday, now)
+		if got := codes(errs.Err()); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+		want string
+	}{
+		{"none", nil, ""},
+		{"usual", []string{"tech", "long-term", "s3"}, ""},
+		{"ten", strings.Split("a,b,c,d,e,f,g,h,i,j", ","), ""},
+		{"eleven", strings.Split("a,b,c,d,e,f,g,h,i,j,k", ","), "tags:too_long"},
+		{"upper case", []string{"Tech"}, "tags:invalid_format"},
+		{"empty", []string{""}, "tags:invalid_format"},
+		{"leading dash", []string{"-tech"}, "tags:invalid_format"},
+		{"space", []string{"long term"}, "tags:invalid_format"},
+		{"too long", []string{strings.Repeat("a", 33)}, "tags:invalid_format"},
+		{"longest", []string{strings.Repeat("a", 32)}, ""},
+		{"repeated", []string{"tech", "tech"}, "tags:inconsistent"},
+	}
+
+	for _, tt := range tests {
+		errs := Errors{}
+		errs.Tags("tags", tt.tags)
+		if got := codes(errs.Err()); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRobot(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	valid := func() *robots.Robot {
+		return &robots.Robot{Ticker: "BRK.B", BuyPrice: 10, SellPrice: 12, PlanYield: 5}
+	}
+
+	tests := []struct {
+		name   string
+		change func(robo *robots.Robot)
+		want   string
+	}{
+		{"valid", func(robo *robots.Robot) {}, ""},
+		{"no ticker", func(robo *robots.Robot) { robo.Ticker = "" }, "ticker:required"},
+		{"lower case ticker", func(robo *robots.Robot) { robo.Ticker = "aapl" }, "ticker:invalid_format"},
+		{"long ticker", func(robo *robots.Robot) { robo.Ticker = "ABCDEFGHIJK" }, "ticker:invalid_format"},
+		{"zero buy price", func(robo *robots.Robot) { robo.BuyPrice = 0 }, "buy_price:out_of_range"},
+		{"only buys", func(robo *robots.Robot) { robo.SellPrice = 0 }, ""},
+		{"negative sell price", func(robo *robots.Robot) { robo.SellPrice = -1 }, "sell_price:out_of_range"},
+		{"sell below buy", func(robo *robots.Robot) { robo.SellPrice = 9 }, "sell_price:inconsistent"},
+		{"sell equals buy", func(robo *robots.Robot) { robo.SellPrice = 10 }, "sell_price:inconsistent"},
+		{"plan", func(robo *robots.Robot) { robo.PlanStart, robo.PlanEnd = &start, &end }, ""},
+		{"plan without end", func(robo *robots.Robot) { robo.PlanStart = &start }, "plan_end:required"},
+		{"plan without start", func(robo *robots.Robot) { robo.PlanEnd = &end }, "plan_start:required"},
+		{"plan ends first", func(robo *robots.Robot) { robo.PlanStart, robo.PlanEnd = &end, &start },
+			"plan_end:inconsistent"},
+		{"empty plan", func(robo *robots.Robot) { robo.PlanStart, robo.PlanEnd = &start, &start },
+			"plan_end:inconsistent"},
+		{"plan yield too low", func(robo *robots.Robot) { robo.PlanYield = -101 }, "plan_yield:out_of_range"},
+		{"plan yield too high", func(robo *robots.Robot) { robo.PlanYield = 1001 }, "plan_yield:out_of_range"},
+		{"fact yield too low", func(robo *robots.Robot) { robo.FactYield = -101 }, "fact_yield:out_of_range"},
+		{"negative deals", func(robo *robots.Robot) { robo.DealsCount = -1 }, "deals_counts:out_of_range"},
+		{"bad tag", func(robo *robots.Robot) { robo.Tags = []string{"Tech"} }, "tags:invalid_format"},
+		{"every error", func(robo *robots.Robot) { robo.Ticker, robo.BuyPrice, robo.SellPrice = "", 0, -1 },
+			"ticker:required,buy_price:out_of_range,sell_price:out_of_range"},
+	}
+
+	for _, tt := range tests {
+		robo := valid()
+		tt.change(robo)
+		if got := codes(Robot(robo)); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUser(t *testing.T) {
+	valid := func() *users.User {
+		birthday := time.Date(1990, 1, 2, 0, 0, 0, 0, time.UTC)
+		return &users.User{
+			FirstName: "Ann",
+			LastName:  "Lee",
+			Birthday:  &birthday,
+			Email:     "ann@example.com",
+			Password:  "Passw0rd!Passw0rd",
+		}
+	}
+
+	tests := []struct {
+		name             string
+		change           func(user *users.User)
+		passwordRequired bool
+		want             string
+	}{
+		{"sign up", func(user *users.User) {}, true, ""},
+		{"sign up without password", func(user *users.User) { user.Password = "" }, true, "password:required"},
+		{"update keeps password", func(user *users.User) { user.Password = "" }, false, ""},
+		{"update with weak password", func(user *users.User) { user.Password = "password" }, false, "password:weak"},
+		{"every field", func(user *users.User) {
+			user.Email, user.FirstName, user.LastName = "ann", "", "L33"
+			future := time.Now().Add(48 * time.Hour)
+			user.Birthday = &future
+		}, false, "email:invalid_format,first_name:required,last_name:invalid_format,birthday:out_of_range"},
+	}
+
+	for _, tt := range tests {
+		user := valid()
+		tt.change(user)
+		if got := codes(User(user, tt.passwordRequired)); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}